@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os/signal"
+	"syscall"
 
 	"github.com/zjoart/countryxchange/cmd/routes"
 	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/internal/countries"
 	"github.com/zjoart/countryxchange/internal/database"
 	"github.com/zjoart/countryxchange/pkg/logger"
 
@@ -19,7 +23,10 @@ func main() {
 	}
 
 	// Load configuration
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.Fatal("Invalid configuration", logger.WithError(err))
+	}
 
 	// Initialize database
 	db, errDb := database.InitDB(&cfg.DB)
@@ -29,17 +36,80 @@ func main() {
 
 	defer db.Close()
 
+	dialect, err := database.DialectFor(cfg.DB.Driver)
+	if err != nil {
+		logger.Fatal("Unsupported database driver", logger.WithError(err))
+	}
+	svc := countries.NewService(db, cfg, dialect)
+
+	// cancelled by SIGINT/SIGTERM to start the graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// periodic CSV backups of the countries table (BACKUP_INTERVAL)
+	go svc.RunBackups(ctx)
+
 	// Initialize the application
 
-	router := routes.SetUpRoutes(db, cfg)
+	router, adminRouter := routes.SetUpRoutes(svc)
 
 	// Initialize the application
-	addr := fmt.Sprintf(":%s", cfg.Port)
 	logger.Info("Service starting", logger.Fields{
-		"port": cfg.Port,
+		"port":          cfg.Port,
+		"admin_port":    cfg.AdminPort,
+		"write_timeout": cfg.Server.WriteTimeout.String(),
 	})
 
-	if err := http.ListenAndServe(addr, router); err != nil {
-		logger.Fatal("Server failed", logger.WithError(err))
+	servers := []*http.Server{newServer(cfg, cfg.Port, router)}
+	if adminRouter != nil {
+		// admin endpoints only answer on their own, internal-only port
+		servers = append(servers, newServer(cfg, cfg.AdminPort, adminRouter))
+	}
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Server failed", logger.Fields{"addr": srv.Addr, "error": err.Error()})
+			}
+		}(srv)
+	}
+
+	<-ctx.Done()
+	stop()
+	shutdown(svc, servers)
+}
+
+// shutdown stops accepting connections and waits up to the grace period for
+// in-flight requests and background image renders; the deferred db.Close
+// in main runs after it returns
+func shutdown(svc *countries.Service, servers []*http.Server) {
+	cfg := svc.Config
+	logger.Info("Shutdown: signal received, draining", logger.Fields{"grace": cfg.Server.ShutdownGrace.String()})
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownGrace)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warn("Shutdown: in-flight requests did not finish in time", logger.Fields{"addr": srv.Addr, "error": err.Error()})
+		}
+	}
+	logger.Info("Shutdown: HTTP servers stopped")
+
+	if err := svc.WaitBackground(ctx); err != nil {
+		logger.Warn("Shutdown: background work did not finish in time", logger.WithError(err))
+	} else {
+		logger.Info("Shutdown: background work finished")
+	}
+	logger.Info("Shutdown: closing database")
+}
+
+// newServer returns an http.Server on port with the configured timeouts
+func newServer(cfg *config.Config, port string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%s", port),
+		Handler:           handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
 	}
 }
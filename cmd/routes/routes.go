@@ -1,7 +1,7 @@
 package routes
 
 import (
-	"database/sql"
+	"encoding/json"
 
 	"github.com/zjoart/countryxchange/internal/config"
 
@@ -12,6 +12,9 @@ import (
 	"github.com/zjoart/countryxchange/internal/middleware"
 
 	"github.com/zjoart/countryxchange/internal/docs"
+	"github.com/zjoart/countryxchange/internal/metrics"
+	"github.com/zjoart/countryxchange/internal/version"
+	"github.com/zjoart/countryxchange/pkg/logger"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 
@@ -34,17 +37,11 @@ import (
 //	@BasePath	/
 
 // @schemes	http https
-func SetUpRoutes(db *sql.DB, cfg *config.Config) http.Handler {
-
-	allowedOrigins := []string{
-		"*",
-	}
-
-	// Create a new Gorilla Mux router
-	router := mux.NewRouter()
-
-	//Use cors middleware
-	router.Use(middleware.CorsMiddleware(allowedOrigins))
+func SetUpRoutes(svc *countries.Service) (public, admin http.Handler) {
+	db, cfg := svc.DB, svc.Config
+	// With ADMIN_PORT set the admin, destructive and observability endpoints
+	// get their own handler for an internal-only listener and 404 on the
+	// public one; without it admin is nil and public serves everything
 
 	// Dynamically set Swagger host and schemes from config
 	if cfg.Swagger.Host != "" {
@@ -53,28 +50,170 @@ func SetUpRoutes(db *sql.DB, cfg *config.Config) http.Handler {
 	if len(cfg.Swagger.Schemes) > 0 {
 		docs.SwaggerInfo.Schemes = cfg.Swagger.Schemes
 	}
+	if cfg.BasePath != "" {
+		docs.SwaggerInfo.BasePath = cfg.BasePath
+	}
+
+	router, api := newRouter(cfg)
+	adminRouter, adminAPI := router, api
+	if cfg.AdminPort != "" {
+		adminRouter, adminAPI = newRouter(cfg)
+		registerHealth(adminAPI, svc)
+	}
 
 	isProduction := cfg.AppEnv == "production"
 
 	if !isProduction {
 		// Serve Swagger UI only in non-production environments
-		router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
+		api.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
 		// Optional: Redirect /swagger to /swagger/index.html
-		router.HandleFunc("/swagger", func(w http.ResponseWriter, r *http.Request) {
-			http.Redirect(w, r, "/swagger/index.html", http.StatusMovedPermanently)
+		api.HandleFunc("/swagger", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, cfg.BasePath+"/swagger/index.html", http.StatusMovedPermanently)
 		})
 	}
 
+	// /version and /metrics leak build and traffic details, so they can be
+	// put behind the admin API key; /debug/* always is
+	observability := func(h http.Handler) http.Handler {
+		if cfg.ObservabilityAuth {
+			return middleware.APIKeyMiddleware(cfg.AdminAPIKey)(h)
+		}
+		return h
+	}
+
 	//Handle health
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Service is up and running"))
-	}).Methods("GET")
+	registerHealth(api, svc)
+
+	// Deployed API/build/schema versions for client compatibility checks
+	adminAPI.Handle("/version", observability(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a missing metadata table just means the schema was never created
+		schemaVersion, err := svc.GetSchemaVersion()
+		if err != nil {
+			logger.Debug("version: schema version unavailable", logger.WithError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"api_version":             docs.SwaggerInfo.Version,
+			"commit":                  version.Commit,
+			"build_date":              version.BuildDate,
+			"schema_version":          schemaVersion,
+			"expected_schema_version": countries.SchemaVersion,
+		})
+	}))).Methods("GET")
+
+	// Prometheus scrape endpoint
+	if cfg.Metrics {
+		adminAPI.Handle("/metrics", observability(metrics.Handler())).Methods("GET")
+	}
+
+	// DB connection pool stats for diagnosing pool exhaustion
+	adminAPI.Handle("/debug/dbstats", middleware.IPAllowlistMiddleware(cfg.AdminAllowedCIDRs, cfg.TrustedProxies)(middleware.APIKeyMiddleware(cfg.AdminAPIKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := db.Stats()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+			"max_idle_closed":      stats.MaxIdleClosed,
+			"max_idle_time_closed": stats.MaxIdleTimeClosed,
+			"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		})
+	})))).Methods("GET")
 
 	// Register country feature routes
 	// keep feature based routing in internal/countries
-	countries.RegisterRoutes(router, db, isProduction)
+	countries.RegisterRoutes(api, adminAPI, svc)
+
+	if cfg.AdminPort == "" {
+		return withCORS(cfg, router), nil
+	}
+	return withCORS(cfg, router), withCORS(cfg, adminRouter)
+}
 
-	return router
+// withCORS wraps h in the request ID and CORS middleware. They sit outside
+// mux because mux only runs its Use middleware on a matched route, so a
+// preflight OPTIONS (which no route lists) would get a bare 405 without any
+// CORS headers.
+func withCORS(cfg *config.Config, h http.Handler) http.Handler {
+	allowedOrigins := []string{
+		"*",
+	}
+
+	//Use cors middleware
+	h = middleware.CorsMiddleware(allowedOrigins, cfg.Server.CORSMaxAge)(h)
+
+	// tag every request (preflights included) with an X-Request-ID first so
+	// all later log lines can carry it
+	return middleware.RequestIDMiddleware()(h)
+}
+
+// newRouter returns a router with the shared middleware stack (withCORS
+// adds the outermost layers), and the subrouter under the configured base path that routes are mounted on
+func newRouter(cfg *config.Config) (*mux.Router, *mux.Router) {
+	// Create a new Gorilla Mux router
+	router := mux.NewRouter()
+
+	// one log line per request, keyed by route template as well as path
+	router.Use(middleware.AccessLogMiddleware())
+
+	// per-route request counts and latencies for /metrics. mux runs Use
+	// middleware only on a matched route, so the 404 and 405 handlers are
+	// wrapped too to count what matched nothing as "unmatched".
+	if cfg.Metrics {
+		router.Use(middleware.MetricsMiddleware())
+		router.NotFoundHandler = middleware.MetricsMiddleware()(http.NotFoundHandler())
+		router.MethodNotAllowedHandler = middleware.MetricsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}))
+	}
+
+	// compress larger responses; sits outside the timeout so the 503 of a
+	// timed out handler goes out through it too
+	if cfg.Server.GzipMinSize >= 0 {
+		router.Use(middleware.GzipMiddleware(cfg.Server.GzipMinSize))
+	}
+
+	// no handler may run longer than the configured timeout
+	router.Use(middleware.TimeoutMiddleware(cfg.Server.HandlerTimeout))
+
+	// Normalize malformed query keys once for every endpoint
+	router.Use(middleware.QueryNormalizationMiddleware())
+
+	// Mount every route under the configured base path (e.g. /api/v1)
+	api := router
+	if cfg.BasePath != "" {
+		api = router.PathPrefix(cfg.BasePath).Subrouter()
+	}
+	return router, api
+}
+
+// registerHealth mounts the probes: /health/live only shows the process
+// answers, /health/ready (and /health) also need the DB to answer a ping
+func registerHealth(r *mux.Router, svc *countries.Service) {
+	ready := readiness(svc)
+	r.HandleFunc("/health", ready).Methods("GET")
+	r.HandleFunc("/health/ready", ready).Methods("GET")
+	r.HandleFunc("/health/live", liveness).Methods("GET")
+}
+
+func liveness(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Service is up and running"))
+}
+
+// readiness answers 503 while the DB can't be reached
+func readiness(svc *countries.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, body := http.StatusOK, map[string]interface{}{"status": "ok", "db": "ok"}
+		if err := svc.PingDB(r.Context()); err != nil {
+			status, body = http.StatusServiceUnavailable, map[string]interface{}{"status": "unavailable", "db": "unreachable"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
 }
@@ -0,0 +1,266 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/internal/countries"
+	"github.com/zjoart/countryxchange/internal/database"
+	"github.com/zjoart/countryxchange/internal/docs"
+	"github.com/zjoart/countryxchange/internal/middleware"
+
+	_ "modernc.org/sqlite"
+)
+
+// testConfig returns the server settings the router tests run with
+func testConfig() *config.Config {
+	return &config.Config{
+		Server: config.ServerConfig{HandlerTimeout: time.Second, CORSMaxAge: 10 * time.Minute, GzipMinSize: 1024},
+	}
+}
+
+func TestPreflightReachesCORS(t *testing.T) {
+	cfg := testConfig()
+	router, api := newRouter(cfg)
+	api.HandleFunc("/countries", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	h := withCORS(cfg, router)
+
+	req := httptest.NewRequest(http.MethodOptions, "/countries", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("preflight status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Allow-Origin = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("Max-Age = %q, want 600", got)
+	}
+	if rec.Header().Get(middleware.RequestIDHeader) == "" {
+		t.Error("preflight has no request ID")
+	}
+}
+
+func TestUnmatchedRouteHasCORSHeaders(t *testing.T) {
+	cfg := testConfig()
+	router, api := newRouter(cfg)
+	api.HandleFunc("/countries", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	h := withCORS(cfg, router)
+
+	req := httptest.NewRequest(http.MethodGet, "/nowhere", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+	// the browser can only read the 404 if it carries the CORS headers
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Allow-Origin = %q", got)
+	}
+}
+
+func TestAdminRoutesOnlyOnAdminMux(t *testing.T) {
+	cfg := testConfig()
+	cfg.AdminPort = "9090"
+	cfg.AdminAPIKey = "test-key"
+	cfg.ObservabilityAuth = true
+	cfg.Metrics = true
+	// the requests below are all turned away before touching the DB
+	svc := countries.NewService(nil, cfg, database.MySQL{})
+	public, admin := SetUpRoutes(svc)
+	if admin == nil {
+		t.Fatal("no admin handler with ADMIN_PORT set")
+	}
+
+	adminOnly := []struct{ method, path string }{
+		{http.MethodGet, "/version"},
+		{http.MethodGet, "/metrics"},
+		{http.MethodGet, "/debug/dbstats"},
+		{http.MethodGet, "/audit"},
+		{http.MethodPost, "/admin/migrate"},
+		{http.MethodPost, "/drop-tables"},
+		{http.MethodDelete, "/status/last-refreshed"},
+		{http.MethodPost, "/flags/prefetch"},
+		{http.MethodPost, "/countries/recompute-gdp"},
+		{http.MethodPost, "/rates/refresh"},
+		{http.MethodPost, "/countries/image/generate"},
+		{http.MethodPost, "/countries"},
+		{http.MethodDelete, "/countries"},
+		{http.MethodPut, "/countries/Ghana"},
+		{http.MethodDelete, "/countries/Ghana"},
+		{http.MethodGet, "/countries/Ghana/upstream"},
+		{http.MethodPost, "/countries/Ghana/aliases"},
+	}
+	for _, rt := range adminOnly {
+		t.Run(rt.method+" "+rt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			public.ServeHTTP(rec, httptest.NewRequest(rt.method, rt.path, nil))
+			// 405 where a public route of another method shares the path,
+			// e.g. GET /countries/{name} for /countries/recompute-gdp
+			if rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("public: status = %d, want 404 or 405", rec.Code)
+			}
+
+			// present on the admin mux, where it still wants the key
+			rec = httptest.NewRecorder()
+			admin.ServeHTTP(rec, httptest.NewRequest(rt.method, rt.path, nil))
+			if rec.Code != http.StatusUnauthorized && rec.Code != http.StatusForbidden {
+				t.Errorf("admin: status = %d, want 401 or 403", rec.Code)
+			}
+		})
+	}
+
+	// the probes answer on both
+	for name, h := range map[string]http.Handler{"public": public, "admin": admin} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s /health/live = %d, want 200", name, rec.Code)
+		}
+	}
+}
+
+func TestBasePathPrefixesRoutes(t *testing.T) {
+	cfg := testConfig()
+	cfg.BasePath = "/api/v1"
+	t.Cleanup(func() { docs.SwaggerInfo.BasePath = "/" })
+	public, _ := SetUpRoutes(countries.NewService(nil, cfg, database.MySQL{}))
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/v1/health/live", http.StatusOK},
+		{http.MethodGet, "/health/live", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/swagger", http.StatusMovedPermanently},
+		{http.MethodGet, "/swagger", http.StatusNotFound},
+		// disabled, so refused before touching the DB
+		{http.MethodPost, "/api/v1/drop-tables", http.StatusForbidden},
+		{http.MethodPost, "/drop-tables", http.StatusNotFound},
+		{http.MethodGet, "/countries", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			public.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusMovedPermanently {
+				if loc := rec.Header().Get("Location"); loc != "/api/v1/swagger/index.html" {
+					t.Errorf("Location = %q, want the prefixed index", loc)
+				}
+			}
+		})
+	}
+
+	if docs.SwaggerInfo.BasePath != "/api/v1" {
+		t.Errorf("SwaggerInfo.BasePath = %q, want /api/v1", docs.SwaggerInfo.BasePath)
+	}
+}
+
+func TestMetricsScrape(t *testing.T) {
+	cfg := testConfig()
+	cfg.Metrics = true
+	public, _ := SetUpRoutes(countries.NewService(nil, cfg, database.MySQL{}))
+
+	for _, path := range []string{"/health/live", "/nowhere"} {
+		public.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	rec := httptest.NewRecorder()
+	public.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/health/live", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /health/live = %d, want 405", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	public.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`countryxchange_http_requests_total{method="GET",route="/health/live",status="200"}`,
+		// raw paths never become labels
+		`countryxchange_http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`countryxchange_http_requests_total{method="DELETE",route="unmatched",status="405"}`,
+		"# TYPE countryxchange_refreshes_total counter",
+		"# TYPE countryxchange_refresh_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape lacks %s", want)
+		}
+	}
+	if strings.Contains(body, "/nowhere") {
+		t.Error("scrape has the raw unmatched path as a label")
+	}
+
+	// without METRICS there's no endpoint
+	cfg = testConfig()
+	public, _ = SetUpRoutes(countries.NewService(nil, cfg, database.MySQL{}))
+	rec = httptest.NewRecorder()
+	public.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /metrics without METRICS = %d, want 404", rec.Code)
+	}
+}
+
+func TestObservabilityAuth(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tests := []struct {
+		auth             bool
+		path             string
+		withoutKey, with int
+	}{
+		{false, "/version", http.StatusOK, http.StatusOK},
+		{false, "/metrics", http.StatusOK, http.StatusOK},
+		// pool stats want the key whatever OBSERVABILITY_AUTH says
+		{false, "/debug/dbstats", http.StatusUnauthorized, http.StatusOK},
+		{true, "/version", http.StatusUnauthorized, http.StatusOK},
+		{true, "/metrics", http.StatusUnauthorized, http.StatusOK},
+		{true, "/debug/dbstats", http.StatusUnauthorized, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("auth=%t %s", tt.auth, tt.path), func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AdminAPIKey = "test-key"
+			cfg.ObservabilityAuth = tt.auth
+			cfg.Metrics = true
+			public, _ := SetUpRoutes(countries.NewService(db, cfg, database.SQLite{}))
+
+			rec := httptest.NewRecorder()
+			public.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.withoutKey {
+				t.Errorf("without a key: status = %d, want %d", rec.Code, tt.withoutKey)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-API-Key", "test-key")
+			rec = httptest.NewRecorder()
+			public.ServeHTTP(rec, req)
+			if rec.Code != tt.with {
+				t.Errorf("with the key: status = %d, want %d", rec.Code, tt.with)
+			}
+		})
+	}
+}
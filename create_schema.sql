@@ -9,10 +9,16 @@ CREATE TABLE IF NOT EXISTS countries (
   region VARCHAR(255),
   population BIGINT NOT NULL,
   currency_code VARCHAR(32),
+  currency_codes VARCHAR(255),
   exchange_rate DOUBLE,
   estimated_gdp DOUBLE,
   flag_url VARCHAR(512),
+  numeric_code VARCHAR(3),
+  source VARCHAR(16) NOT NULL DEFAULT 'refresh',
   last_refreshed_at DATETIME,
+  flag_ok BOOLEAN,
+  area DOUBLE,
+  currency_rates TEXT,
   UNIQUE KEY unique_name (name)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
 
@@ -22,3 +28,50 @@ CREATE TABLE IF NOT EXISTS metadata (
   meta_value VARCHAR(1024),
   updated_at DATETIME
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- Create audit log table (who triggered refreshes and destructive operations)
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  action VARCHAR(64) NOT NULL,
+  actor VARCHAR(255) NOT NULL,
+  target VARCHAR(255),
+  result VARCHAR(32) NOT NULL,
+  created_at DATETIME NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- Alternate country names (e.g. "USA") resolved by name lookups; seeded by the app
+CREATE TABLE IF NOT EXISTS aliases (
+  alias VARCHAR(255) PRIMARY KEY,
+  country_name VARCHAR(255) NOT NULL,
+  created_at DATETIME NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- Per-refresh snapshots used by GET /refreshes/diff
+CREATE TABLE IF NOT EXISTS refreshes (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  refreshed_at DATETIME NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE IF NOT EXISTS country_history (
+  refresh_id BIGINT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  capital VARCHAR(255),
+  region VARCHAR(255),
+  population BIGINT NOT NULL,
+  currency_code VARCHAR(32),
+  currency_codes VARCHAR(255),
+  exchange_rate DOUBLE,
+  estimated_gdp DOUBLE,
+  flag_url VARCHAR(512),
+  numeric_code VARCHAR(3),
+  PRIMARY KEY (refresh_id, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- Exchange rates captured by every refresh, for GET /countries/{name}/rates/history
+CREATE TABLE IF NOT EXISTS rate_history (
+  currency_code VARCHAR(32) NOT NULL,
+  captured_at DATETIME NOT NULL,
+  base VARCHAR(3) NOT NULL,
+  rate DOUBLE NOT NULL,
+  PRIMARY KEY (currency_code, captured_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type SwaggerConfig struct {
@@ -12,50 +16,527 @@ type SwaggerConfig struct {
 }
 
 type DBConfig struct {
+	// Driver is mysql (default) or sqlite; for sqlite Name is the database
+	// file (or :memory:) and the other connection fields are ignored
+	Driver   string
 	User     string
 	Password string
 	Host     string
 	Port     string
 	Name     string
+	// DeadlockRetries is how many times a transaction is retried after
+	// MySQL aborts it as a deadlock victim
+	DeadlockRetries int
+	// MaxConcurrentBulk caps refreshes and bulk writes running at once
+	// (0 = no cap); BulkWait is how long an extra one waits before a 503
+	MaxConcurrentBulk int
+	BulkWait          time.Duration
+	// PingTimeout bounds the DB ping behind /health and /status
+	PingTimeout time.Duration
+}
+
+// ServerConfig holds the http.Server timeouts. WriteTimeout bounds how long a
+// handler may take to write its response, so it must stay above
+// RefreshConfig.Timeout or a slow refresh would have its response cut off.
+type ServerConfig struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// HandlerTimeout cancels any request still running after this long and
+	// answers 503 (0 = off). Keep it between RefreshConfig.Timeout and
+	// WriteTimeout.
+	HandlerTimeout time.Duration
+	// CORSMaxAge is how long browsers may cache a preflight response
+	CORSMaxAge time.Duration
+	// GzipMinSize is the smallest response body that gets gzip-compressed
+	// (negative disables compression)
+	GzipMinSize int
+	// ShutdownGrace is how long a SIGINT/SIGTERM waits for in-flight
+	// requests and background image renders before the DB is closed
+	ShutdownGrace time.Duration
+}
+
+// RefreshConfig controls POST /countries/refresh
+type RefreshConfig struct {
+	// Timeout is the context deadline for the whole refresh (external
+	// fetches + DB writes), independent of the server write timeout
+	Timeout time.Duration
+	// MinPopulation skips countries with a smaller population (0 = keep all)
+	MinPopulation int64
+	// UseLastKnownRatesOnFailure reuses the stored rates when the rates feed
+	// is down instead of failing the refresh
+	UseLastKnownRatesOnFailure bool
+	// UpsertWorkers > 1 splits the write phase over that many concurrent
+	// transactions, committed only once all have written; a failure during
+	// the commits themselves can leave earlier partitions committed.
+	// 1 keeps the single transaction.
+	UpsertWorkers int
+	// HistoryKeep is how many refresh snapshots country_history retains
+	// (0 = all)
+	HistoryKeep int
+	// RateHistoryRetention is how long rate_history keeps captured rates
+	// (0 = forever)
+	RateHistoryRetention time.Duration
+	// PartialStatus is the HTTP status of a refresh that completed with
+	// reused rates: 200 (default) or 207
+	PartialStatus int
+}
+
+// ExternalConfig controls how the upstream APIs are consumed
+type ExternalConfig struct {
+	// Mode is "live" (the upstream APIs) or "fixtures" (read the same JSON
+	// payloads from CountriesFixture and RatesFixture for offline development)
+	Mode             string
+	CountriesFixture string
+	RatesFixture     string
+	// MaxRetryAfter is the longest upstream 429 Retry-After a fetch waits
+	// out before retrying once (0 = never wait, fail straight away)
+	MaxRetryAfter time.Duration
+	// StrictRateKeys drops rate entries whose key is not a 3-letter
+	// currency code instead of only logging them
+	StrictRateKeys bool
+	// Timeout bounds each upstream HTTP call; the caller's context (and so
+	// an aborted request) can still cancel it sooner
+	Timeout time.Duration
+	// RatesBase is the currency exchange rates (and so estimated_gdp) are
+	// quoted against; a refresh may override it with ?base=
+	RatesBase string
+	// RatesCacheTTL is how long a fetched rates feed is reused by later
+	// refreshes instead of calling the rates API again (0 = always fetch)
+	RatesCacheTTL time.Duration
+}
+
+// GDPConfig controls how estimated_gdp is computed during refresh
+type GDPConfig struct {
+	// EmptyCurrencyZero stores 0 instead of NULL for countries without a
+	// currency. NULL keeps them out of GDP sorts and charts.
+	EmptyCurrencyZero bool
+	// Unit is the unit estimated_gdp is stored and reported in: USD or
+	// USD_millions. Stored values are only rescaled by the next refresh or
+	// recompute-gdp run.
+	Unit string
+	// Multiplier, when > 0, replaces the random 1000-2000 factor so every
+	// refresh yields the same estimated_gdp for the same population and rate
+	Multiplier float64
+	// Seed seeds the random factor when Multiplier is unset, making the
+	// sequence reproducible (0 = a fixed default seed, never the clock)
+	Seed int64
+}
+
+type ImageConfig struct {
+	// Enabled turns the summary image feature on; it is also switched off at
+	// startup when the cache directory isn't writable
+	Enabled bool
+	// ShowCurrencyCounts renders a second column listing the most common currencies
+	ShowCurrencyCounts bool
+	// OutlierStdDevs drops countries whose estimated GDP is further than this
+	// many standard deviations from the mean before picking the top 5 (0 = off)
+	OutlierStdDevs float64
+	// HeaderFontSize and TextFontSize are the starting sizes; lines that
+	// don't fit are shrunk and then truncated
+	HeaderFontSize float64
+	TextFontSize   float64
+	// SyncWithRefresh renders the image before the refresh responds and
+	// reports the outcome, instead of rendering it in the background
+	SyncWithRefresh bool
+}
+
+// FlagConfig controls downloading flag images into the local cache
+type FlagConfig struct {
+	// PrefetchConcurrency bounds the number of flags downloaded at once
+	PrefetchConcurrency int
+	// Timeout applies to each individual flag download
+	Timeout time.Duration
+}
+
+// BackupConfig controls the scheduled CSV export of the countries table
+type BackupConfig struct {
+	// Interval between backups (0 = off)
+	Interval time.Duration
+	// Destination is a local directory (or file:// URL) backups are written to
+	Destination string
+	// Keep is how many backups are retained (0 = all)
+	Keep int
 }
 
 type Config struct {
-	AppEnv  string
-	Port    string
-	DB      DBConfig
-	Swagger SwaggerConfig
+	AppEnv string
+	Port   string
+	// AdminPort, when set, moves the admin, destructive and observability
+	// endpoints to a second listener on this port, off the public one
+	AdminPort string
+	// AllowDropTables enables POST /drop-tables outside production; it stays
+	// off unless explicitly set
+	AllowDropTables bool
+	// Metrics serves Prometheus metrics on /metrics (defaults to on outside
+	// production, like Swagger)
+	Metrics bool
+	// BasePath is an optional prefix (e.g. /api/v1) all routes are mounted under
+	BasePath string
+	// RateStaleAfter marks stored exchange rates older than this as stale
+	RateStaleAfter time.Duration
+	// NumbersAsStrings encodes exchange_rate/estimated_gdp as plain decimal
+	// strings by default (overridable per request with ?numbers=)
+	NumbersAsStrings bool
+	// CurrencySymbols adds currency_symbol to country responses
+	CurrencySymbols bool
+	// ListMaxRows caps an unpaged GET /countries (0 = no cap). Above it the
+	// request is rejected with 413 when ListOverflow is "reject", or the
+	// default page is served when it is "limit".
+	ListMaxRows  int
+	ListOverflow string
+	// ListEmptyStatus is the status of a GET /countries that matched
+	// nothing: 200 with [] (default) or 204 with no body
+	ListEmptyStatus int
+	// QueryLogSample logs one in every N list query debug lines (1 = all,
+	// 0 = none); error logs are unaffected
+	QueryLogSample int
+	// ExcludedFields are Country fields omitted from every public response
+	ExcludedFields []string
+	// AdminAPIKey guards admin and debug routes; they are disabled when empty
+	AdminAPIKey string
+	// AdminAllowedCIDRs further restricts admin and destructive routes to
+	// these networks (empty = no restriction)
+	AdminAllowedCIDRs []*net.IPNet
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For is believed
+	TrustedProxies []*net.IPNet
+	// ObservabilityAuth requires the admin API key on /version and /metrics
+	// (defaults to on in production); /debug/* always needs it
+	ObservabilityAuth bool
+	DB                DBConfig
+	Swagger           SwaggerConfig
+	Server            ServerConfig
+	Refresh           RefreshConfig
+	External          ExternalConfig
+	GDP               GDPConfig
+	Image             ImageConfig
+	Flags             FlagConfig
+	Backup            BackupConfig
+}
+
+// envLoader reads config from the environment, collecting every invalid or
+// missing variable so LoadConfig can report them together
+type envLoader struct {
+	errs []error
 }
 
-func LoadConfig() *Config {
+func (l *envLoader) fail(format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Errorf(format, args...))
+}
+
+func LoadConfig() (*Config, error) {
+	l := &envLoader{}
+	appEnv := l.getEnv("APP_ENV")
 	config := &Config{
-		Port: getEnv("PORT"),
+		Port:        l.getEnv("PORT"),
+		AdminPort:   getEnvDefault("ADMIN_PORT", ""),
+		AdminAPIKey: getEnvDefault("ADMIN_API_KEY", ""),
+		// comma-separated CIDRs or bare IPs
+		AdminAllowedCIDRs: l.getEnvCIDRs("ADMIN_ALLOWED_CIDRS"),
+		TrustedProxies:    l.getEnvCIDRs("TRUSTED_PROXIES"),
+		BasePath:          loadBasePath(),
+		RateStaleAfter:    l.getEnvDuration("RATE_STALE_AFTER", 24*time.Hour),
+		NumbersAsStrings:  l.getEnvBool("JSON_NUMBERS_AS_STRINGS", false),
+		CurrencySymbols:   l.getEnvBool("CURRENCY_SYMBOLS", true),
+		ListMaxRows:       l.getEnvInt("LIST_MAX_ROWS", 0),
+		QueryLogSample:    l.getEnvInt("LOG_QUERY_SAMPLE", 1),
+		ListOverflow:      l.loadListOverflow(),
+		ListEmptyStatus:   l.loadListEmptyStatus(),
 		DB: DBConfig{
-			User:     getEnv("DB_USER"),
-			Password: getEnv("DB_PASS"),
-			Host:     getEnv("DB_HOST"),
-			Port:     getEnv("DB_PORT"),
-			Name:     getEnv("DB_NAME"),
+			Driver:   l.loadDBDriver(),
+			User:     l.getEnv("DB_USER"),
+			Password: l.getEnv("DB_PASS"),
+			Host:     l.getEnv("DB_HOST"),
+			Port:     l.getEnv("DB_PORT"),
+			Name:     l.getEnv("DB_NAME"),
+			// retry transactions aborted as deadlock victims
+			DeadlockRetries:   l.getEnvInt("DB_DEADLOCK_RETRIES", 3),
+			MaxConcurrentBulk: l.getEnvInt("DB_MAX_CONCURRENT_BULK", 2),
+			BulkWait:          l.getEnvDuration("DB_BULK_WAIT", 0),
+			PingTimeout:       l.getEnvDuration("DB_PING_TIMEOUT", 2*time.Second),
+		},
+		Swagger: l.loadSwaggerConfig(),
+		Server: ServerConfig{
+			ReadTimeout:       l.getEnvDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+			ReadHeaderTimeout: l.getEnvDuration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+			WriteTimeout:      l.getEnvDuration("SERVER_WRITE_TIMEOUT", 60*time.Second),
+			IdleTimeout:       l.getEnvDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+			HandlerTimeout:    l.getEnvDuration("SERVER_HANDLER_TIMEOUT", 55*time.Second),
+			CORSMaxAge:        l.getEnvDuration("CORS_MAX_AGE", 600*time.Second),
+			GzipMinSize:       l.getEnvInt("GZIP_MIN_SIZE", 1024),
+			ShutdownGrace:     l.getEnvDuration("SERVER_SHUTDOWN_GRACE", 30*time.Second),
+		},
+		Refresh: RefreshConfig{
+			Timeout:                    l.getEnvDuration("REFRESH_TIMEOUT", 45*time.Second),
+			MinPopulation:              int64(l.getEnvInt("REFRESH_MIN_POPULATION", 0)),
+			UseLastKnownRatesOnFailure: l.getEnvBool("REFRESH_USE_LAST_KNOWN_RATES", false),
+			PartialStatus:              l.loadPartialStatus(),
+			UpsertWorkers:              l.getEnvInt("REFRESH_UPSERT_WORKERS", 1),
+			HistoryKeep:                l.getEnvInt("REFRESH_HISTORY_KEEP", 30),
+			RateHistoryRetention:       l.getEnvDuration("REFRESH_RATE_HISTORY_RETENTION", 90*24*time.Hour),
+		},
+		External: l.loadExternalConfig(),
+		GDP:      l.loadGDPConfig(),
+		Image: ImageConfig{
+			Enabled:            l.getEnvBool("IMAGE_ENABLED", true),
+			ShowCurrencyCounts: l.getEnvBool("IMAGE_SHOW_CURRENCY_COUNTS", false),
+			OutlierStdDevs:     l.getEnvFloat("IMAGE_OUTLIER_STDDEVS", 0),
+			HeaderFontSize:     l.getEnvFloat("IMAGE_HEADER_FONT_SIZE", 28),
+			TextFontSize:       l.getEnvFloat("IMAGE_TEXT_FONT_SIZE", 28),
+			SyncWithRefresh:    l.getEnvBool("IMAGE_SYNC_WITH_REFRESH", false),
 		},
-		Swagger: loadSwaggerConfig(),
-		AppEnv:  getEnv("APP_ENV"),
+		Flags: FlagConfig{
+			PrefetchConcurrency: l.getEnvInt("FLAG_PREFETCH_CONCURRENCY", 8),
+			Timeout:             l.getEnvDuration("FLAG_FETCH_TIMEOUT", 10*time.Second),
+		},
+		Backup: BackupConfig{
+			Interval:    l.getEnvDuration("BACKUP_INTERVAL", 0),
+			Destination: getEnvDefault("BACKUP_DESTINATION", "backups"),
+			Keep:        l.getEnvInt("BACKUP_KEEP", 7),
+		},
+		ObservabilityAuth: l.getEnvBool("OBSERVABILITY_AUTH", appEnv == "production"),
+		Metrics:           l.getEnvBool("METRICS_ENABLED", appEnv != "production"),
+		AllowDropTables:   l.getEnvBool("ALLOW_DROP_TABLES", false),
+		AppEnv:            appEnv,
+	}
+
+	config.ExcludedFields = l.loadExcludedFields()
+
+	if err := errors.Join(l.errs...); err != nil {
+		return nil, err
 	}
+	return config, nil
+}
 
-	return config
+// excludableFields are the Country response fields PUBLIC_EXCLUDED_FIELDS
+// may hide. Identity fields (id, name, population) always stay.
+var excludableFields = map[string]bool{
+	"capital":           true,
+	"region":            true,
+	"currency_code":     true,
+	"currency_codes":    true,
+	"currency_rates":    true,
+	"exchange_rate":     true,
+	"estimated_gdp":     true,
+	"flag_url":          true,
+	"numeric_code":      true,
+	"area":              true,
+	"source":            true,
+	"last_refreshed_at": true,
+	"rate_age_seconds":  true,
+	"rate_stale":        true,
+	"currency_symbol":   true,
+	// population_density is derived from area, so hiding area hides it too
+	"population_density": true,
 }
 
-func loadSwaggerConfig() SwaggerConfig {
-	host := getEnv("API_BASE")
-	schemes := getEnv("SWAGGER_SCHEMES")
+// loadExcludedFields reads PUBLIC_EXCLUDED_FIELDS, rejecting unknown or
+// non-excludable field names
+func (l *envLoader) loadExcludedFields() []string {
+	fields := getEnvList("PUBLIC_EXCLUDED_FIELDS")
+	for _, f := range fields {
+		if !excludableFields[f] {
+			l.fail("PUBLIC_EXCLUDED_FIELDS: %q cannot be excluded", f)
+		}
+	}
+	return fields
+}
+
+func (l *envLoader) loadSwaggerConfig() SwaggerConfig {
+	host := l.getEnv("API_BASE")
+	schemes := l.getEnv("SWAGGER_SCHEMES")
 	return SwaggerConfig{
 		Host:    host,
 		Schemes: strings.Split(schemes, ","),
 	}
 }
 
-func getEnv(key string) string {
+func (l *envLoader) loadGDPConfig() GDPConfig {
+	mode := getEnvDefault("GDP_EMPTY_CURRENCY", "null")
+	if mode != "null" && mode != "zero" {
+		l.fail("GDP_EMPTY_CURRENCY must be null or zero")
+	}
+	unit := getEnvDefault("GDP_UNIT", "USD")
+	if unit != "USD" && unit != "USD_millions" {
+		l.fail("GDP_UNIT must be USD or USD_millions")
+	}
+	mult := l.getEnvFloat("GDP_MULTIPLIER", 0)
+	if mult < 0 {
+		l.fail("GDP_MULTIPLIER must not be negative")
+	}
+	return GDPConfig{
+		EmptyCurrencyZero: mode == "zero",
+		Unit:              unit,
+		Multiplier:        mult,
+		Seed:              int64(l.getEnvInt("GDP_SEED", 0)),
+	}
+}
+
+func (l *envLoader) loadListOverflow() string {
+	mode := getEnvDefault("LIST_OVERFLOW", "limit")
+	if mode != "reject" && mode != "limit" {
+		l.fail("LIST_OVERFLOW must be reject or limit")
+	}
+	return mode
+}
+
+func (l *envLoader) loadDBDriver() string {
+	driver := getEnvDefault("DB_DRIVER", "mysql")
+	if driver != "mysql" && driver != "sqlite" {
+		l.fail("DB_DRIVER must be mysql or sqlite")
+	}
+	return driver
+}
+
+func (l *envLoader) loadPartialStatus() int {
+	status := l.getEnvInt("REFRESH_PARTIAL_STATUS", 200)
+	if status != 200 && status != 207 {
+		l.fail("REFRESH_PARTIAL_STATUS must be 200 or 207")
+	}
+	return status
+}
+
+func (l *envLoader) loadListEmptyStatus() int {
+	status := l.getEnvInt("LIST_EMPTY_STATUS", 200)
+	if status != 200 && status != 204 {
+		l.fail("LIST_EMPTY_STATUS must be 200 or 204")
+	}
+	return status
+}
+
+func (l *envLoader) loadExternalConfig() ExternalConfig {
+	mode := getEnvDefault("EXTERNAL_MODE", "live")
+	if mode != "live" && mode != "fixtures" {
+		l.fail("EXTERNAL_MODE must be live or fixtures")
+	}
+	base := strings.ToUpper(getEnvDefault("EXTERNAL_RATES_BASE", "USD"))
+	if len(base) != 3 || strings.Trim(base, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		l.fail("EXTERNAL_RATES_BASE must be a 3-letter currency code")
+	}
+	return ExternalConfig{
+		Mode:             mode,
+		CountriesFixture: getEnvDefault("EXTERNAL_COUNTRIES_FIXTURE", "fixtures/countries.json"),
+		RatesFixture:     getEnvDefault("EXTERNAL_RATES_FIXTURE", "fixtures/rates.json"),
+		MaxRetryAfter:    l.getEnvDuration("EXTERNAL_MAX_RETRY_AFTER", 0),
+		StrictRateKeys:   l.getEnvBool("STRICT_RATE_KEYS", false),
+		Timeout:          l.getEnvDuration("EXTERNAL_TIMEOUT", 20*time.Second),
+		RatesBase:        base,
+		RatesCacheTTL:    l.getEnvDuration("EXTERNAL_RATES_CACHE_TTL", time.Hour),
+	}
+}
+
+// loadBasePath normalizes BASE_PATH to "/prefix" form, or "" for the root
+func loadBasePath() string {
+	base := strings.Trim(getEnvDefault("BASE_PATH", ""), "/")
+	if base == "" {
+		return ""
+	}
+	return "/" + base
+}
+
+func (l *envLoader) getEnv(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	l.fail("%s is required", key)
+	return ""
+}
+
+// getEnvDefault returns the value of key or fallback when it is unset
+func getEnvDefault(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
+	return fallback
+}
 
-	panic(fmt.Sprintf("%s is required", key))
+func (l *envLoader) getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.fail("%s must be a boolean", key)
+		return fallback
+	}
+	return b
+}
+
+func (l *envLoader) getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		l.fail("%s must be an integer", key)
+		return fallback
+	}
+	return n
+}
+
+func (l *envLoader) getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		l.fail("%s must be a number", key)
+		return fallback
+	}
+	return f
+}
+
+// getEnvCIDRs parses a comma-separated list of CIDRs; bare IPs are treated
+// as single-host networks
+func (l *envLoader) getEnvCIDRs(key string) []*net.IPNet {
+	var out []*net.IPNet
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			l.fail("%s contains an invalid CIDR: %s", key, item)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// getEnvList splits a comma-separated variable into trimmed, lower-cased items
+func getEnvList(key string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func (l *envLoader) getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		l.fail("%s must be a duration (e.g. 30s)", key)
+		return fallback
+	}
+	return d
 }
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setRequiredEnv sets the variables LoadConfig can't do without
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	for k, v := range map[string]string{
+		"APP_ENV":         "test",
+		"PORT":            "8080",
+		"DB_USER":         "user",
+		"DB_PASS":         "pass",
+		"DB_HOST":         "localhost",
+		"DB_PORT":         "3306",
+		"DB_NAME":         "countries",
+		"API_BASE":        "localhost:8080",
+		"SWAGGER_SCHEMES": "http",
+	} {
+		t.Setenv(k, v)
+	}
+}
+
+func TestLoadConfigExcludedFields(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    []string
+		wantErr string
+	}{
+		{"", nil, ""},
+		{" Estimated_GDP, exchange_rate ,", []string{"estimated_gdp", "exchange_rate"}, ""},
+		{"estimated_gdp,gdp", nil, `"gdp" cannot be excluded`},
+		{"name", nil, `"name" cannot be excluded`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv("PUBLIC_EXCLUDED_FIELDS", tt.env)
+
+			cfg, err := LoadConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadConfig error = %v, want one mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if !reflect.DeepEqual(cfg.ExcludedFields, tt.want) {
+				t.Errorf("ExcludedFields = %q, want %q", cfg.ExcludedFields, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigReportsInvalidValues(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("DB_NAME", "")
+	t.Setenv("GDP_UNIT", "EUR")
+	t.Setenv("LIST_EMPTY_STATUS", "404")
+	t.Setenv("REFRESH_TIMEOUT", "soon")
+	t.Setenv("ADMIN_ALLOWED_CIDRS", "10.0.0.0/33")
+	t.Setenv("PUBLIC_EXCLUDED_FIELDS", "name")
+
+	cfg, err := LoadConfig()
+	if err == nil {
+		t.Fatalf("LoadConfig = %+v, want an error", cfg)
+	}
+	for _, want := range []string{
+		"DB_NAME is required",
+		"GDP_UNIT must be USD or USD_millions",
+		"LIST_EMPTY_STATUS must be 200 or 204",
+		"REFRESH_TIMEOUT must be a duration",
+		"ADMIN_ALLOWED_CIDRS contains an invalid CIDR",
+		`"name" cannot be excluded`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestLoadBasePath(t *testing.T) {
+	tests := []struct{ env, want string }{
+		{"", ""},
+		{"/", ""},
+		{"api/v1", "/api/v1"},
+		{"/api/v1/", "/api/v1"},
+		{"//api//", "/api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("BASE_PATH", tt.env)
+			if got := loadBasePath(); got != tt.want {
+				t.Errorf("loadBasePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// seedAliases maps common alternate names to the names restcountries uses
+var seedAliases = map[string]string{
+	"USA":            "United States of America",
+	"US":             "United States of America",
+	"United States":  "United States of America",
+	"America":        "United States of America",
+	"UK":             "United Kingdom of Great Britain and Northern Ireland",
+	"United Kingdom": "United Kingdom of Great Britain and Northern Ireland",
+	"Great Britain":  "United Kingdom of Great Britain and Northern Ireland",
+	"Britain":        "United Kingdom of Great Britain and Northern Ireland",
+	"Russia":         "Russian Federation",
+	"South Korea":    "Korea (Republic of)",
+	"North Korea":    "Korea (Democratic People's Republic of)",
+	"Iran":           "Iran (Islamic Republic of)",
+	"Vietnam":        "Viet Nam",
+	"Bolivia":        "Bolivia (Plurinational State of)",
+	"Venezuela":      "Venezuela (Bolivarian Republic of)",
+	"Tanzania":       "Tanzania, United Republic of",
+	"Syria":          "Syrian Arab Republic",
+	"Laos":           "Lao People's Democratic Republic",
+	"DRC":            "Congo (Democratic Republic of the)",
+	"DR Congo":       "Congo (Democratic Republic of the)",
+	"Moldova":        "Moldova (Republic of)",
+	"Czechia":        "Czech Republic",
+}
+
+// ensureAliases creates the aliases table and inserts any missing seed
+// aliases without overwriting ones an admin has re-pointed
+func (s *Service) ensureAliases() error {
+	create := `
+    CREATE TABLE IF NOT EXISTS aliases (
+        alias VARCHAR(255) PRIMARY KEY,
+        country_name VARCHAR(255) NOT NULL,
+        created_at DATETIME NOT NULL
+    );`
+	if _, err := s.DB.Exec(create); err != nil {
+		logger.Error("repo: create aliases table failed", logger.WithError(err))
+		return err
+	}
+
+	now := time.Now().UTC()
+	for alias, name := range seedAliases {
+		if _, err := s.DB.Exec(s.Dialect.InsertIgnore()+` INTO aliases (alias, country_name, created_at) VALUES (?, ?, ?)`, alias, name, now); err != nil {
+			logger.Error("repo: seed alias failed", logger.Fields{"alias": alias}, logger.WithError(err))
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveAlias returns the canonical country name for alias, or ErrNotFound
+func (s *Service) resolveAlias(ctx context.Context, alias string) (string, error) {
+	var name string
+	err := s.DB.QueryRowContext(ctx, `SELECT country_name FROM aliases WHERE LOWER(alias) = LOWER(?)`, alias).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// AddAliases points every alias at the canonical country name, replacing any
+// previous target, and returns the trimmed, de-duplicated aliases stored
+func (s *Service) AddAliases(name string, aliases []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+	now := time.Now().UTC()
+	for _, a := range aliases {
+		a = strings.TrimSpace(a)
+		if a == "" || strings.EqualFold(a, name) || seen[strings.ToLower(a)] {
+			continue
+		}
+		seen[strings.ToLower(a)] = true
+		q := `INSERT INTO aliases (alias, country_name, created_at) VALUES (?, ?, ?) ` +
+			s.Dialect.Upsert([]string{"alias"}, "country_name")
+		if _, err := s.DB.Exec(q, a, name, now); err != nil {
+			logger.Error("repo: AddAliases failed", logger.Fields{"alias": a, "name": name}, logger.WithError(err))
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	logger.Info("repo: AddAliases complete", logger.Fields{"name": name, "count": len(out)})
+	return out, nil
+}
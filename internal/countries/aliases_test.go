@@ -0,0 +1,158 @@
+package countries
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const usa = "United States of America"
+
+func TestGetByNameResolvesAlias(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry(usa, "Americas", "USD", 330, 1),
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+	)
+
+	tests := []struct {
+		lookup, want string
+		wantErr      error
+	}{
+		{usa, usa, nil},
+		{"united states of america", usa, nil},
+		// seeded aliases, matched case-insensitively
+		{"USA", usa, nil},
+		{"usa", usa, nil},
+		{"America", usa, nil},
+		// an alias whose country isn't stored
+		{"Russia", "", ErrNotFound},
+		{"Atlantis", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lookup, func(t *testing.T) {
+			c, err := svc.GetByName(context.Background(), tt.lookup)
+			if err != tt.wantErr {
+				t.Fatalf("GetByName(%q) error = %v, want %v", tt.lookup, err, tt.wantErr)
+			}
+			if err == nil && c.Name != tt.want {
+				t.Errorf("GetByName(%q) = %q, want %q", tt.lookup, c.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureAliasesKeepsRepointed(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	if _, err := svc.AddAliases("Ghana", []string{"America"}); err != nil {
+		t.Fatalf("AddAliases: %v", err)
+	}
+
+	// a restart re-seeds without undoing the admin's change
+	if err := svc.ensureAliases(); err != nil {
+		t.Fatalf("ensureAliases: %v", err)
+	}
+	if name, err := svc.resolveAlias(context.Background(), "america"); err != nil || name != "Ghana" {
+		t.Errorf("resolveAlias(america) = %q, %v; want Ghana", name, err)
+	}
+	if name, err := svc.resolveAlias(context.Background(), "USA"); err != nil || name != usa {
+		t.Errorf("resolveAlias(USA) = %q, %v; want the seed", name, err)
+	}
+}
+
+func TestAddAliases(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+
+	added, err := svc.AddAliases("Ghana", []string{" Gold Coast ", "", "gold coast", "ghana", "GH"})
+	if err != nil {
+		t.Fatalf("AddAliases: %v", err)
+	}
+	// trimmed, de-duplicated, and never the name itself
+	if want := []string{"Gold Coast", "GH"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("AddAliases = %v, want %v", added, want)
+	}
+	for _, alias := range []string{"GOLD COAST", "gh"} {
+		if c, err := svc.GetByName(context.Background(), alias); err != nil || c.Name != "Ghana" {
+			t.Errorf("GetByName(%q) = %v, %v; want Ghana", alias, c, err)
+		}
+	}
+}
+
+func TestAliasRoutes(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry(usa, "Americas", "USD", 330, 1),
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+	)
+	r := newTestRouter(svc)
+
+	add := func(name, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/countries/"+name+"/aliases", strings.NewReader(body))
+		req.Header.Set("X-API-Key", testAPIKey)
+		return serve(r, req)
+	}
+
+	// the target may itself be given by alias; the canonical name is stored
+	rec := add("USA", `{"aliases":["The States"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST aliases: status = %d (%s)", rec.Code, rec.Body)
+	}
+	var body struct {
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Name != usa || !reflect.DeepEqual(body.Aliases, []string{"The States"}) {
+		t.Errorf("response = %+v", body)
+	}
+
+	rec = serve(r, httptest.NewRequest(http.MethodGet, "/countries/the%20states", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"`+usa+`"`) {
+		t.Errorf("GET by the new alias: status = %d (%s)", rec.Code, rec.Body)
+	}
+
+	if rec := add("Atlantis", `{"aliases":["Lost City"]}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown country: status = %d, want 404", rec.Code)
+	}
+	if rec := add("Ghana", `{"aliases":[]}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("no aliases: status = %d, want 422", rec.Code)
+	}
+}
+
+func TestSearchMatchesAliases(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry(usa, "Americas", "USD", 330, 1),
+		testCountry("Russian Federation", "Europe", "RUB", 144, 90),
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+	)
+
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"usa", []string{usa}},
+		{"russ", []string{"Russian Federation"}},
+		// matched by name and by alias, listed once
+		{"america", []string{usa}},
+		{"ghana", []string{"Ghana"}},
+		{"nowhere", []string{}},
+	}
+	for _, tt := range tests {
+		list, err := svc.SearchCountries(context.Background(), tt.q, false, 20)
+		if err != nil {
+			t.Fatalf("SearchCountries(%q): %v", tt.q, err)
+		}
+		if got := names(list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchCountries(%q) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
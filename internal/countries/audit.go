@@ -0,0 +1,76 @@
+package countries
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/api"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// audited actions
+const (
+	AuditRefresh      = "refresh"
+	AuditDelete       = "delete"
+	AuditDropTables   = "drop_tables"
+	AuditResetRefresh = "reset_last_refreshed"
+	AuditFlagPrefetch = "flag_prefetch"
+	AuditRecomputeGDP = "recompute_gdp"
+	AuditAddAliases   = "add_aliases"
+	AuditMigrate      = "migrate"
+	AuditCreate       = "create"
+	AuditRatesRefresh = "rates_refresh"
+	AuditUpdate       = "update"
+)
+
+// AuditEntry is a single row of the audit log
+type AuditEntry struct {
+	ID        int64    `json:"id"`
+	Action    string   `json:"action"`
+	Actor     string   `json:"actor"`
+	Target    *string  `json:"target,omitempty"`
+	Result    string   `json:"result"`
+	CreatedAt api.Time `json:"created_at"`
+}
+
+// RecordAudit appends an entry to the audit log. Failures are logged and
+// returned but callers treat auditing as best-effort.
+func (s *Service) RecordAudit(action, actor, target, result string) error {
+	q := `INSERT INTO audit_log (action, actor, target, result, created_at) VALUES (?, ?, ?, ?, ?)`
+	var t sql.NullString
+	if target != "" {
+		t = sql.NullString{String: target, Valid: true}
+	}
+	if _, err := s.DB.Exec(q, action, actor, t, result, time.Now().UTC()); err != nil {
+		logger.Error("repo: RecordAudit failed", logger.Fields{"action": action, "actor": actor}, logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+// ListAudit returns audit entries, newest first
+func (s *Service) ListAudit(limit, offset int) ([]AuditEntry, error) {
+	q := `SELECT id, action, actor, target, result, created_at FROM audit_log ORDER BY id DESC LIMIT ? OFFSET ?`
+	rows, err := s.DB.Query(q, limit, offset)
+	if err != nil {
+		logger.Error("repo: ListAudit query failed", logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var target sql.NullString
+		if err := rows.Scan(&e.ID, &e.Action, &e.Actor, &target, &e.Result, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if target.Valid {
+			e.Target = &target.String
+		}
+		out = append(out, e)
+	}
+
+	logger.Info("repo: ListAudit complete", logger.Fields{"count": len(out)})
+	return out, nil
+}
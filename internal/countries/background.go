@@ -0,0 +1,31 @@
+package countries
+
+import "context"
+
+// goBackground runs fn in a goroutine tracked by WaitBackground. Background
+// work outlives the request that started it (summary images rendered after
+// a refresh or by an image job), so shutdown waits for it instead of
+// leaving a half-written file.
+func (s *Service) goBackground(fn func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+}
+
+// WaitBackground blocks until background work has finished or ctx is done,
+// returning ctx.Err() in the latter case
+func (s *Service) WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
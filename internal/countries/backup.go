@@ -0,0 +1,177 @@
+package countries
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// backup files are named backupPrefix + UTC timestamp + backupExt so they
+// sort chronologically by name
+const (
+	backupPrefix     = "countries-"
+	backupExt        = ".csv"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+// BackupStore is a destination for country snapshots. Only LocalStore ships
+// today; an S3-compatible store would implement the same three calls.
+type BackupStore interface {
+	// Put stores the content of r under name
+	Put(ctx context.Context, name string, r io.Reader) error
+	// List returns the names of stored backups
+	List(ctx context.Context) ([]string, error)
+	// Delete removes one stored backup
+	Delete(ctx context.Context, name string) error
+}
+
+// LocalStore keeps backups as files in Dir
+type LocalStore struct {
+	Dir string
+}
+
+func (s LocalStore) Put(_ context.Context, name string, r io.Reader) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	// write under a temp name so a crash never leaves a truncated backup
+	// that looks complete
+	tmp, err := os.CreateTemp(s.Dir, ".tmp-"+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.Dir, name))
+}
+
+func (s LocalStore) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s LocalStore) Delete(_ context.Context, name string) error {
+	return os.Remove(filepath.Join(s.Dir, name))
+}
+
+// newBackupStore returns the store for cfg.Destination, a local directory
+// or file:// URL
+func newBackupStore(cfg *config.BackupConfig) (BackupStore, error) {
+	dest := cfg.Destination
+	if strings.Contains(dest, "://") {
+		if !strings.HasPrefix(dest, "file://") {
+			return nil, fmt.Errorf("unsupported backup destination %q (only local paths are supported)", dest)
+		}
+		dest = strings.TrimPrefix(dest, "file://")
+	}
+	return LocalStore{Dir: dest}, nil
+}
+
+// RunBackups exports the countries table to the configured destination
+// every cfg.Interval until ctx is done. It returns at once when backups are
+// off (Interval 0).
+func (s *Service) RunBackups(ctx context.Context) {
+	cfg := &s.Config.Backup
+	if cfg.Interval <= 0 {
+		return
+	}
+	store, err := newBackupStore(cfg)
+	if err != nil {
+		logger.Error("backup: disabled", logger.WithError(err))
+		return
+	}
+	logger.Info("backup: scheduled", logger.Fields{"interval": cfg.Interval.String(), "destination": cfg.Destination, "keep": cfg.Keep})
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			name, n, err := s.Backup(ctx, store, t, cfg.Keep)
+			if err != nil {
+				logger.Error("backup: snapshot failed", logger.WithError(err))
+				continue
+			}
+			logger.Info("backup: snapshot written", logger.Fields{"file": name, "countries": n})
+		}
+	}
+}
+
+// Backup writes every country to store as a CSV named after t, then prunes
+// the oldest backups beyond keep (0 keeps all). It returns the file name and
+// the number of countries written.
+func (s *Service) Backup(ctx context.Context, store BackupStore, t time.Time, keep int) (string, int, error) {
+	list, err := s.GetAll(ctx, ListFilter{})
+	if err != nil {
+		return "", 0, err
+	}
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, list, allCountryColumns); err != nil {
+		return "", 0, err
+	}
+
+	name := backupPrefix + t.UTC().Format(backupTimeFormat) + backupExt
+	if err := store.Put(ctx, name, &buf); err != nil {
+		return "", 0, err
+	}
+	if keep > 0 {
+		if err := pruneBackups(ctx, store, keep); err != nil {
+			// the new backup is safe; a failed prune is retried next time
+			logger.Warn("backup: prune failed", logger.WithError(err))
+		}
+	}
+	return name, len(list), nil
+}
+
+// pruneBackups deletes all but the newest keep backups, leaving files that
+// weren't written by Backup alone
+func pruneBackups(ctx context.Context, store BackupStore, keep int) error {
+	names, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	var ours []string
+	for _, n := range names {
+		if strings.HasPrefix(n, backupPrefix) && strings.HasSuffix(n, backupExt) {
+			ours = append(ours, n)
+		}
+	}
+	sort.Strings(ours)
+	for len(ours) > keep {
+		if err := store.Delete(ctx, ours[0]); err != nil {
+			return err
+		}
+		logger.Info("backup: pruned", logger.Fields{"file": ours[0]})
+		ours = ours[1:]
+	}
+	return nil
+}
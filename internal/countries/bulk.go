@@ -0,0 +1,63 @@
+package countries
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// ErrBusy is returned when too many bulk operations already hold a slot
+var ErrBusy = errors.New("too many concurrent bulk operations")
+
+// bulkLimiter caps how many transaction-heavy operations (refresh, bulk
+// writes) run at once so they can't pile large transactions onto MySQL
+type bulkLimiter struct {
+	once  sync.Once
+	slots chan struct{}
+}
+
+// acquire takes a slot, waiting up to cfg.BulkWait (0 = fail fast). The
+// returned func releases it. A MaxConcurrentBulk of 0 disables the cap.
+func (l *bulkLimiter) acquire(ctx context.Context, cfg *config.DBConfig) (func(), error) {
+	if cfg.MaxConcurrentBulk <= 0 {
+		return func() {}, nil
+	}
+	l.once.Do(func() { l.slots = make(chan struct{}, cfg.MaxConcurrentBulk) })
+	release := func() { <-l.slots }
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if cfg.BulkWait <= 0 {
+		logger.Warn("service: bulk operation rejected, all slots busy", logger.Fields{"max": cfg.MaxConcurrentBulk})
+		return nil, ErrBusy
+	}
+
+	timer := time.NewTimer(cfg.BulkWait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		logger.Warn("service: bulk operation timed out waiting for a slot", logger.Fields{"max": cfg.MaxConcurrentBulk, "wait": cfg.BulkWait.String()})
+		return nil, ErrBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// BulkDelete runs DeleteByNames under the bulk operation cap
+func (s *Service) BulkDelete(ctx context.Context, names []string) (deleted, notFound []string, err error) {
+	release, err := s.bulkOps.acquire(ctx, &s.Config.DB)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	return s.DeleteByNames(ctx, names)
+}
@@ -0,0 +1,55 @@
+package countries
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBulkCapRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		wait time.Duration
+	}{
+		{"fail fast", 0},
+		{"after waiting", 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t)
+			svc.Config.DB.MaxConcurrentBulk = 1
+			svc.Config.DB.BulkWait = tt.wait
+			seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+			r := newTestRouter(svc)
+			bulkDelete := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodDelete, "/countries", strings.NewReader(`{"names":["Ghana"]}`))
+				req.Header.Set("X-API-Key", testAPIKey)
+				return serve(r, req)
+			}
+
+			// another bulk operation holds the only slot
+			release, err := svc.bulkOps.acquire(context.Background(), &svc.Config.DB)
+			if err != nil {
+				t.Fatalf("acquire: %v", err)
+			}
+			rec := bulkDelete()
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("over the cap: status = %d, want 503 (%s)", rec.Code, rec.Body)
+			}
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("no Retry-After on a busy response")
+			}
+			if _, err := svc.GetByName(context.Background(), "Ghana"); err != nil {
+				t.Errorf("Ghana after a rejected delete: %v", err)
+			}
+
+			release()
+			if rec := bulkDelete(); rec.Code != http.StatusOK {
+				t.Errorf("after release: status = %d, want 200 (%s)", rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package countries
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// ListVersion is a cheap probe of the countries table, compared instead of
+// the payload to answer conditional GETs
+type ListVersion struct {
+	Count int64
+	MaxID int64
+	// Modified is the latest of the last refresh and any row's
+	// last_refreshed_at (zero when nothing was ever stored)
+	Modified time.Time
+	// checksum covers the columns changed without touching
+	// last_refreshed_at (recompute-gdp and flag checks)
+	checksum string
+}
+
+// GetListVersion reads the row count, highest id and checksums in one
+// query, plus the newest row change and the last refresh timestamp
+func (s *Service) GetListVersion() (*ListVersion, error) {
+	q := `SELECT COUNT(*), COALESCE(MAX(id), 0),
+        COALESCE(SUM(estimated_gdp), 0), COALESCE(SUM(CASE WHEN flag_ok THEN 1 ELSE 0 END), 0)
+        FROM countries`
+	var (
+		v        ListVersion
+		last     sql.NullTime
+		gdpSum   float64
+		flagsSum int64
+	)
+	if err := s.DB.QueryRow(q).Scan(&v.Count, &v.MaxID, &gdpSum, &flagsSum); err != nil {
+		logger.Error("repo: GetListVersion failed", logger.WithError(err))
+		return nil, err
+	}
+	// the column itself rather than MAX(): SQLite returns an aggregate of a
+	// DATETIME as text, which doesn't scan into a time
+	err := s.DB.QueryRow(`SELECT last_refreshed_at FROM countries WHERE last_refreshed_at IS NOT NULL
+        ORDER BY last_refreshed_at DESC LIMIT 1`).Scan(&last)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Error("repo: GetListVersion failed", logger.WithError(err))
+		return nil, err
+	}
+	refreshed, err := s.GetLastRefreshed()
+	if err != nil {
+		return nil, err
+	}
+	if last.Valid {
+		v.Modified = last.Time
+	}
+	if refreshed != nil && refreshed.After(v.Modified) {
+		v.Modified = *refreshed
+	}
+	v.Modified = v.Modified.UTC().Truncate(time.Second)
+	v.checksum = fmt.Sprintf("%g:%d", gdpSum, flagsSum)
+	return &v, nil
+}
+
+// ETag is a weak validator: equal versions serve equivalent lists, though
+// computed fields such as rate_age_seconds may differ
+func (v *ListVersion) ETag() string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%d:%d:%s", v.Count, v.MaxID, v.Modified.UnixNano(), v.checksum)
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// writeConditional sets ETag and Last-Modified for v and answers 304 when
+// the request's If-None-Match (or, without one, If-Modified-Since) shows
+// the client already has this version. It returns true when it did.
+func writeConditional(w http.ResponseWriter, req *http.Request, v *ListVersion) bool {
+	etag := v.ETag()
+	w.Header().Set("ETag", etag)
+	if !v.Modified.IsZero() {
+		w.Header().Set("Last-Modified", v.Modified.Format(http.TimeFormat))
+	}
+
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else if ims := req.Header.Get("If-Modified-Since"); ims != "" && !v.Modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil || v.Modified.After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches applies the weak comparison of If-None-Match
+func etagMatches(header, etag string) bool {
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
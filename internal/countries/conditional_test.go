@@ -0,0 +1,69 @@
+package countries
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListConditionalGET(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	r := newTestRouter(svc)
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/countries", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		return serve(r, req)
+	}
+
+	first := get("", "")
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("first GET = %d with ETag %q, Last-Modified %q", first.Code, etag, lastModified)
+	}
+	if want := "Thu, 02 Jan 2025 03:04:05 GMT"; lastModified != want {
+		t.Errorf("Last-Modified = %q, want the row's last_refreshed_at %q", lastModified, want)
+	}
+	modified, _ := http.ParseTime(lastModified)
+
+	tests := []struct {
+		name, header, value string
+		want                int
+	}{
+		{"matching ETag", "If-None-Match", etag, http.StatusNotModified},
+		{"matching strong form", "If-None-Match", etag[2:], http.StatusNotModified},
+		{"one of several", "If-None-Match", `"old", ` + etag, http.StatusNotModified},
+		{"other ETag", "If-None-Match", `W/"old"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", lastModified, http.StatusNotModified},
+		{"modified since", "If-Modified-Since", modified.Add(-time.Second).Format(http.TimeFormat), http.StatusOK},
+		{"unparseable date", "If-Modified-Since", "yesterday", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.header, tt.value)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 has a body: %q", rec.Body)
+			}
+			if got := rec.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+		})
+	}
+
+	// a new row changes the version, so the old ETag no longer matches
+	seed(t, svc, testCountry("Togo", "Africa", "XOF", 8, 600))
+	rec := get("If-None-Match", etag)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("after a change: status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("ETag"); got == etag {
+		t.Errorf("ETag unchanged after a new row")
+	}
+}
@@ -0,0 +1,61 @@
+package countries
+
+// currencySymbols maps common ISO 4217 codes to their display symbol
+var currencySymbols = map[string]string{
+	"AED": "د.إ",
+	"ARS": "$",
+	"AUD": "$",
+	"BDT": "৳",
+	"BRL": "R$",
+	"CAD": "$",
+	"CHF": "Fr",
+	"CLP": "$",
+	"CNY": "¥",
+	"COP": "$",
+	"CZK": "Kč",
+	"DKK": "kr",
+	"EGP": "£",
+	"EUR": "€",
+	"GBP": "£",
+	"GHS": "₵",
+	"HKD": "$",
+	"HUF": "Ft",
+	"IDR": "Rp",
+	"ILS": "₪",
+	"INR": "₹",
+	"JPY": "¥",
+	"KES": "Sh",
+	"KRW": "₩",
+	"MAD": "د.م.",
+	"MXN": "$",
+	"MYR": "RM",
+	"NGN": "₦",
+	"NOK": "kr",
+	"NZD": "$",
+	"PHP": "₱",
+	"PKR": "₨",
+	"PLN": "zł",
+	"RUB": "₽",
+	"SAR": "ر.س",
+	"SEK": "kr",
+	"SGD": "$",
+	"THB": "฿",
+	"TRY": "₺",
+	"TWD": "$",
+	"UAH": "₴",
+	"USD": "$",
+	"VND": "₫",
+	"XAF": "Fr",
+	"XOF": "Fr",
+	"ZAR": "R",
+}
+
+// annotateCurrencySymbol sets the display symbol of c's currency when known
+func annotateCurrencySymbol(c *Country) {
+	if c.CurrencyCode == nil {
+		return
+	}
+	if sym, ok := currencySymbols[*c.CurrencyCode]; ok {
+		c.CurrencySymbol = &sym
+	}
+}
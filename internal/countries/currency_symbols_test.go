@@ -0,0 +1,79 @@
+package countries
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnnotateCurrencySymbol(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		want     string
+	}{
+		{"known", "GHS", "₵"},
+		{"shared symbol", "EUR", "€"},
+		{"unknown", "XYZ", ""},
+		{"no currency", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCountry("Ghana", "Africa", tt.currency, 30, 15)
+			if tt.currency == "" {
+				c.CurrencyCode = nil
+			}
+			annotateCurrencySymbol(c)
+			got := ""
+			if c.CurrencySymbol != nil {
+				got = *c.CurrencySymbol
+			}
+			if got != tt.want {
+				t.Errorf("symbol = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrencySymbolInResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		country string
+		want    string
+	}{
+		{"known", true, "Ghana", "₵"},
+		{"unknown", true, "Atlantis", ""},
+		{"disabled", false, "Ghana", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t)
+			svc.Config.CurrencySymbols = tt.enabled
+			seed(t, svc,
+				testCountry("Ghana", "Africa", "GHS", 30, 15),
+				testCountry("Atlantis", "Oceania", "ATL", 1, 2),
+			)
+
+			rec := serve(newTestRouter(svc), httptest.NewRequest(http.MethodGet, "/countries/"+tt.country, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			sym, ok := body["currency_symbol"]
+			if tt.want == "" {
+				if ok {
+					t.Errorf("currency_symbol = %v, want it omitted", sym)
+				}
+				return
+			}
+			if sym != tt.want {
+				t.Errorf("currency_symbol = %v, want %q", sym, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package countries
+
+import (
+	"context"
+	"strings"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// FieldChange holds the stored and upstream values of a single field
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// CountryDiff describes how an upstream country differs from the stored row
+type CountryDiff struct {
+	Name    string                 `json:"name"`
+	Status  string                 `json:"status"` // "changed" or "new"; refresh diffs use "appeared", "disappeared", "changed"
+	Changes map[string]FieldChange `json:"changes,omitempty"`
+}
+
+// DiffResult summarizes a read-only comparison against upstream
+type DiffResult struct {
+	Compared     int           `json:"compared"`
+	TotalChanged int           `json:"total_changed"`
+	Truncated    bool          `json:"truncated"`
+	Countries    []CountryDiff `json:"countries"`
+}
+
+// Diff fetches fresh upstream data and compares it with the stored rows
+// without writing anything. estimated_gdp is ignored since it is randomized
+// on every refresh. At most limit differences are returned.
+func (s *Service) Diff(ctx context.Context, region string, limit int) (*DiffResult, error) {
+	logger.Info("service: Diff started", logger.Fields{"region": region, "limit": limit})
+	cfg := s.Config
+
+	rc, err := s.fetchCountries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// compare rates quoted against the base the stored rows use
+	base, err := s.GetRatesBase()
+	if err != nil {
+		return nil, err
+	}
+	rr, err := s.fetchRates(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+
+	var upstream []*Country
+	var names []string
+	now := s.Now().UTC()
+	for _, rcountry := range rc {
+		if rcountry.Name == "" {
+			continue
+		}
+		if region != "" && !strings.EqualFold(rcountry.Region, region) {
+			continue
+		}
+		// rand is only used for estimated_gdp, which is not compared
+		c := buildCountry(rcountry, rr.Rates, nil, now, &cfg.GDP)
+		upstream = append(upstream, c)
+		names = append(names, c.Name)
+	}
+
+	stored, err := s.GetByNames(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &DiffResult{Compared: len(upstream), Countries: []CountryDiff{}}
+	for _, c := range upstream {
+		var d CountryDiff
+		old, ok := stored[strings.ToLower(c.Name)]
+		if !ok {
+			d = CountryDiff{Name: c.Name, Status: "new"}
+		} else {
+			changes := diffCountry(old, c)
+			if len(changes) == 0 {
+				continue
+			}
+			d = CountryDiff{Name: c.Name, Status: "changed", Changes: changes}
+		}
+
+		res.TotalChanged++
+		if len(res.Countries) >= limit {
+			res.Truncated = true
+			continue
+		}
+		res.Countries = append(res.Countries, d)
+	}
+
+	logger.Info("service: Diff completed", logger.Fields{"compared": res.Compared, "total_changed": res.TotalChanged})
+	return res, nil
+}
+
+// diffCountry returns the fields whose values differ between old and new
+func diffCountry(old, new *Country) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	diffString := func(field string, a, b *string) {
+		if derefString(a) != derefString(b) {
+			changes[field] = FieldChange{Old: a, New: b}
+		}
+	}
+	diffFloat := func(field string, a, b *float64) {
+		if (a == nil) != (b == nil) || (a != nil && *a != *b) {
+			changes[field] = FieldChange{Old: a, New: b}
+		}
+	}
+
+	diffString("capital", old.Capital, new.Capital)
+	diffString("region", old.Region, new.Region)
+	diffString("currency_code", old.CurrencyCode, new.CurrencyCode)
+	if a, b := strings.Join(old.CurrencyCodes, ","), strings.Join(new.CurrencyCodes, ","); a != b {
+		changes["currency_codes"] = FieldChange{Old: old.CurrencyCodes, New: new.CurrencyCodes}
+	}
+	diffString("flag_url", old.FlagURL, new.FlagURL)
+	diffString("numeric_code", old.NumericCode, new.NumericCode)
+	diffFloat("exchange_rate", old.ExchangeRate, new.ExchangeRate)
+	diffFloat("area", old.Area, new.Area)
+	if old.Population != new.Population {
+		changes["population"] = FieldChange{Old: old.Population, New: new.Population}
+	}
+	return changes
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,86 @@
+package countries
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/zjoart/countryxchange/pkg/api"
+)
+
+// countryCSV writes countries as CSV with a header row of cols (stored
+// country columns). Nulls are written as empty cells and timestamps as
+// RFC3339. Rows go out through csv.Writer's small buffer, so a response
+// streams rather than being built in memory.
+type countryCSV struct {
+	cw     *csv.Writer
+	cols   []string
+	record []string
+}
+
+// newCountryCSV writes the header row to w
+func newCountryCSV(w io.Writer, cols []string) (*countryCSV, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cols); err != nil {
+		return nil, err
+	}
+	return &countryCSV{cw: cw, cols: cols, record: make([]string, len(cols))}, nil
+}
+
+// write adds the row of c
+func (c *countryCSV) write(country *Country) error {
+	for j, col := range c.cols {
+		c.record[j] = csvValue(countryField(country, col, true))
+	}
+	return c.cw.Write(c.record)
+}
+
+// flush writes out any buffered rows
+func (c *countryCSV) flush() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+// writeCSV writes list as CSV with a header row of cols
+func writeCSV(w io.Writer, list []Country, cols []string) error {
+	out, err := newCountryCSV(w, cols)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if err := out.write(&list[i]); err != nil {
+			return err
+		}
+	}
+	return out.flush()
+}
+
+// csvValue formats one countryField value as a CSV cell; floats arrive
+// already formatted since writeCSV asks countryField for strings
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	case *string:
+		if v != nil {
+			return *v
+		}
+	case []string:
+		return strings.Join(v, ",")
+	case map[string]string:
+		// currency_rates, as the JSON object it is stored as
+		if v != nil {
+			b, _ := json.Marshal(v)
+			return string(b)
+		}
+	case *api.Time:
+		if v != nil {
+			return v.String()
+		}
+	}
+	return ""
+}
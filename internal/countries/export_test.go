@@ -0,0 +1,147 @@
+package countries
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestExportGzip(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry("Nigeria", "Africa", "NGN", 200, 1600),
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+	)
+	r := newTestRouter(svc)
+
+	req := httptest.NewRequest(http.MethodGet, "/countries/export?sort=name_asc", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := serve(r, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="countries.csv"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	rows, err := csv.NewReader(zr).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(rows) != 3 || rows[0][1] != "name" || rows[1][1] != "Ghana" || rows[2][1] != "Nigeria" {
+		t.Errorf("decompressed rows = %v", rows)
+	}
+}
+
+func TestExportPlain(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+
+	rec := serve(newTestRouter(svc), httptest.NewRequest(http.MethodGet, "/countries/export", nil))
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q without Accept-Encoding", got)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(rows) != 2 || rows[1][1] != "Ghana" {
+		t.Errorf("rows = %v", rows)
+	}
+}
+
+func TestExportHeaderAndRows(t *testing.T) {
+	svc := newTestService(t)
+	ghana := testCountry("Ghana", "Africa", "GHS", 30, 15)
+	capital := "Accra"
+	ghana.Capital = &capital
+	seed(t, svc,
+		ghana,
+		// no rate: exchange_rate, estimated_gdp and currency_rates are NULL
+		testCountry("Benin", "Africa", "XOF", 12, 0),
+		testCountry("France", "Europe", "EUR", 60, 0.9),
+	)
+
+	rec := serve(newTestRouter(svc), httptest.NewRequest(http.MethodGet, "/countries/export?region=africa&sort=name_desc", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="countries.csv"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	want := [][]string{
+		{"id", "name", "capital", "region", "population", "currency_code", "currency_codes", "exchange_rate", "estimated_gdp", "flag_url", "numeric_code", "source", "last_refreshed_at", "area", "currency_rates"},
+		{"1", "Ghana", "Accra", "Africa", "30", "GHS", "GHS", "15", "3000", "", "", "refresh", "2025-01-02T03:04:05Z", "", `{"GHS":"15"}`},
+		{"2", "Benin", "", "Africa", "12", "XOF", "XOF", "", "", "", "", "refresh", "2025-01-02T03:04:05Z", "", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows =\n%q\nwant\n%q", rows, want)
+	}
+}
+
+func TestExportEmpty(t *testing.T) {
+	svc := newTestService(t)
+	rec := serve(newTestRouter(svc), httptest.NewRequest(http.MethodGet, "/countries/export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(rows) != 1 || rows[0][0] != "id" {
+		t.Errorf("rows = %q, %v; want just the header", rows, err)
+	}
+}
+
+func TestExportQueryFails(t *testing.T) {
+	svc := newTestService(t)
+	svc.DB.Close()
+	rec := serve(newTestRouter(svc), httptest.NewRequest(http.MethodGet, "/countries/export", nil))
+	// nothing was streamed yet, so it's still a JSON error
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("Content-Disposition = %q on an error", got)
+	}
+}
+
+func TestEachCountryStreams(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, makeCountries(5)...)
+
+	// rows arrive one by one, and an error from fn ends the read
+	errStop := errors.New("stop")
+	var seen []string
+	err := svc.EachCountry(context.Background(), ListFilter{}, func(c *Country) error {
+		seen = append(seen, c.Name)
+		if len(seen) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("EachCountry error = %v, want the one from fn", err)
+	}
+	if want := []string{"Country 0", "Country 1"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("seen = %v, want %v", seen, want)
+	}
+}
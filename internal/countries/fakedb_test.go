@@ -0,0 +1,155 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zjoart/countryxchange/internal/database"
+)
+
+// fakeDB is a database/sql connector whose statements do nothing but can be
+// made to fail or take time, for exercising transaction handling without a
+// database. Queries return no rows but are recorded.
+type fakeDB struct {
+	// execErr, when set, decides the error of each Exec from its query and
+	// arguments
+	execErr func(query string, args []driver.Value) error
+	// latency is slept by every Exec, standing in for a network round trip
+	latency time.Duration
+
+	mu        sync.Mutex
+	execs     []string
+	queries   []string
+	begins    int
+	commits   int
+	rollbacks int
+}
+
+// newFakeService returns a Service over f with the test config
+func newFakeService(t testing.TB, f *fakeDB) *Service {
+	t.Helper()
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return NewService(db, testConfig(), database.MySQL{})
+}
+
+// count returns how many executed statements contain substr
+func (f *fakeDB) count(substr string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, q := range f.execs {
+		if strings.Contains(q, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// lastQuery returns the most recent query, or "" when none ran
+func (f *fakeDB) lastQuery() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queries) == 0 {
+		return ""
+	}
+	return f.queries[len(f.queries)-1]
+}
+
+// txCounts returns the begun, committed and rolled back transactions
+func (f *fakeDB) txCounts() (begins, commits, rollbacks int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.begins, f.commits, f.rollbacks
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+
+func (f *fakeDB) Driver() driver.Driver { return fakeDriver{f} }
+
+type fakeDriver struct{ db *fakeDB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{db: d.db}, nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	c.db.begins++
+	c.db.mu.Unlock()
+	return &fakeTx{db: c.db}, nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (t *fakeTx) Commit() error {
+	t.db.mu.Lock()
+	t.db.commits++
+	t.db.mu.Unlock()
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.db.mu.Lock()
+	t.db.rollbacks++
+	t.db.mu.Unlock()
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.db.latency > 0 {
+		time.Sleep(s.db.latency)
+	}
+	if s.db.execErr != nil {
+		if err := s.db.execErr(s.query, args); err != nil {
+			return nil, err
+		}
+	}
+	s.db.mu.Lock()
+	s.db.execs = append(s.db.execs, s.query)
+	s.db.mu.Unlock()
+	return fakeResult{}, nil
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	s.db.queries = append(s.db.queries, s.query)
+	s.db.mu.Unlock()
+	return fakeRows{}, nil
+}
+
+// fakeResult reports one affected row with id 1
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 1, nil }
+
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string { return nil }
+
+func (fakeRows) Close() error { return nil }
+
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
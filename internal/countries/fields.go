@@ -0,0 +1,104 @@
+package countries
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseFields validates ?fields= against the stored country columns and
+// returns them comma-joined in canonical column order, so equivalent
+// requests share one snapshot key and one SQL shape
+func parseFields(v string) (string, error) {
+	if strings.TrimSpace(v) == "" {
+		return "", nil
+	}
+	want := make(map[string]bool)
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !isCountryColumn(f) {
+			return "", fmt.Errorf("unknown field %q (allowed: %s)", f, countryColumns)
+		}
+		want[f] = true
+	}
+	var out []string
+	for _, col := range allCountryColumns {
+		if want[col] {
+			out = append(out, col)
+		}
+	}
+	return strings.Join(out, ","), nil
+}
+
+func isCountryColumn(s string) bool {
+	for _, col := range allCountryColumns {
+		if s == col {
+			return true
+		}
+	}
+	return false
+}
+
+// projectList keeps only the requested fields of each country. Unset
+// pointers are still emitted as null so every object has the same keys.
+func projectList(list []Country, fields string, asStrings bool) []map[string]interface{} {
+	cols := strings.Split(fields, ",")
+	out := make([]map[string]interface{}, len(list))
+	for i := range list {
+		c := &list[i]
+		m := make(map[string]interface{}, len(cols))
+		for _, col := range cols {
+			m[col] = countryField(c, col, asStrings)
+		}
+		out[i] = m
+	}
+	return out
+}
+
+// countryField returns the JSON value of one stored column of c
+func countryField(c *Country, col string, asStrings bool) interface{} {
+	switch col {
+	case "id":
+		return c.ID
+	case "name":
+		return c.Name
+	case "capital":
+		return c.Capital
+	case "region":
+		return c.Region
+	case "population":
+		return c.Population
+	case "currency_code":
+		return c.CurrencyCode
+	case "currency_codes":
+		return c.CurrencyCodes
+	case "currency_rates":
+		if asStrings {
+			return formatRates(c.CurrencyRates)
+		}
+		return c.CurrencyRates
+	case "exchange_rate":
+		if asStrings {
+			return formatDecimal(c.ExchangeRate)
+		}
+		return c.ExchangeRate
+	case "estimated_gdp":
+		if asStrings {
+			return formatDecimal(c.EstimatedGDP)
+		}
+		return c.EstimatedGDP
+	case "flag_url":
+		return c.FlagURL
+	case "numeric_code":
+		return c.NumericCode
+	case "source":
+		return c.Source
+	case "last_refreshed_at":
+		return c.LastRefreshedAt
+	case "area":
+		return c.Area
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package countries
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"  ", "", false},
+		{"name", "name", false},
+		// canonical column order, duplicates and blanks dropped
+		{"region, name,,name", "name,region", false},
+		{"estimated_gdp,id", "id,estimated_gdp", false},
+		{"name,gdp", "", true},
+		{"name;DROP TABLE countries", "", true},
+		{"Name", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseFields(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseFields(%q) = %q, %v; want %q, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGetAllNarrowProjection(t *testing.T) {
+	// only the requested columns reach the SQL
+	f := &fakeDB{}
+	if _, err := newFakeService(t, f).GetAll(context.Background(), ListFilter{Fields: "name,region"}); err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if q := f.lastQuery(); !strings.HasPrefix(q, "SELECT name, region FROM countries") {
+		t.Errorf("query = %q, want it to select only name and region", q)
+	}
+
+	// and the scanner fills just those
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	list, err := svc.GetAll(context.Background(), ListFilter{Fields: "name,region"})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("GetAll = %d rows, %v", len(list), err)
+	}
+	c := list[0]
+	if c.Name != "Ghana" || c.Region == nil || *c.Region != "Africa" {
+		t.Errorf("selected fields = %q, %v", c.Name, c.Region)
+	}
+	if c.ID != 0 || c.Population != 0 || c.CurrencyCode != nil || c.EstimatedGDP != nil || c.LastRefreshedAt != nil {
+		t.Errorf("unselected fields were filled: %+v", c)
+	}
+}
+
+func TestListFieldsResponse(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+		testCountry("Peru", "Americas", "PEN", 33, 3.7),
+	)
+	r := newTestRouter(svc)
+
+	rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries?fields=region,name", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var list []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 2 {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	for _, obj := range list {
+		var keys []string
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, []string{"name", "region"}) {
+			t.Errorf("keys = %v, want name and region", keys)
+		}
+	}
+
+	rec = serve(r, httptest.NewRequest(http.MethodGet, "/countries?fields=name,secret", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: status = %d, want 400", rec.Code)
+	}
+}
+
+// BenchmarkGetAllProjection compares reading every column with the narrow
+// selects of ?fields=
+func BenchmarkGetAllProjection(b *testing.B) {
+	svc := newTestService(b)
+	seed(b, svc, makeCountries(benchRows)...)
+
+	for _, bm := range []struct{ name, fields string }{
+		{"all", ""},
+		{"name", "name"},
+		{"name,population,estimated_gdp", "name,population,estimated_gdp"},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				list, err := svc.GetAll(context.Background(), ListFilter{Fields: bm.fields})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(list) != benchRows {
+					b.Fatalf("got %d rows", len(list))
+				}
+			}
+		})
+	}
+}
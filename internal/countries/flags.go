@@ -0,0 +1,197 @@
+package countries
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// flagCacheDir holds flags downloaded by PrefetchFlags, one file per country
+const flagCacheDir = "cache/flags"
+
+// maxFlagBytes guards against an upstream serving something that isn't a flag
+const maxFlagBytes = 2 << 20
+
+// FlagFetchResult is the outcome of downloading one country's flag
+type FlagFetchResult struct {
+	Name    string `json:"name"`
+	FlagURL string `json:"flag_url"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PrefetchResult summarizes a PrefetchFlags run
+type PrefetchResult struct {
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Countries []FlagFetchResult `json:"countries"`
+}
+
+// flagCachePath returns where the flag for name is cached, keeping the
+// extension of the upstream URL (e.g. .svg) so it can be served as-is
+func flagCachePath(name, flagURL string) string {
+	ext := ".img"
+	if u, err := url.Parse(flagURL); err == nil {
+		if e := path.Ext(u.Path); e != "" {
+			ext = strings.ToLower(e)
+		}
+	}
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '-'
+		}
+	}, strings.ToLower(name))
+	return filepath.Join(flagCacheDir, slug+ext)
+}
+
+// PrefetchFlags downloads the flag of every stored country into the local
+// cache using at most cfg.PrefetchConcurrency concurrent requests
+func (s *Service) PrefetchFlags(ctx context.Context) (*PrefetchResult, error) {
+	cfg := &s.Config.Flags
+	list, err := s.GetAll(ctx, ListFilter{HasFlag: "true"})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(flagCacheDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	workers := cfg.PrefetchConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	results := make([]FlagFetchResult, len(list))
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				c := list[i]
+				res := FlagFetchResult{Name: c.Name, FlagURL: *c.FlagURL}
+				if err := downloadFlag(ctx, client, res.FlagURL, flagCachePath(c.Name, res.FlagURL)); err != nil {
+					logger.Warn("flag prefetch failed", logger.Fields{"name": c.Name, "error": err.Error()})
+					res.Error = err.Error()
+				} else {
+					res.OK = true
+				}
+				results[i] = res
+			}
+		}()
+	}
+	for i := range list {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+
+	out := &PrefetchResult{Total: len(results), Countries: results}
+	status := make(map[string]bool, len(results))
+	for _, r := range results {
+		status[r.Name] = r.OK
+		if r.OK {
+			out.Succeeded++
+		} else {
+			out.Failed++
+		}
+	}
+	logger.Info("flag prefetch finished", logger.Fields{"total": out.Total, "succeeded": out.Succeeded, "failed": out.Failed})
+	// feeds GET /countries?flag_status=broken
+	if err := s.SetFlagStatus(status); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// fetchFlag downloads flagURL, refusing bodies larger than maxFlagBytes
+func fetchFlag(ctx context.Context, client *http.Client, flagURL string) (data []byte, contentType string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, flagURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxFlagBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxFlagBytes {
+		return nil, "", fmt.Errorf("flag larger than %d bytes", maxFlagBytes)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// downloadFlag fetches flagURL and atomically replaces destPath with it
+func downloadFlag(ctx context.Context, client *http.Client, flagURL, destPath string) error {
+	data, _, err := fetchFlag(ctx, client, flagURL)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(destPath), ".flag-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), destPath)
+}
+
+// flagDataURI returns c's flag as a base64 data URL, served from the
+// prefetch cache when present and fetched from flag_url otherwise
+func flagDataURI(ctx context.Context, c *Country, cfg *config.FlagConfig) (string, error) {
+	if c.FlagURL == nil || *c.FlagURL == "" {
+		return "", errors.New("country has no flag_url")
+	}
+	cached := flagCachePath(c.Name, *c.FlagURL)
+	contentType := mime.TypeByExtension(filepath.Ext(cached))
+
+	data, err := os.ReadFile(cached)
+	if err != nil {
+		var fetchedType string
+		data, fetchedType, err = fetchFlag(ctx, &http.Client{Timeout: cfg.Timeout}, *c.FlagURL)
+		if err != nil {
+			return "", err
+		}
+		if fetchedType != "" {
+			contentType = fetchedType
+		}
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,69 @@
+package countries
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEmbedFlag(t *testing.T) {
+	// keep the flag cache of this run out of the source tree
+	t.Chdir(t.TempDir())
+	png := []byte("\x89PNG\r\n\x1a\nnot really a flag")
+	flags := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gh.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	}))
+	t.Cleanup(flags.Close)
+
+	svc := newTestService(t)
+	ghana := testCountry("Ghana", "Africa", "GHS", 30, 15)
+	ghanaFlag := flags.URL + "/gh.png"
+	ghana.FlagURL = &ghanaFlag
+	togo := testCountry("Togo", "Africa", "XOF", 8, 600)
+	togoFlag := flags.URL + "/tg.png"
+	togo.FlagURL = &togoFlag
+	seed(t, svc, ghana, togo)
+	r := newTestRouter(svc)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"embedded", "/countries/Ghana?embed_flag=true", "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)},
+		{"not asked for", "/countries/Ghana", ""},
+		{"flag fetch fails", "/countries/Togo?embed_flag=true", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (%s)", rec.Code, rec.Body)
+			}
+			var body struct {
+				FlagDataURI *string `json:"flag_data_uri"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			got := ""
+			if body.FlagDataURI != nil {
+				got = *body.FlagDataURI
+			}
+			if got != tt.want {
+				t.Errorf("flag_data_uri = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries/Ghana?embed_flag=maybe", nil)); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid embed_flag: status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+
+	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// ErrUnknownRegion is returned when a region filter matches no stored country
+var ErrUnknownRegion = errors.New("unknown region")
+
+// estimateGDP computes estimated_gdp = population * multiplier / exchange_rate,
+// scaled to the configured unit. The multiplier is cfg.Multiplier when set,
+// otherwise drawn from r in 1000..2000.
+func estimateGDP(population int64, rate float64, r *rand.Rand, cfg *config.GDPConfig) float64 {
+	mult := cfg.Multiplier
+	if mult <= 0 {
+		mult = float64(r.Intn(1001) + 1000) // 1000..2000
+	}
+	return float64(population) * mult / rate / gdpScale(cfg.Unit)
+}
+
+// defaultGDPSeed seeds the random multiplier when GDP_SEED is unset (0), so
+// the same stored data always yields the same estimated_gdp
+const defaultGDPSeed = 1
+
+// newGDPRand returns the source of the random multiplier, seeded from
+// cfg.Seed, or defaultGDPSeed when that is 0
+func newGDPRand(cfg *config.GDPConfig) *rand.Rand {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = defaultGDPSeed
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// gdpScale is the divisor turning a USD amount into unit
+func gdpScale(unit string) float64 {
+	if unit == "USD_millions" {
+		return 1e6
+	}
+	return 1
+}
+
+// RecomputeGDP re-estimates estimated_gdp from the stored population and
+// exchange_rate, optionally scoped to one region, and returns how many rows
+// were updated. Rows without an exchange rate are left untouched.
+func (s *Service) RecomputeGDP(ctx context.Context, region string) (int64, error) {
+	cfg := s.Config
+	where, args := ListFilter{Region: region}.whereClause(s.Dialect)
+
+	if region != "" {
+		var n int64
+		if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM countries`+where, args...).Scan(&n); err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, ErrUnknownRegion
+		}
+	}
+
+	release, err := s.bulkOps.acquire(ctx, &cfg.DB)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	r := newGDPRand(&cfg.GDP)
+	var updated int64
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		updated = 0
+		q := `SELECT id, population, exchange_rate FROM countries` + where
+		if where == "" {
+			q += ` WHERE exchange_rate IS NOT NULL`
+		} else {
+			q += ` AND exchange_rate IS NOT NULL`
+		}
+		rows, err := tx.QueryContext(ctx, q+s.Dialect.ForUpdate(), args...)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id         int64
+			population int64
+			rate       float64
+		}
+		var todo []row
+		for rows.Next() {
+			var rw row
+			if err := rows.Scan(&rw.id, &rw.population, &rw.rate); err != nil {
+				rows.Close()
+				return err
+			}
+			todo = append(todo, rw)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		stmt, err := tx.PrepareContext(ctx, `UPDATE countries SET estimated_gdp = ? WHERE id = ?`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, rw := range todo {
+			if _, err := stmt.ExecContext(ctx, estimateGDP(rw.population, rw.rate, r, &cfg.GDP), rw.id); err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.Info("service: recomputed estimated_gdp", logger.Fields{"region": region, "updated": updated})
+	return updated, nil
+}
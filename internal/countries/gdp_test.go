@@ -0,0 +1,170 @@
+package countries
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zjoart/countryxchange/internal/config"
+)
+
+// draws returns the first n multipliers estimateGDP takes from a fresh
+// source for cfg
+func draws(cfg *config.GDPConfig, n int) []float64 {
+	r := newGDPRand(cfg)
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = estimateGDP(1, 1, r, cfg)
+	}
+	return out
+}
+
+func TestGDPSeedDeterministic(t *testing.T) {
+	unset := &config.GDPConfig{Unit: "USD"}
+	first, second := draws(unset, 5), draws(unset, 5)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("unset seed: draw %d = %v then %v, want the same sequence", i, first[i], second[i])
+		}
+		if first[i] < 1000 || first[i] > 2000 {
+			t.Errorf("multiplier %v outside 1000..2000", first[i])
+		}
+	}
+
+	seeded := draws(&config.GDPConfig{Unit: "USD", Seed: 42}, 5)
+	same := true
+	for i := range seeded {
+		if seeded[i] != first[i] {
+			same = false
+		}
+	}
+	if same {
+		t.Errorf("GDP_SEED=42 drew the default sequence %v", seeded)
+	}
+}
+
+func TestEstimateGDPMultiplier(t *testing.T) {
+	cfg := &config.GDPConfig{Unit: "USD_millions", Multiplier: 1500}
+	if got := estimateGDP(2_000_000, 4, newGDPRand(cfg), cfg); got != 750 {
+		t.Errorf("estimateGDP = %v, want 750 (2e6 * 1500 / 4 / 1e6)", got)
+	}
+}
+
+func TestBuildCountryWithoutCurrency(t *testing.T) {
+	rc := restCountry{Name: "Antarctica", Population: 1000}
+	rates := map[string]float64{"USD": 1}
+
+	tests := []struct {
+		name string
+		cfg  config.GDPConfig
+		want *float64
+	}{
+		{"null by default", config.GDPConfig{}, nil},
+		{"zero when configured", config.GDPConfig{EmptyCurrencyZero: true}, new(float64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			c := buildCountry(rc, rates, newGDPRand(&cfg), time.Now(), &cfg)
+			if c.CurrencyCode != nil || c.ExchangeRate != nil {
+				t.Errorf("currency = %v, rate = %v, want both nil", c.CurrencyCode, c.ExchangeRate)
+			}
+			switch {
+			case tt.want == nil && c.EstimatedGDP != nil:
+				t.Errorf("estimated_gdp = %g, want NULL", *c.EstimatedGDP)
+			case tt.want != nil && (c.EstimatedGDP == nil || *c.EstimatedGDP != *tt.want):
+				t.Errorf("estimated_gdp = %v, want %g", c.EstimatedGDP, *tt.want)
+			}
+		})
+	}
+}
+
+func TestTopGDPSkipsNull(t *testing.T) {
+	svc := newTestService(t)
+	noCurrency := testCountry("Antarctica", "Polar", "XXX", 1000, 1)
+	noCurrency.CurrencyCode, noCurrency.ExchangeRate, noCurrency.EstimatedGDP = nil, nil, nil
+	// a currency missing from the rates also leaves the GDP NULL
+	noRate := testCountry("Tuvalu", "Oceania", "TVD", 11000, 1)
+	noRate.ExchangeRate, noRate.EstimatedGDP = nil, nil
+	seed(t, svc,
+		noCurrency,
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+		noRate,
+		testCountry("Kenya", "Africa", "KES", 50, 130),
+		testCountry("Peru", "Americas", "PEN", 33, 3.7),
+	)
+
+	for _, n := range []int{2, 5} {
+		top, err := svc.topGDP(n, 0)
+		if err != nil {
+			t.Fatalf("topGDP(%d): %v", n, err)
+		}
+		var got []string
+		for _, e := range top {
+			got = append(got, e.Name)
+		}
+		want := []string{"Peru", "Ghana", "Kenya"}[:min(n, 3)]
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("topGDP(%d) = %v, want %v", n, got, want)
+		}
+	}
+
+	// the outlier path reads every row, and still none of the NULL ones
+	top, err := svc.topGDP(5, 3)
+	if err != nil {
+		t.Fatalf("topGDP with outliers: %v", err)
+	}
+	if len(top) != 3 {
+		t.Errorf("topGDP with outliers = %v, want the 3 countries with a GDP", top)
+	}
+}
+
+func TestGDPRank(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry("Ghana", "Africa", "GHS", 30, 15),   // 3000
+		testCountry("Kenya", "Africa", "KES", 60, 30),   // 3000, tied with Ghana
+		testCountry("France", "Europe", "EUR", 60, 0.9), // 100000
+		testCountry("Togo", "Africa", "XOF", 8, 600),    // 20
+		testCountry("Atlantis", "Oceania", "ATL", 5, 0), // no GDP
+	)
+	r := newTestRouter(svc)
+
+	tests := []struct {
+		name string
+		want int64 // 0: null
+	}{
+		{"France", 1},
+		{"Ghana", 2},
+		{"Kenya", 2},
+		{"Togo", 4},
+		{"Atlantis", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries/"+tt.name, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+			}
+			var body struct {
+				GDPRank *int64 `json:"gdp_rank"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			var got int64
+			if body.GDPRank != nil {
+				if *body.GDPRank == 0 {
+					t.Fatal("gdp_rank = 0")
+				}
+				got = *body.GDPRank
+			}
+			if got != tt.want {
+				t.Errorf("gdp_rank = %d, want %d (0: null)", got, tt.want)
+			}
+		})
+	}
+}
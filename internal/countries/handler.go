@@ -1,15 +1,22 @@
 package countries
 
 import (
-	"database/sql"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/zjoart/countryxchange/internal/middleware"
+	"github.com/zjoart/countryxchange/pkg/api"
 	"github.com/zjoart/countryxchange/pkg/logger"
 )
 
@@ -20,138 +27,1312 @@ func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 }
 
 func writeError(w http.ResponseWriter, status int, msg string, details interface{}) {
-	payload := map[string]interface{}{"error": msg}
-	if details != nil {
-		payload["details"] = details
+	writeJSON(w, status, api.ErrorResponse{Error: msg, Details: details})
+}
+
+// decodeJSON decodes the request body into v, answering 400 when it is not
+// well-formed JSON of the expected shape
+func decodeJSON(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body", err.Error())
+		return false
+	}
+	return true
+}
+
+// writeValidationError answers 422 for a well-formed body that fails
+// validation, keeping 400 for bodies that can't be decoded at all
+func writeValidationError(w http.ResponseWriter, details map[string]string) {
+	writeError(w, http.StatusUnprocessableEntity, "Validation failed", details)
+}
+
+// writeBusy answers 503 when the bulk operation cap is reached
+func writeBusy(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "5")
+	writeError(w, http.StatusServiceUnavailable, "Too many concurrent bulk operations", nil)
+}
+
+// writeExternalError answers 503 for a failed upstream fetch, passing on
+// how long a rate-limited upstream asked us to wait
+func writeExternalError(w http.ResponseWriter, err ExternalError) {
+	if err.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	}
+	writeError(w, http.StatusServiceUnavailable, "External data source unavailable", err.Error())
+}
+
+// staleHeader marks responses served from the in-memory snapshot
+const staleHeader = "X-Data-Stale"
+
+// auditResult records action in the audit log as "success" or "failure"
+func (s *Service) auditResult(req *http.Request, action, target string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	s.RecordAudit(action, middleware.Actor(req), target, result)
+}
+
+// maxAuditLimit caps the page size of GET /audit
+const maxAuditLimit = 200
+
+// maxDiffLimit caps the number of differences returned by /countries/diff
+const maxDiffLimit = 500
+
+// sortValuesHint lists the sortOrders keys for 400 responses
+const sortValuesHint = "must be one of gdp_asc, gdp_desc, population_asc, population_desc, name_asc, name_desc, density_asc, density_desc"
+
+// default and max number of matches returned by /countries/search
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// maxBulkDeleteNames caps the names accepted by DELETE /countries and
+// POST /countries/status
+const maxBulkDeleteNames = 500
+
+// uniqueNames trims names and drops blanks and case-insensitive duplicates,
+// keeping the first spelling
+func uniqueNames(raw []string) []string {
+	seen := make(map[string]bool, len(raw))
+	var names []string
+	for _, n := range raw {
+		n = strings.TrimSpace(n)
+		if n == "" || seen[strings.ToLower(n)] {
+			continue
+		}
+		seen[strings.ToLower(n)] = true
+		names = append(names, n)
+	}
+	return names
+}
+
+// validateNameList reports a 422 when names is empty or over the cap
+func validateNameList(w http.ResponseWriter, names []string) bool {
+	if len(names) == 0 {
+		writeValidationError(w, map[string]string{"names": "must contain at least one name"})
+		return false
+	}
+	if len(names) > maxBulkDeleteNames {
+		writeValidationError(w, map[string]string{"names": fmt.Sprintf("must contain at most %d names", maxBulkDeleteNames)})
+		return false
+	}
+	return true
+}
+
+// computed fields that can be attached to /countries/{name} via ?expand=
+// (gdp_rank is now always included)
+const (
+	expandCurrencyPeers = "currency_peers"
+	expandGDPRank       = "gdp_rank"
+)
+
+// parseExpand splits a comma-separated expand value and rejects unknown entries
+func parseExpand(raw string) ([]string, error) {
+	var out []string
+	for _, e := range strings.Split(raw, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if e != expandCurrencyPeers && e != expandGDPRank {
+			return nil, fmt.Errorf("unknown expand value %q (allowed: %s, %s)", e, expandCurrencyPeers, expandGDPRank)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// pathName returns the trimmed {name} path variable, writing a 400 when it is
+// empty so handlers never query for a blank name
+func pathName(w http.ResponseWriter, req *http.Request) (string, bool) {
+	name := strings.TrimSpace(mux.Vars(req)["name"])
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "Validation failed", map[string]string{"name": "is required"})
+		return "", false
 	}
-	writeJSON(w, status, payload)
+	return name, true
 }
 
-// RegisterRoutes mounts country endpoints onto router
-func RegisterRoutes(r *mux.Router, db *sql.DB, isProduction bool) {
-	r.HandleFunc("/countries/refresh", func(w http.ResponseWriter, req *http.Request) {
-		ctx := req.Context()
+// appliedFilter echoes the filters, sort and paging a list request was
+// interpreted as, for ?debug=true
+func appliedFilter(f ListFilter, paged bool) map[string]interface{} {
+	applied := map[string]interface{}{
+		"region":         f.Region,
+		"currency":       f.Currency,
+		"source":         f.Source,
+		"has_flag":       f.HasFlag,
+		"flag_status":    f.FlagStatus,
+		"min_gdp":        f.MinGDP,
+		"max_gdp":        f.MaxGDP,
+		"min_population": f.MinPopulation,
+		"max_population": f.MaxPopulation,
+		"modified_since": nil,
+		"fields":         f.Fields,
+		"sort":           f.Sort,
+		"limit":          nil,
+		"offset":         nil,
+	}
+	if !f.ModifiedSince.IsZero() {
+		applied["modified_since"] = f.ModifiedSince.Format(time.RFC3339)
+	}
+	if paged {
+		applied["limit"] = f.Limit
+		applied["offset"] = f.Offset
+	}
+	return applied
+}
+
+// isNumericCode reports whether s looks like an ISO 3166-1 numeric code
+func isNumericCode(s string) bool {
+	if len(s) == 0 || len(s) > 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ratesParams applies the refresh rates options: ?force=true skips the
+// rates cache and ?base= overrides the base currency. It writes a 400 and
+// returns false for a malformed value.
+func ratesParams(ctx context.Context, w http.ResponseWriter, req *http.Request) (context.Context, bool) {
+	q := req.URL.Query()
+	if raw := q.Get("force"); raw != "" {
+		force, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid force", "must be true or false")
+			return ctx, false
+		}
+		if force {
+			ctx = withForcedRates(ctx)
+		}
+	}
+	if raw := strings.TrimSpace(q.Get("base")); raw != "" {
+		base := strings.ToUpper(raw)
+		if !isCurrencyCode(base) {
+			writeError(w, http.StatusBadRequest, "Invalid base", "must be a 3-letter currency code")
+			return ctx, false
+		}
+		ctx = withRatesBase(ctx, base)
+	}
+	return ctx, true
+}
+
+// dropConfirmation reports how a /drop-tables call was confirmed: "header"
+// for X-Confirm-Drop: yes, "body" for {"confirm":"DROP"}, or "" when it
+// wasn't
+func dropConfirmation(req *http.Request) string {
+	if strings.EqualFold(req.Header.Get("X-Confirm-Drop"), "yes") {
+		return "header"
+	}
+	var body struct {
+		Confirm string `json:"confirm"`
+	}
+	if err := json.NewDecoder(io.LimitReader(req.Body, 1024)).Decode(&body); err == nil && body.Confirm == "DROP" {
+		return "body"
+	}
+	return ""
+}
+
+// RegisterRoutes mounts the public country endpoints onto r and the admin
+// and destructive ones onto admin, which may be the same router
+func RegisterRoutes(r, admin *mux.Router, svc *Service) {
+	cfg := svc.Config
+	isProduction := cfg.AppEnv == "production"
+	allowlist := middleware.IPAllowlistMiddleware(cfg.AdminAllowedCIDRs, cfg.TrustedProxies)
+	adminOnly := func(h http.Handler) http.Handler {
+		return allowlist(middleware.APIKeyMiddleware(cfg.AdminAPIKey)(h))
+	}
+
+	r.HandleFunc("/countries/refresh", func(w http.ResponseWriter, req *http.Request) {
+		// the refresh gets its own deadline so it finishes (or rolls back)
+		// before the server write timeout would drop the response
+		ctx, cancel := context.WithTimeout(req.Context(), cfg.Refresh.Timeout)
+		defer cancel()
+		ctx, ok := ratesParams(ctx, w, req)
+		if !ok {
+			return
+		}
+
+		// handler-level structured log: calling refresh service
+		logger.Info("handler: calling Refresh service", logFields(req.Context(), logger.Fields{
+			"action":      "countries.refresh",
+			"remote_addr": req.RemoteAddr,
+			"user_agent":  req.UserAgent(),
+			"db_present":  svc.DB != nil,
+		}))
+
+		res, err := svc.Refresh(ctx)
+		svc.auditResult(req, AuditRefresh, "", err)
+		if err != nil {
+			// validation error
+			if verr, ok := err.(*ValidationError); ok {
+				logger.Warn("handler: validation failed", logFields(req.Context(), logger.Fields{"errors": verr.Errors}))
+				writeError(w, http.StatusBadRequest, "Validation failed", verr.Errors)
+				return
+			}
+			if err == ErrBusy {
+				writeBusy(w)
+				return
+			}
+			// external API error
+			if extErr, ok := err.(ExternalError); ok {
+				logger.Warn("handler: refresh failed - external API", logFields(req.Context(), logger.Fields{"error": err.Error(), "status": extErr.Status}))
+				writeExternalError(w, extErr)
+				return
+			}
+			logger.Error("handler: refresh failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+
+		logger.Info("handler: refresh completed", logFields(req.Context(), logger.Fields{"total_processed": res.Total, "last_refreshed_at": res.LastRefreshed.Format(time.RFC3339)}))
+		status := http.StatusOK
+		if res.StaleRates {
+			status = cfg.Refresh.PartialStatus
+		}
+		writeJSON(w, status, api.RefreshResponse{Message: "refreshed", Total: res.Total, Skipped: res.Skipped, StaleRates: res.StaleRates, Partial: res.StaleRates, Warnings: res.Warnings, ByRegion: res.ByRegion, Timings: res.Timings, LastRefreshedAt: res.LastRefreshed.Format(time.RFC3339), Image: res.Image})
+	}).Methods("POST")
+
+	admin.Handle("/countries/recompute-gdp", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		region := strings.TrimSpace(req.URL.Query().Get("region"))
+		logger.Info("handler: recompute gdp", logFields(req.Context(), logger.Fields{"region": region, "remote_addr": req.RemoteAddr}))
+		n, err := svc.RecomputeGDP(req.Context(), region)
+		svc.auditResult(req, AuditRecomputeGDP, region, err)
+		if err != nil {
+			if err == ErrUnknownRegion {
+				writeError(w, http.StatusBadRequest, "Unknown region", region)
+				return
+			}
+			if err == ErrBusy {
+				writeBusy(w)
+				return
+			}
+			logger.Error("handler: recompute gdp failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"message": "recomputed", "updated": n})
+	}))).Methods("POST")
+
+	admin.Handle("/rates/refresh", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), cfg.Refresh.Timeout)
+		defer cancel()
+		ctx, ok := ratesParams(ctx, w, req)
+		if !ok {
+			return
+		}
+
+		logger.Info("handler: refresh rates", logFields(req.Context(), logger.Fields{"remote_addr": req.RemoteAddr}))
+		n, err := svc.RefreshRates(ctx)
+		svc.auditResult(req, AuditRatesRefresh, "", err)
+		if err != nil {
+			if verr, ok := err.(*ValidationError); ok {
+				writeError(w, http.StatusBadRequest, "Validation failed", verr.Errors)
+				return
+			}
+			if err == ErrBusy {
+				writeBusy(w)
+				return
+			}
+			if extErr, ok := err.(ExternalError); ok {
+				writeExternalError(w, extErr)
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"message": "rates refreshed", "updated": n})
+	}))).Methods("POST")
+
+	r.HandleFunc("/refreshes/diff", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		var points [2]*RefreshPoint
+		for i, key := range []string{"from", "to"} {
+			v := strings.TrimSpace(q.Get(key))
+			if v == "" {
+				writeError(w, http.StatusBadRequest, "Missing "+key, "must be a refresh id or RFC3339 time")
+				return
+			}
+			p, err := svc.ResolveRefreshPoint(v)
+			if err == ErrNotFound {
+				writeError(w, http.StatusNotFound, "Refresh not found", map[string]string{key: v})
+				return
+			}
+			if err != nil {
+				if _, ok := err.(*time.ParseError); ok {
+					writeError(w, http.StatusBadRequest, "Invalid "+key, "must be a refresh id or RFC3339 time")
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+				return
+			}
+			points[i] = p
+		}
+		limit, err := parsePositiveInt(req, "limit", defaultListLimit, maxListLimit)
+		if err != nil {
+			writeParamError(w, err)
+			return
+		}
+		offset, err := parseNonNegativeInt(req, "offset")
+		if err != nil {
+			writeParamError(w, err)
+			return
+		}
+
+		region := strings.TrimSpace(q.Get("region"))
+		res, err := svc.DiffRefreshes(points[0], points[1], region, limit, offset)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		writePagingHeaders(w, req, int64(res.Total), limit, offset)
+		writeJSON(w, http.StatusOK, res)
+	}).Methods("GET")
+
+	r.HandleFunc("/countries/validate", func(w http.ResponseWriter, req *http.Request) {
+		var c Country
+		if !decodeJSON(w, req, &c) {
+			return
+		}
+		if err := c.Validate(); err != nil {
+			writeValidationError(w, err.(*ValidationError).Errors)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"valid": true})
+	}).Methods("POST")
+
+	r.HandleFunc("/countries/diff", func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), cfg.Refresh.Timeout)
+		defer cancel()
+
+		region := req.URL.Query().Get("region")
+		limit, err := parsePositiveInt(req, "limit", 100, maxDiffLimit)
+		if err != nil {
+			writeParamError(w, err)
+			return
+		}
+
+		logger.Info("handler: calling Diff service", logFields(req.Context(), logger.Fields{"region": region, "limit": limit, "remote_addr": req.RemoteAddr}))
+		res, err := svc.Diff(ctx, region, limit)
+		if err != nil {
+			if extErr, ok := err.(ExternalError); ok {
+				writeExternalError(w, extErr)
+				return
+			}
+			logger.Error("handler: diff failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}).Methods("POST")
+
+	r.HandleFunc("/countries", func(w http.ResponseWriter, req *http.Request) {
+		// malformed keys like "?currency" are normalized by QueryNormalizationMiddleware
+		asStrings, err := numbersAsStrings(req, cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid numbers parameter", err.Error())
+			return
+		}
+
+		q := req.URL.Query()
+		filter := ListFilter{
+			Region:   q.Get("region"),
+			Currency: q.Get("currency"),
+			Source:   q.Get("source"),
+			Sort:     q.Get("sort"),
+		}
+		if _, ok := sortOrders[filter.Sort]; filter.Sort != "" && !ok {
+			writeError(w, http.StatusBadRequest, "Invalid sort", sortValuesHint)
+			return
+		}
+		if filter.Source != "" && !isValidSource(filter.Source) {
+			writeError(w, http.StatusBadRequest, "Invalid source", "must be one of refresh, manual, import")
+			return
+		}
+		if v := q.Get("has_flag"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid has_flag", "must be true or false")
+				return
+			}
+			filter.HasFlag = strconv.FormatBool(b)
+		}
+		if v := q.Get("flag_status"); v != "" {
+			if v != FlagStatusMissing && v != FlagStatusBroken {
+				writeError(w, http.StatusBadRequest, "Invalid flag_status", "must be missing or broken")
+				return
+			}
+			filter.FlagStatus = v
+		}
+		if v := q.Get("modified_since"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid modified_since", "must be an RFC3339 timestamp")
+				return
+			}
+			filter.ModifiedSince = t.UTC()
+		}
+		if filter.MinGDP, filter.MaxGDP, err = parseGDPRange(req); err != nil {
+			writeParamError(w, err)
+			return
+		}
+		if filter.MinPopulation, filter.MaxPopulation, err = parsePopulationRange(req); err != nil {
+			writeParamError(w, err)
+			return
+		}
+		if filter.Fields, err = parseFields(q.Get("fields")); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid fields parameter", err.Error())
+			return
+		}
+		// a sparse fieldset can't bring back a field the operator excluded
+		filter.Fields = withoutExcluded(filter.Fields, cfg.ExcludedFields)
+		debug := false
+		if v := q.Get("debug"); v != "" {
+			if debug, err = strconv.ParseBool(v); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid debug", "must be true or false")
+				return
+			}
+		}
+		paged := isPaged(req)
+		if paged {
+			if filter.Limit, err = parsePositiveInt(req, "limit", defaultListLimit, maxListLimit); err != nil {
+				writeParamError(w, err)
+				return
+			}
+			if filter.Offset, err = parseNonNegativeInt(req, "offset"); err != nil {
+				writeParamError(w, err)
+				return
+			}
+		} else if cfg.ListMaxRows > 0 {
+			// a failed count falls through to GetAll, which serves the snapshot
+			if total, err := svc.CountFiltered(req.Context(), filter); err == nil && total > int64(cfg.ListMaxRows) {
+				if cfg.ListOverflow == "reject" {
+					writeError(w, http.StatusRequestEntityTooLarge, "Result too large; paginate with ?limit= and ?offset=",
+						map[string]int64{"total": total, "max_rows": int64(cfg.ListMaxRows)})
+					return
+				}
+				paged = true
+				filter.Limit = defaultListLimit
+				w.Header().Set("X-Pagination-Applied", "true")
+			}
+		}
+		// a failed probe just skips the conditional answer
+		if version, err := svc.GetListVersion(); err == nil && writeConditional(w, req, version) {
+			logger.Info("handler: country list not modified", logFields(req.Context()))
+			return
+		}
+		logger.Info("handler: listing countries", logFields(req.Context(), logger.Fields{"region": filter.Region, "currency": filter.Currency, "source": filter.Source, "has_flag": filter.HasFlag, "sort": filter.Sort}))
+		list, err := svc.GetAll(req.Context(), filter)
+		if err != nil {
+			logger.Error("get all countries failed", logFields(req.Context(), logger.WithError(err)))
+			snap, ok := svc.snapshots.list(filter)
+			if !ok {
+				writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+				return
+			}
+			logger.Warn("handler: serving stale country list from memory", logFields(req.Context(), logger.Fields{"count": len(snap)}))
+			// the validators describe the DB, not this snapshot
+			w.Header().Del("ETag")
+			w.Header().Del("Last-Modified")
+			w.Header().Set(staleHeader, "true")
+			list = snap
+		} else {
+			svc.snapshots.storeList(filter, list)
+			if paged {
+				total, err := svc.CountFiltered(req.Context(), filter)
+				if err != nil {
+					writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+					return
+				}
+				writePagingHeaders(w, req, total, filter.Limit, filter.Offset)
+			}
+		}
+		var data interface{}
+		if filter.Fields != "" {
+			data = projectList(list, filter.Fields, asStrings)
+		} else {
+			now := svc.Now()
+			for i := range list {
+				annotate(&list[i], now, cfg)
+			}
+			data = presentList(list, asStrings)
+		}
+		logger.Info("handler: listed countries", logFields(req.Context(), logger.Fields{"count": len(list), "fields": filter.Fields}))
+		if debug {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"applied": appliedFilter(filter, paged), "data": data})
+			return
+		}
+		if len(list) == 0 && cfg.ListEmptyStatus == http.StatusNoContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, data)
+	}).Methods("GET")
+
+	admin.Handle("/countries", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Names []string `json:"names"`
+		}
+		if !decodeJSON(w, req, &body) {
+			return
+		}
+
+		// trim and drop blanks/duplicates so the not_found list stays meaningful
+		names := uniqueNames(body.Names)
+		if !validateNameList(w, names) {
+			return
+		}
+
+		logger.Info("handler: bulk delete countries", logFields(req.Context(), logger.Fields{"requested": len(names), "remote_addr": req.RemoteAddr}))
+		deleted, notFound, err := svc.BulkDelete(req.Context(), names)
+		if err != nil {
+			svc.auditResult(req, AuditDelete, "", err)
+			if err == ErrBusy {
+				writeBusy(w)
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		for _, n := range deleted {
+			svc.auditResult(req, AuditDelete, n, nil)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": len(deleted), "not_found": notFound})
+	}))).Methods("DELETE")
+
+	admin.Handle("/countries", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		asStrings, err := numbersAsStrings(req, cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid numbers parameter", err.Error())
+			return
+		}
+		var c Country
+		if !decodeJSON(w, req, &c) {
+			return
+		}
+		c.Name = strings.TrimSpace(c.Name)
+		if err := c.Validate(); err != nil {
+			writeValidationError(w, err.(*ValidationError).Errors)
+			return
+		}
+
+		// server-owned fields are never taken from the body
+		code := strings.ToUpper(*c.CurrencyCode)
+		c.CurrencyCode = &code
+		if len(c.CurrencyCodes) == 0 {
+			c.CurrencyCodes = []string{code}
+		}
+		c.Source = SourceManual
+		c.LastRefreshedAt = api.NewTime(svc.Now())
+		c.RateAgeSeconds, c.RateStale, c.CurrencySymbol, c.GDPUnit = nil, nil, nil, nil
+
+		logger.Info("handler: create country", logFields(req.Context(), logger.Fields{"name": c.Name, "remote_addr": req.RemoteAddr}))
+		id, err := svc.InsertCountry(req.Context(), &c)
+		svc.auditResult(req, AuditCreate, c.Name, err)
+		if err == ErrDuplicate {
+			writeError(w, http.StatusConflict, "Country already exists", map[string]string{"name": c.Name})
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		c.ID = id
+		annotate(&c, svc.Now(), cfg)
+		writeJSON(w, http.StatusCreated, presentDetail(&CountryDetail{Country: &c}, asStrings))
+	}))).Methods("POST")
+
+	r.HandleFunc("/countries/status", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Names []string `json:"names"`
+		}
+		if !decodeJSON(w, req, &body) {
+			return
+		}
+		names := uniqueNames(body.Names)
+		if !validateNameList(w, names) {
+			return
+		}
+
+		stored, err := svc.GetByNames(req.Context(), names)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		out := make([]CountryStatus, len(names))
+		for i, n := range names {
+			out[i] = CountryStatus{Name: n}
+			if c, ok := stored[strings.ToLower(n)]; ok {
+				out[i].Exists = true
+				out[i].LastRefreshedAt = c.LastRefreshedAt
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"countries": out})
+	}).Methods("POST")
+
+	r.HandleFunc("/countries/facets", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		region, currency := q.Get("region"), q.Get("currency")
+		logger.Info("handler: country facets", logFields(req.Context(), logger.Fields{"region": region, "currency": currency}))
+		regions, currencies, err := svc.FacetCounts(req.Context(), region, currency)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"regions": regions, "currencies": currencies})
+	}).Methods("GET")
+
+	// aggregations are always paged; the default page covers every region
+	aggregate := func(column string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			limit, err := parsePositiveInt(req, "limit", defaultListLimit, maxListLimit)
+			if err != nil {
+				writeParamError(w, err)
+				return
+			}
+			offset, err := parseNonNegativeInt(req, "offset")
+			if err != nil {
+				writeParamError(w, err)
+				return
+			}
+			list, total, err := svc.AggregateCounts(req.Context(), column, limit, offset)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+				return
+			}
+			writePagingHeaders(w, req, total, limit, offset)
+			writeJSON(w, http.StatusOK, list)
+		}
+	}
+	r.HandleFunc("/regions", aggregate("region")).Methods("GET")
+	r.HandleFunc("/currencies", aggregate("currency_code")).Methods("GET")
+
+	r.HandleFunc("/countries/groups", func(w http.ResponseWriter, req *http.Request) {
+		asStrings, err := numbersAsStrings(req, cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid numbers parameter", err.Error())
+			return
+		}
+		q := req.URL.Query()
+		filter := ListFilter{Region: q.Get("region"), Currency: q.Get("currency")}
+		if filter.Region == "" && filter.Currency == "" {
+			writeError(w, http.StatusBadRequest, "Validation failed", map[string]string{"region": "region or currency is required", "currency": "region or currency is required"})
+			return
+		}
+
+		logger.Info("handler: country group", logFields(req.Context(), logger.Fields{"region": filter.Region, "currency": filter.Currency}))
+		stats, err := svc.GroupStatsFor(req.Context(), filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		list, err := svc.GetAll(req.Context(), filter)
+		if err != nil {
+			logger.Error("handler: country group list failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		now := svc.Now()
+		for i := range list {
+			annotate(&list[i], now, cfg)
+		}
+
+		res := map[string]interface{}{
+			"region":           filter.Region,
+			"currency":         filter.Currency,
+			"count":            stats.Count,
+			"total_population": stats.TotalPopulation,
+			"countries":        presentList(list, asStrings),
+		}
+		if !isExcluded(cfg.ExcludedFields, "estimated_gdp") {
+			var totalGDP interface{} = stats.TotalGDP
+			if asStrings {
+				totalGDP = formatDecimal(stats.TotalGDP)
+			}
+			res["total_gdp"] = totalGDP
+			res["gdp_unit"] = cfg.GDP.Unit
+		}
+		writeJSON(w, http.StatusOK, res)
+	}).Methods("GET")
+
+	r.HandleFunc("/countries/image", func(w http.ResponseWriter, req *http.Request) {
+		if svc.imageDisabled != "" {
+			writeError(w, http.StatusServiceUnavailable, svc.imageDisabled, nil)
+			return
+		}
+		path := filepath.FromSlash(summaryImagePath)
+		logger.Info("handler: serve summary image", logFields(req.Context(), logger.Fields{"path": path}))
+		if _, err := os.Stat(path); err != nil {
+			logger.Warn("handler: summary image not found", logFields(req.Context(), logger.Fields{"path": path}))
+			writeError(w, http.StatusNotFound, "Summary image not found", nil)
+			return
+		}
+		http.ServeFile(w, req, path)
+	}).Methods("GET")
+
+	admin.Handle("/countries/image/generate", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if svc.imageDisabled != "" {
+			writeError(w, http.StatusServiceUnavailable, svc.imageDisabled, nil)
+			return
+		}
+		job, err := svc.startImageJob(summaryImagePath)
+		if err != nil {
+			logger.Error("handler: start image job failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		logger.Info("handler: image job started", logFields(req.Context(), logger.Fields{"job_id": job.ID, "remote_addr": req.RemoteAddr}))
+		writeJSON(w, http.StatusAccepted, job)
+	}))).Methods("POST")
 
-		// handler-level structured log: calling refresh service
-		logger.Info("handler: calling Refresh service", logger.Fields{
-			"action":      "countries.refresh",
-			"remote_addr": req.RemoteAddr,
-			"user_agent":  req.UserAgent(),
-			"db_present":  db != nil,
+	r.HandleFunc("/countries/image/status/{id}", func(w http.ResponseWriter, req *http.Request) {
+		id := mux.Vars(req)["id"]
+		job, ok := svc.imageJobs.get(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "Image job not found", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}).Methods("GET")
+
+	// anything else under /countries/image gets the JSON 404 instead of
+	// mux's plain-text one
+	r.PathPrefix("/countries/image/").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		logger.Debug("handler: unknown image resource", logFields(req.Context(), logger.Fields{"path": req.URL.Path, "method": req.Method}))
+		writeError(w, http.StatusNotFound, "Image resource not found", nil)
+	})
+
+	r.HandleFunc("/countries/export", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if f := q.Get("format"); f != "" && f != "csv" {
+			writeError(w, http.StatusBadRequest, "Invalid format", "must be csv")
+			return
+		}
+		filter := ListFilter{
+			Region:   q.Get("region"),
+			Currency: q.Get("currency"),
+			Sort:     q.Get("sort"),
+		}
+		if _, ok := sortOrders[filter.Sort]; filter.Sort != "" && !ok {
+			writeError(w, http.StatusBadRequest, "Invalid sort", sortValuesHint)
+			return
+		}
+
+		logger.Info("handler: export countries", logFields(req.Context(), logger.Fields{"region": filter.Region, "currency": filter.Currency, "sort": filter.Sort, "remote_addr": req.RemoteAddr}))
+		cols := strings.Split(withoutExcluded(strings.Join(allCountryColumns, ","), cfg.ExcludedFields), ",")
+
+		// the response starts with the first row, so a query that fails
+		// up front still gets a 500
+		var out *countryCSV
+		var gz *gzip.Writer
+		start := func() error {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="countries.csv"`)
+			w.Header().Add("Vary", "Accept-Encoding")
+			// exports are compressed whatever GZIP_MIN_SIZE says; the gzip
+			// middleware passes an already encoded response through untouched
+			var body io.Writer = w
+			if middleware.AcceptsGzip(req) {
+				w.Header().Set("Content-Encoding", "gzip")
+				gz = gzip.NewWriter(w)
+				body = gz
+			}
+			w.WriteHeader(http.StatusOK)
+			var err error
+			out, err = newCountryCSV(body, cols)
+			return err
+		}
+		err := svc.EachCountry(req.Context(), filter, func(c *Country) error {
+			if out == nil {
+				if err := start(); err != nil {
+					return err
+				}
+			}
+			redact(c, cfg.ExcludedFields)
+			return out.write(c)
 		})
+		if err != nil && out == nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		if err == nil && out == nil {
+			// no rows: just the header
+			err = start()
+		}
+		if out != nil {
+			if ferr := out.flush(); err == nil {
+				err = ferr
+			}
+		}
+		if gz != nil {
+			if cerr := gz.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			// the status is already sent; the client sees a truncated file
+			logger.Warn("handler: export countries write failed", logFields(req.Context(), logger.WithError(err)))
+		}
+	}).Methods("GET")
 
-		res, err := Refresh(ctx, db)
+	r.HandleFunc("/countries/search", func(w http.ResponseWriter, req *http.Request) {
+		q := strings.TrimSpace(req.URL.Query().Get("q"))
+		if q == "" {
+			writeError(w, http.StatusBadRequest, "Missing q", "must be part of a country name")
+			return
+		}
+		inCapital := false
+		if v := req.URL.Query().Get("capital"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid capital", "must be true or false")
+				return
+			}
+			inCapital = b
+		}
+		limit, err := parsePositiveInt(req, "limit", defaultSearchLimit, maxSearchLimit)
 		if err != nil {
-			// validation error
+			writeParamError(w, err)
+			return
+		}
+		asStrings, err := numbersAsStrings(req, cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid numbers parameter", err.Error())
+			return
+		}
+
+		logger.Info("handler: search countries", logFields(req.Context(), logger.Fields{"q": q, "capital": inCapital, "limit": limit, "remote_addr": req.RemoteAddr}))
+		list, err := svc.SearchCountries(req.Context(), q, inCapital, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		now := svc.Now()
+		for i := range list {
+			annotate(&list[i], now, cfg)
+		}
+		logger.Info("handler: search countries complete", logFields(req.Context(), logger.Fields{"q": q, "count": len(list)}))
+		writeJSON(w, http.StatusOK, presentList(list, asStrings))
+	}).Methods("GET")
+
+	r.HandleFunc("/countries/numeric/{code}", func(w http.ResponseWriter, req *http.Request) {
+		code := mux.Vars(req)["code"]
+		logger.Info("handler: get country by numeric code", logFields(req.Context(), logger.Fields{"numeric_code": code, "remote_addr": req.RemoteAddr}))
+		if !isNumericCode(code) {
+			logger.Debug("handler: invalid numeric code", logFields(req.Context(), logger.Fields{"numeric_code": code}))
+			writeError(w, http.StatusBadRequest, "Invalid numeric code", "must be 1 to 3 digits")
+			return
+		}
+		// ISO 3166-1 numeric codes are zero-padded to three digits (e.g. 004)
+		code = fmt.Sprintf("%03s", code)
+		asStrings, err := numbersAsStrings(req, cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid numbers parameter", err.Error())
+			return
+		}
+
+		c, err := svc.GetByNumericCode(req.Context(), code)
+		if err != nil {
+			if err == ErrNotFound {
+				writeError(w, http.StatusNotFound, "Country not found", nil)
+				return
+			}
+			logger.Error("handler: get country by numeric code failed", logFields(req.Context(), logger.WithError(err)))
+			snap, ok := svc.snapshots.byNumericCode(code)
+			if !ok {
+				writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+				return
+			}
+			w.Header().Set(staleHeader, "true")
+			c = snap
+		}
+		annotate(c, svc.Now(), cfg)
+		logger.Info("handler: get country by numeric code success", logFields(req.Context(), logger.Fields{"name": c.Name, "numeric_code": code}))
+		writeJSON(w, http.StatusOK, presentDetail(&CountryDetail{Country: c}, asStrings))
+	}).Methods("GET")
+
+	r.HandleFunc("/countries/{name}/refresh", func(w http.ResponseWriter, req *http.Request) {
+		name, ok := pathName(w, req)
+		if !ok {
+			return
+		}
+		asStrings, err := numbersAsStrings(req, cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid numbers parameter", err.Error())
+			return
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), cfg.Refresh.Timeout)
+		defer cancel()
+		ctx, ok = ratesParams(ctx, w, req)
+		if !ok {
+			return
+		}
+
+		logger.Info("handler: refresh country", logFields(req.Context(), logger.Fields{"name": name, "remote_addr": req.RemoteAddr}))
+		c, err := svc.RefreshCountry(ctx, name)
+		svc.auditResult(req, AuditRefresh, name, err)
+		if err != nil {
+			if err == ErrNotFound {
+				writeError(w, http.StatusNotFound, "Country not found upstream", nil)
+				return
+			}
 			if verr, ok := err.(*ValidationError); ok {
-				logger.Warn("handler: validation failed", logger.Fields{"errors": verr.Errors})
-				writeError(w, http.StatusBadRequest, "Validation failed", verr.Errors)
+				writeValidationError(w, verr.Errors)
 				return
 			}
-			// external API error
-			if _, ok := err.(ExternalError); ok {
-				logger.Warn("handler: refresh failed - external API", logger.Fields{"error": err.Error()})
-				writeError(w, http.StatusServiceUnavailable, "External data source unavailable", err.Error())
+			if extErr, ok := err.(ExternalError); ok {
+				writeExternalError(w, extErr)
 				return
 			}
-			logger.Error("handler: refresh failed", logger.WithError(err))
+			logger.Error("handler: refresh country failed", logFields(req.Context(), logger.WithError(err)))
 			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
 			return
 		}
-
-		logger.Info("handler: refresh completed", logger.Fields{"total_processed": res.Total, "last_refreshed_at": res.LastRefreshed.Format(time.RFC3339)})
-		writeJSON(w, http.StatusOK, map[string]interface{}{"message": "refreshed", "total": res.Total, "last_refreshed_at": res.LastRefreshed.Format(time.RFC3339)})
+		annotate(c, svc.Now(), cfg)
+		writeJSON(w, http.StatusOK, presentDetail(&CountryDetail{Country: c}, asStrings))
 	}).Methods("POST")
 
-	r.HandleFunc("/countries", func(w http.ResponseWriter, req *http.Request) {
-		// sanitize query keys to defensively handle malformed clients that send
-		// keys like "?currency" (extra '?'). Trim any leading '?' from keys.
-		raw := req.URL.Query()
-		q := make(map[string][]string)
-		for k, v := range raw {
-			nk := strings.TrimLeft(k, "?")
-			q[nk] = v
+	r.HandleFunc("/countries/{name}/rates/history", func(w http.ResponseWriter, req *http.Request) {
+		name, ok := pathName(w, req)
+		if !ok {
+			return
+		}
+		asStrings, err := numbersAsStrings(req, cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid numbers parameter", err.Error())
+			return
 		}
-		// helper to mimic url.Values.Get
-		get := func(key string) string {
-			if vals, ok := q[key]; ok && len(vals) > 0 {
-				return vals[0]
+		q := req.URL.Query()
+		to := svc.Now().UTC()
+		if v := q.Get("to"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid to", "must be an RFC3339 time")
+				return
+			}
+			to = t
+		}
+		from := to.Add(-defaultRateHistoryRange)
+		if v := q.Get("from"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid from", "must be an RFC3339 time")
+				return
 			}
-			return ""
+			from = t
+		}
+		if from.After(to) {
+			writeError(w, http.StatusBadRequest, "Invalid range", "from must not be after to")
+			return
+		}
+		if to.Sub(from) > maxRateHistoryRange {
+			writeError(w, http.StatusBadRequest, "Invalid range", fmt.Sprintf("must span at most %d days", int(maxRateHistoryRange.Hours()/24)))
+			return
+		}
+		limit, err := parsePositiveInt(req, "limit", defaultListLimit, maxListLimit)
+		if err != nil {
+			writeParamError(w, err)
+			return
+		}
+		offset, err := parseNonNegativeInt(req, "offset")
+		if err != nil {
+			writeParamError(w, err)
+			return
 		}
 
-		region := get("region")
-		currency := get("currency")
-		sort := get("sort")
-		logger.Info("handler: listing countries", logger.Fields{"region": region, "currency": currency, "sort": sort})
-		list, err := GetAll(db, region, currency, sort)
+		c, err := svc.GetByName(req.Context(), name)
+		if err == ErrNotFound {
+			writeError(w, http.StatusNotFound, "Country not found", nil)
+			return
+		}
 		if err != nil {
-			logger.Error("get all countries failed", logger.WithError(err))
 			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
 			return
 		}
-		logger.Info("handler: listed countries", logger.Fields{"count": len(list)})
-		writeJSON(w, http.StatusOK, list)
+		res := RateHistory{Name: c.Name, CurrencyCode: c.CurrencyCode, From: api.Time{Time: from.UTC()}, To: api.Time{Time: to.UTC()}, Points: []RatePoint{}}
+		var total int64
+		if c.CurrencyCode != nil {
+			res.Points, total, err = svc.GetRateHistory(*c.CurrencyCode, from, to, limit, offset)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+				return
+			}
+		}
+		logger.Info("handler: rate history", logFields(req.Context(), logger.Fields{"name": c.Name, "points": len(res.Points), "total": total}))
+		writePagingHeaders(w, req, total, limit, offset)
+		writeJSON(w, http.StatusOK, presentRateHistory(&res, asStrings))
 	}).Methods("GET")
 
-	r.HandleFunc("/countries/image", func(w http.ResponseWriter, req *http.Request) {
-		path := filepath.Join("cache", "summary.png")
-		logger.Info("handler: serve summary image", logger.Fields{"path": path})
-		if _, err := os.Stat(path); err != nil {
-			logger.Warn("handler: summary image not found", logger.Fields{"path": path})
-			writeError(w, http.StatusNotFound, "Summary image not found", nil)
+	admin.Handle("/countries/{name}/upstream", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name, ok := pathName(w, req)
+		if !ok {
 			return
 		}
-		http.ServeFile(w, req, path)
-	}).Methods("GET")
+		ctx, cancel := context.WithTimeout(req.Context(), cfg.Refresh.Timeout)
+		defer cancel()
 
-	r.HandleFunc("/countries/{name}", func(w http.ResponseWriter, req *http.Request) {
-		name := mux.Vars(req)["name"]
-		logger.Info("handler: get country by name", logger.Fields{"name": name, "remote_addr": req.RemoteAddr})
-		c, err := GetByName(db, name)
+		logger.Info("handler: fetch upstream country", logFields(req.Context(), logger.Fields{"name": name, "remote_addr": req.RemoteAddr}))
+		res, err := svc.FetchUpstreamCountry(ctx, name)
+		if err != nil {
+			if err == ErrNotFound {
+				writeError(w, http.StatusNotFound, "Country not found upstream", nil)
+				return
+			}
+			if extErr, ok := err.(ExternalError); ok {
+				writeExternalError(w, extErr)
+				return
+			}
+			logger.Error("handler: fetch upstream country failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}))).Methods("GET")
+
+	admin.Handle("/countries/{name}/aliases", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name, ok := pathName(w, req)
+		if !ok {
+			return
+		}
+		var body struct {
+			Aliases []string `json:"aliases"`
+		}
+		if !decodeJSON(w, req, &body) {
+			return
+		}
+		if len(body.Aliases) == 0 {
+			writeValidationError(w, map[string]string{"aliases": "must contain at least one alias"})
+			return
+		}
+
+		c, err := svc.GetByName(req.Context(), name)
 		if err != nil {
 			if err == ErrNotFound {
-				logger.Debug("handler: country not found", logger.Fields{"name": name})
 				writeError(w, http.StatusNotFound, "Country not found", nil)
 				return
 			}
-			logger.Error("handler: get country failed", logger.WithError(err))
 			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
 			return
 		}
-		logger.Info("handler: get country success", logger.Fields{"name": c.Name, "id": c.ID})
-		writeJSON(w, http.StatusOK, c)
-	}).Methods("GET")
+		added, err := svc.AddAliases(c.Name, body.Aliases)
+		svc.auditResult(req, AuditAddAliases, c.Name, err)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"name": c.Name, "aliases": added})
+	}))).Methods("POST")
 
 	r.HandleFunc("/countries/{name}", func(w http.ResponseWriter, req *http.Request) {
-		name := mux.Vars(req)["name"]
-		logger.Info("handler: delete country by name", logger.Fields{"name": name, "remote_addr": req.RemoteAddr})
-		ok, err := DeleteByName(db, name)
+		name, ok := pathName(w, req)
+		if !ok {
+			return
+		}
+		logger.Info("handler: get country by name", logFields(req.Context(), logger.Fields{"name": name, "remote_addr": req.RemoteAddr}))
+		expand, err := parseExpand(req.URL.Query().Get("expand"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid expand parameter", err.Error())
+			return
+		}
+		asStrings, err := numbersAsStrings(req, cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid numbers parameter", err.Error())
+			return
+		}
+		embedFlag := false
+		if v := req.URL.Query().Get("embed_flag"); v != "" {
+			if embedFlag, err = strconv.ParseBool(v); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid embed_flag", "must be true or false")
+				return
+			}
+		}
+		c, err := svc.GetByName(req.Context(), name)
+		stale := false
+		if err != nil {
+			if err == ErrNotFound {
+				logger.Debug("handler: country not found", logFields(req.Context(), logger.Fields{"name": name}))
+				writeError(w, http.StatusNotFound, "Country not found", nil)
+				return
+			}
+			logger.Error("handler: get country failed", logFields(req.Context(), logger.WithError(err)))
+			snap, ok := svc.snapshots.byName(name)
+			if !ok {
+				writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+				return
+			}
+			logger.Warn("handler: serving stale country from memory", logFields(req.Context(), logger.Fields{"name": name}))
+			w.Header().Set(staleHeader, "true")
+			c, stale = snap, true
+		}
+		annotate(c, svc.Now(), cfg)
+		detail := &CountryDetail{Country: c}
+		// gdp_rank is always part of the detail; it stays null without a GDP
+		// (or when estimated_gdp is excluded, which annotate already cleared)
+		if !stale && c.EstimatedGDP != nil {
+			rank, err := svc.GDPRank(req.Context(), *c.EstimatedGDP)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+				return
+			}
+			detail.GDPRank = &rank
+		}
+		for _, e := range expand {
+			// expansions need the database; skip them when serving a snapshot
+			if stale {
+				break
+			}
+			switch e {
+			case expandCurrencyPeers:
+				if c.CurrencyCode == nil {
+					continue
+				}
+				n, err := svc.CountCurrencyPeers(req.Context(), *c.CurrencyCode, c.Name)
+				if err != nil {
+					writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+					return
+				}
+				detail.CurrencyPeers = &n
+			case expandGDPRank:
+				// computed unconditionally above; still accepted so existing
+				// ?expand=gdp_rank links keep working
+			}
+		}
+		if embedFlag && c.FlagURL != nil {
+			// a missing flag shouldn't fail the whole lookup
+			if uri, err := flagDataURI(req.Context(), c, &cfg.Flags); err != nil {
+				logger.Warn("handler: embed flag failed", logFields(req.Context(), logger.Fields{"name": c.Name, "error": err.Error()}))
+			} else {
+				detail.FlagDataURI = &uri
+			}
+		}
+
+		logger.Info("handler: get country success", logFields(req.Context(), logger.Fields{"name": c.Name, "id": c.ID, "expand": expand}))
+		writeJSON(w, http.StatusOK, presentDetail(detail, asStrings))
+	}).Methods("GET")
+
+	admin.Handle("/countries/{name}", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name, ok := pathName(w, req)
+		if !ok {
+			return
+		}
+		asStrings, err := numbersAsStrings(req, cfg)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid numbers parameter", err.Error())
+			return
+		}
+		// only these fields can be corrected; absent ones are cleared
+		var body struct {
+			Capital      *string  `json:"capital"`
+			Region       *string  `json:"region"`
+			Population   int64    `json:"population"`
+			CurrencyCode *string  `json:"currency_code"`
+			ExchangeRate *float64 `json:"exchange_rate"`
+			FlagURL      *string  `json:"flag_url"`
+		}
+		if !decodeJSON(w, req, &body) {
+			return
+		}
+
+		c, err := svc.GetByName(req.Context(), name)
+		if err == ErrNotFound {
+			writeError(w, http.StatusNotFound, "Country not found", nil)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		oldCode := derefString(c.CurrencyCode)
+		c.Capital, c.Region, c.Population = body.Capital, body.Region, body.Population
+		c.CurrencyCode, c.ExchangeRate, c.FlagURL = body.CurrencyCode, body.ExchangeRate, body.FlagURL
+		if err := c.Validate(); err != nil {
+			writeValidationError(w, err.(*ValidationError).Errors)
+			return
+		}
+
+		code := strings.ToUpper(*c.CurrencyCode)
+		c.CurrencyCode = &code
+		if code != oldCode {
+			// the other currencies belonged to the old primary's country data
+			c.CurrencyCodes, c.CurrencyRates = []string{code}, nil
+		}
+		delete(c.CurrencyRates, code)
+		c.EstimatedGDP = nil
+		if c.ExchangeRate != nil {
+			if c.CurrencyRates == nil {
+				c.CurrencyRates = make(map[string]float64)
+			}
+			c.CurrencyRates[code] = *c.ExchangeRate
+			est := estimateGDP(c.Population, *c.ExchangeRate, newGDPRand(&cfg.GDP), &cfg.GDP)
+			c.EstimatedGDP = &est
+		}
+		c.Source = SourceManual
+		c.LastRefreshedAt = api.NewTime(svc.Now())
+
+		logger.Info("handler: update country", logFields(req.Context(), logger.Fields{"name": c.Name, "remote_addr": req.RemoteAddr}))
+		err = svc.UpdateCountry(req.Context(), c)
+		svc.auditResult(req, AuditUpdate, c.Name, err)
 		if err != nil {
-			logger.Error("handler: delete country failed", logger.WithError(err))
 			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
 			return
 		}
+		annotate(c, svc.Now(), cfg)
+		writeJSON(w, http.StatusOK, presentDetail(&CountryDetail{Country: c}, asStrings))
+	}))).Methods("PUT")
+
+	admin.Handle("/countries/{name}", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name, ok := pathName(w, req)
 		if !ok {
-			logger.Debug("handler: delete country not found", logger.Fields{"name": name})
+			return
+		}
+		logger.Info("handler: delete country by name", logFields(req.Context(), logger.Fields{"name": name, "remote_addr": req.RemoteAddr}))
+		deleted, err := svc.DeleteByName(req.Context(), name)
+		if err == nil && !deleted {
+			svc.auditResult(req, AuditDelete, name, ErrNotFound)
+		} else {
+			svc.auditResult(req, AuditDelete, name, err)
+		}
+		if err != nil {
+			logger.Error("handler: delete country failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		if !deleted {
+			logger.Debug("handler: delete country not found", logFields(req.Context(), logger.Fields{"name": name}))
 			writeError(w, http.StatusNotFound, "Country not found", nil)
 			return
 		}
-		logger.Info("handler: delete country success", logger.Fields{"name": name})
+		logger.Info("handler: delete country success", logFields(req.Context(), logger.Fields{"name": name}))
 		writeJSON(w, http.StatusOK, map[string]string{"message": "deleted"})
-	}).Methods("DELETE")
+	}))).Methods("DELETE")
 
 	r.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
-		logger.Info("handler: status check")
-		total, err := TotalCount(db)
+		logger.Info("handler: status check", logFields(req.Context()))
+		if err := svc.PingDB(req.Context()); err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, api.StatusResponse{GDPUnit: cfg.GDP.Unit, DBOK: false})
+			return
+		}
+		total, err := svc.TotalCount(req.Context())
 		if err != nil {
-			logger.Error("status failed", logger.WithError(err))
+			logger.Error("status failed", logFields(req.Context(), logger.WithError(err)))
 			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
 			return
 		}
-		last, err := GetLastRefreshed(db)
+		last, err := svc.GetLastRefreshed()
 		if err != nil {
-			logger.Error("status failed", logger.WithError(err))
+			logger.Error("status failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		base, err := svc.GetRatesBase()
+		if err != nil {
+			logger.Error("status failed", logFields(req.Context(), logger.WithError(err)))
 			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
 			return
 		}
@@ -160,23 +1341,106 @@ func RegisterRoutes(r *mux.Router, db *sql.DB, isProduction bool) {
 			s := last.UTC().Format(time.RFC3339)
 			lastStr = &s
 		}
-		logger.Info("handler: status response", logger.Fields{"total_countries": total, "last_refreshed_at": lastStr})
-		writeJSON(w, http.StatusOK, map[string]interface{}{"total_countries": total, "last_refreshed_at": lastStr})
+		logger.Info("handler: status response", logFields(req.Context(), logger.Fields{"total_countries": total, "last_refreshed_at": lastStr, "rates_base": base}))
+		writeJSON(w, http.StatusOK, api.StatusResponse{TotalCountries: total, LastRefreshedAt: lastStr, GDPUnit: cfg.GDP.Unit, RatesBase: base, DBOK: true})
 	}).Methods("GET")
 
+	admin.Handle("/status/last-refreshed", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		logger.Warn("handler: resetting last_refreshed_at", logFields(req.Context(), logger.Fields{"remote_addr": req.RemoteAddr}))
+		prev, err := svc.ClearLastRefreshed()
+		svc.auditResult(req, AuditResetRefresh, "", err)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		var prevStr *string
+		if prev != nil {
+			s := prev.UTC().Format(time.RFC3339)
+			prevStr = &s
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"message": "last_refreshed_at cleared", "previous_last_refreshed_at": prevStr})
+	}))).Methods("DELETE")
+
+	admin.Handle("/flags/prefetch", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		logger.Info("handler: prefetch flags", logFields(req.Context(), logger.Fields{"remote_addr": req.RemoteAddr, "concurrency": cfg.Flags.PrefetchConcurrency}))
+		res, err := svc.PrefetchFlags(req.Context())
+		svc.auditResult(req, AuditFlagPrefetch, "", err)
+		if err != nil {
+			logger.Error("handler: prefetch flags failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}))).Methods("POST")
+
+	admin.Handle("/audit", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limit, err := parsePositiveInt(req, "limit", 50, maxAuditLimit)
+		if err != nil {
+			writeParamError(w, err)
+			return
+		}
+		offset, err := parseNonNegativeInt(req, "offset")
+		if err != nil {
+			writeParamError(w, err)
+			return
+		}
+
+		entries, err := svc.ListAudit(limit, offset)
+		if err != nil {
+			logger.Error("handler: list audit failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries, "limit": limit, "offset": offset})
+	}))).Methods("GET")
+
+	admin.Handle("/admin/migrate", adminOnly(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		logger.Info("handler: running migrations", logFields(req.Context(), logger.Fields{"remote_addr": req.RemoteAddr}))
+		err := svc.EnsureTables()
+		svc.auditResult(req, AuditMigrate, "", err)
+		if err != nil {
+			logger.Error("handler: migrate failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Migration failed", err.Error())
+			return
+		}
+		version, err := svc.GetSchemaVersion()
+		if err != nil {
+			logger.Error("handler: read schema version failed", logFields(req.Context(), logger.WithError(err)))
+			writeError(w, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+		logger.Info("handler: migrations complete", logFields(req.Context(), logger.Fields{"schema_version": version}))
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message":                 "Migrations applied",
+			"schema_version":          version,
+			"expected_schema_version": SchemaVersion,
+		})
+	}))).Methods("POST")
+
 	if !isProduction {
 		// Drop tables endpoint - BE CAREFUL WITH THIS IN PRODUCTION!
-		r.HandleFunc("/drop-tables", func(w http.ResponseWriter, req *http.Request) {
-			logger.Warn("handler: dropping all tables", logger.Fields{"remote_addr": req.RemoteAddr})
+		admin.Handle("/drop-tables", allowlist(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			confirmation := dropConfirmation(req)
+			logger.Warn("handler: drop tables requested", logFields(req.Context(), logger.Fields{"remote_addr": req.RemoteAddr, "confirmation": confirmation, "allowed": cfg.AllowDropTables}))
+			if !cfg.AllowDropTables {
+				writeError(w, http.StatusForbidden, "Dropping tables is disabled", "set ALLOW_DROP_TABLES=true to enable it")
+				return
+			}
+			if confirmation == "" {
+				writeError(w, http.StatusBadRequest, "Confirmation required", `send X-Confirm-Drop: yes or {"confirm":"DROP"}`)
+				return
+			}
 
-			if err := DropTables(db); err != nil {
-				logger.Error("handler: drop tables failed", logger.WithError(err))
+			err := svc.DropTables()
+			svc.auditResult(req, AuditDropTables, "", err)
+			if err != nil {
+				logger.Error("handler: drop tables failed", logFields(req.Context(), logger.WithError(err)))
 				writeError(w, http.StatusInternalServerError, "Failed to drop tables", nil)
 				return
 			}
 
-			logger.Info("handler: tables dropped successfully")
+			logger.Info("handler: tables dropped successfully", logFields(req.Context()))
 			writeJSON(w, http.StatusOK, map[string]string{"message": "Tables dropped successfully"})
-		}).Methods("POST")
+		}))).Methods("POST")
 	}
 }
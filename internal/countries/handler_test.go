@@ -0,0 +1,317 @@
+package countries
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+func TestMutatingRoutesNeedAPIKey(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	r := newTestRouter(svc)
+
+	routes := []struct{ method, path, body string }{
+		{http.MethodDelete, "/countries", `{"names":["Ghana"]}`},
+		{http.MethodPut, "/countries/Ghana", `{"population":1}`},
+		{http.MethodDelete, "/countries/Ghana", ""},
+		{http.MethodPost, "/countries", `{"name":"Togo"}`},
+		{http.MethodPost, "/countries/recompute-gdp", ""},
+		{http.MethodPost, "/rates/refresh", ""},
+		{http.MethodPost, "/countries/image/generate", ""},
+	}
+	for _, rt := range routes {
+		t.Run(rt.method+" "+rt.path, func(t *testing.T) {
+			req := httptest.NewRequest(rt.method, rt.path, strings.NewReader(rt.body))
+			if rec := serve(r, req); rec.Code != http.StatusUnauthorized {
+				t.Errorf("without a key: status = %d, want 401", rec.Code)
+			}
+		})
+	}
+
+	// nothing was changed by the rejected calls
+	if _, err := svc.GetByName(context.Background(), "Ghana"); err != nil {
+		t.Errorf("Ghana after rejected calls: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/countries", strings.NewReader(`{"names":["Ghana"]}`))
+	req.Header.Set("X-API-Key", testAPIKey)
+	if rec := serve(r, req); rec.Code != http.StatusOK {
+		t.Errorf("with the key: status = %d, want 200 (%s)", rec.Code, rec.Body)
+	}
+}
+
+func TestPathName(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		want   string
+		wantOK bool
+	}{
+		{"plain", "Ghana", "Ghana", true},
+		{"trimmed", "  Ghana\t", "Ghana", true},
+		{"inner spaces kept", " United Kingdom ", "United Kingdom", true},
+		{"empty", "", "", false},
+		{"whitespace only", " \t ", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"name": tt.raw})
+			rec := httptest.NewRecorder()
+			got, ok := pathName(rec, req)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("pathName(%q) = %q, %v; want %q, %v", tt.raw, got, ok, tt.want, tt.wantOK)
+			}
+			if !ok && rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+		})
+	}
+}
+
+func TestBlankNameRoutes(t *testing.T) {
+	svc := newTestService(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("blank name looked up upstream: %s", r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(upstream.Close)
+	svc.CountriesURL = upstream.URL
+	r := newTestRouter(svc)
+
+	for _, path := range []string{"/countries/%20", "/countries/%20%20/rates/history", "/countries/%20/upstream"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", testAPIKey)
+		if rec := serve(r, req); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status = %d, want 400", path, rec.Code)
+		}
+	}
+}
+
+func TestCreateDuplicateIsConflict(t *testing.T) {
+	// the driver error of a concurrent insert that won the race, with no
+	// row visible to a prior existence check
+	f := &fakeDB{execErr: func(query string, args []driver.Value) error {
+		if strings.Contains(query, "INSERT INTO countries") {
+			return &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'Togo' for key 'name'"}
+		}
+		return nil
+	}}
+	svc := newFakeService(t, f)
+	r := newTestRouter(svc)
+
+	req := httptest.NewRequest(http.MethodPost, "/countries",
+		strings.NewReader(`{"name":"Togo","population":8000000,"currency_code":"XOF"}`))
+	req.Header.Set("X-API-Key", testAPIKey)
+	rec := serve(r, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409 (%s)", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "Togo") {
+		t.Errorf("body %s doesn't name the country", rec.Body)
+	}
+}
+
+func TestCreateExistingIsConflict(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	r := newTestRouter(svc)
+
+	req := httptest.NewRequest(http.MethodPost, "/countries",
+		strings.NewReader(`{"name":"Ghana","population":1,"currency_code":"GHS"}`))
+	req.Header.Set("X-API-Key", testAPIKey)
+	if rec := serve(r, req); rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409 (%s)", rec.Code, rec.Body)
+	}
+}
+
+func TestListEmptyStatus(t *testing.T) {
+	tests := []struct {
+		status   int
+		wantBody string
+	}{
+		{http.StatusOK, "[]"},
+		{http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			svc := newTestService(t)
+			svc.Config.ListEmptyStatus = tt.status
+			seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+			r := newTestRouter(svc)
+
+			rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries?region=Europe", nil))
+			if rec.Code != tt.status {
+				t.Fatalf("empty list: status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.wantBody {
+				t.Errorf("empty list: body = %q, want %q", got, tt.wantBody)
+			}
+
+			// a non-empty list is unaffected
+			if rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries?region=Africa", nil)); rec.Code != http.StatusOK {
+				t.Errorf("non-empty list: status = %d, want 200", rec.Code)
+			}
+		})
+	}
+}
+
+func TestListFlagStatus(t *testing.T) {
+	svc := newTestService(t)
+	flagged := func(name, flag string) *Country {
+		c := testCountry(name, "Africa", "XOF", 10, 600)
+		c.FlagURL = &flag
+		return c
+	}
+	seed(t, svc,
+		flagged("Ghana", "https://flagcdn.com/gh.svg"),
+		testCountry("Togo", "Africa", "XOF", 8, 600),
+		flagged("Benin", ""),
+		flagged("Mali", "https://flagcdn.com/ml.svg"),
+	)
+	if err := svc.SetFlagStatus(map[string]bool{"Ghana": true, "Mali": false}); err != nil {
+		t.Fatalf("SetFlagStatus: %v", err)
+	}
+	r := newTestRouter(svc)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"flag_status=missing", []string{"Togo", "Benin"}},
+		{"flag_status=broken", []string{"Mali"}},
+		{"flag_status=missing&region=Europe", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries?"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (%s)", rec.Code, rec.Body)
+			}
+			if got := responseNames(t, rec.Body.Bytes()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries?flag_status=stale", nil)); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown flag_status: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestWriteBodyErrors(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	r := newTestRouter(svc)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantField  string // a field named in the validation details
+	}{
+		{"create malformed", http.MethodPost, "/countries", `{"name":"Togo",`, http.StatusBadRequest, ""},
+		{"create wrong type", http.MethodPost, "/countries", `{"name":"Togo","population":"many"}`, http.StatusBadRequest, ""},
+		{"create invalid", http.MethodPost, "/countries", `{"name":"Togo","population":0,"currency_code":"XOF"}`, http.StatusUnprocessableEntity, "population"},
+		{"create missing currency", http.MethodPost, "/countries", `{"name":"Togo","population":8}`, http.StatusUnprocessableEntity, "currency_code"},
+		{"update malformed", http.MethodPut, "/countries/Ghana", `not json`, http.StatusBadRequest, ""},
+		{"update wrong type", http.MethodPut, "/countries/Ghana", `{"population":[1]}`, http.StatusBadRequest, ""},
+		{"update invalid", http.MethodPut, "/countries/Ghana", `{"population":30,"currency_code":"GHS","exchange_rate":-1}`, http.StatusUnprocessableEntity, "exchange_rate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-API-Key", testAPIKey)
+			rec := serve(r, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var body struct {
+				Error   string          `json:"error"`
+				Details json.RawMessage `json:"details"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error == "" {
+				t.Fatalf("body %s is not a JSON error: %v", rec.Body, err)
+			}
+			if tt.wantField == "" {
+				return
+			}
+			var details map[string]string
+			if err := json.Unmarshal(body.Details, &details); err != nil || details[tt.wantField] == "" {
+				t.Errorf("details %s don't name %s", body.Details, tt.wantField)
+			}
+		})
+	}
+
+	// nothing was written by the rejected bodies
+	c, err := svc.GetByName(context.Background(), "Ghana")
+	if err != nil || c.ExchangeRate == nil || *c.ExchangeRate != 15 {
+		t.Errorf("Ghana after rejected updates = %+v, %v", c, err)
+	}
+	if _, err := svc.GetByName(context.Background(), "Togo"); err != ErrNotFound {
+		t.Errorf("Togo after rejected creates: %v, want ErrNotFound", err)
+	}
+}
+
+func TestCountryStatus(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15), testCountry("Togo", "Africa", "XOF", 8, 600))
+	r := newTestRouter(svc)
+	status := func(body string) *httptest.ResponseRecorder {
+		return serve(r, httptest.NewRequest(http.MethodPost, "/countries/status", strings.NewReader(body)))
+	}
+
+	rec := status(`{"names":["ghana"," Atlantis ","GHANA","","Togo"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (%s)", rec.Code, rec.Body)
+	}
+	var got struct {
+		Countries []struct {
+			Name            string  `json:"name"`
+			Exists          bool    `json:"exists"`
+			LastRefreshedAt *string `json:"last_refreshed_at"`
+		} `json:"countries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	// requested spelling and order, trimmed and de-duplicated
+	want := []struct {
+		name   string
+		exists bool
+	}{{"ghana", true}, {"Atlantis", false}, {"Togo", true}}
+	if len(got.Countries) != len(want) {
+		t.Fatalf("countries = %+v, want %d entries", got.Countries, len(want))
+	}
+	for i, w := range want {
+		c := got.Countries[i]
+		if c.Name != w.name || c.Exists != w.exists {
+			t.Errorf("entry %d = %s exists=%v, want %s exists=%v", i, c.Name, c.Exists, w.name, w.exists)
+		}
+		if w.exists && (c.LastRefreshedAt == nil || *c.LastRefreshedAt != "2025-01-02T03:04:05Z") {
+			t.Errorf("%s last_refreshed_at = %v, want the stored time", c.Name, c.LastRefreshedAt)
+		}
+		if !w.exists && c.LastRefreshedAt != nil {
+			t.Errorf("%s last_refreshed_at = %q, want null", c.Name, *c.LastRefreshedAt)
+		}
+	}
+
+	for _, body := range []string{`{"names":[]}`, `{"names":[" "]}`} {
+		if rec := status(body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("POST %s: status = %d, want 422", body, rec.Code)
+		}
+	}
+	if rec := status(`{"names":"Ghana"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("names not a list: status = %d, want 400", rec.Code)
+	}
+}
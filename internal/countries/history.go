@@ -0,0 +1,210 @@
+package countries
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/api"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// historyColumns are the country_history columns read by loadHistory; they
+// mirror countryColumns minus the ids and server-owned fields
+const historyColumns = `name, capital, region, population, currency_code, currency_codes, exchange_rate, estimated_gdp, flag_url, numeric_code`
+
+// RefreshPoint identifies one recorded refresh
+type RefreshPoint struct {
+	ID          int64    `json:"id"`
+	RefreshedAt api.Time `json:"refreshed_at"`
+}
+
+// RefreshDiff is the changelog between two recorded refreshes
+type RefreshDiff struct {
+	From        RefreshPoint  `json:"from"`
+	To          RefreshPoint  `json:"to"`
+	Appeared    int           `json:"appeared"`
+	Disappeared int           `json:"disappeared"`
+	Changed     int           `json:"changed"`
+	Total       int           `json:"total"`
+	Countries   []CountryDiff `json:"countries"`
+}
+
+// ensureHistory creates the tables holding one snapshot of every country
+// per refresh
+func (s *Service) ensureHistory() error {
+	createRefreshes := `
+    CREATE TABLE IF NOT EXISTS refreshes (
+        id ` + s.Dialect.AutoIncrementPK() + `,
+        refreshed_at DATETIME NOT NULL
+    );`
+	if _, err := s.DB.Exec(createRefreshes); err != nil {
+		logger.Error("repo: create refreshes table failed", logger.WithError(err))
+		return err
+	}
+
+	createHistory := `
+    CREATE TABLE IF NOT EXISTS country_history (
+        refresh_id BIGINT NOT NULL,
+        name VARCHAR(255) NOT NULL,
+        capital VARCHAR(255),
+        region VARCHAR(255),
+        population BIGINT NOT NULL,
+        currency_code VARCHAR(32),
+        currency_codes VARCHAR(255),
+        exchange_rate DOUBLE,
+        estimated_gdp DOUBLE,
+        flag_url VARCHAR(512),
+        numeric_code VARCHAR(3),
+        PRIMARY KEY (refresh_id, name)
+    );`
+	if _, err := s.DB.Exec(createHistory); err != nil {
+		logger.Error("repo: create country_history table failed", logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+// recordHistory stores list as the snapshot of a refresh at t and prunes
+// snapshots beyond the newest keep (0 keeps all). It runs inside the
+// refresh transaction so history never disagrees with the countries table.
+func recordHistory(tx *sql.Tx, t time.Time, list []*Country, keep int) error {
+	res, err := tx.Exec(`INSERT INTO refreshes (refreshed_at) VALUES (?)`, t.UTC())
+	if err != nil {
+		logger.Error("repo: insert refresh failed", logger.WithError(err))
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO country_history (refresh_id, ` + historyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range list {
+		// countryArgs ends with source, last_refreshed_at, area and
+		// currency_rates, which history omits
+		args := append([]interface{}{id}, countryArgs(c)[:10]...)
+		if _, err := stmt.Exec(args...); err != nil {
+			logger.Error("repo: insert country history failed", logger.Fields{"country": c.Name}, logger.WithError(err))
+			return err
+		}
+	}
+
+	if keep > 0 {
+		cutoff := id - int64(keep)
+		if _, err := tx.Exec(`DELETE FROM country_history WHERE refresh_id <= ?`, cutoff); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM refreshes WHERE id <= ?`, cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveRefreshPoint finds a recorded refresh by id, or by RFC3339 time as
+// the latest refresh at or before it. It returns ErrNotFound when none match.
+func (s *Service) ResolveRefreshPoint(v string) (*RefreshPoint, error) {
+	var row *sql.Row
+	if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+		row = s.DB.QueryRow(`SELECT id, refreshed_at FROM refreshes WHERE id = ?`, id)
+	} else {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, err
+		}
+		row = s.DB.QueryRow(`SELECT id, refreshed_at FROM refreshes WHERE refreshed_at <= ? ORDER BY refreshed_at DESC, id DESC LIMIT 1`, t.UTC())
+	}
+
+	var p RefreshPoint
+	var at time.Time
+	if err := row.Scan(&p.ID, &at); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		logger.Error("repo: resolve refresh point failed", logger.Fields{"value": v}, logger.WithError(err))
+		return nil, err
+	}
+	p.RefreshedAt = api.Time{Time: at}
+	return &p, nil
+}
+
+// loadHistory returns the snapshot of refresh id keyed by lowercased name,
+// optionally scoped to one region
+func (s *Service) loadHistory(id int64, region string) (map[string]*Country, error) {
+	q := `SELECT ` + historyColumns + ` FROM country_history WHERE refresh_id = ?`
+	args := []interface{}{id}
+	if region != "" {
+		q += ` AND LOWER(region) = LOWER(?)`
+		args = append(args, region)
+	}
+	rows, err := s.DB.Query(q, args...)
+	if err != nil {
+		logger.Error("repo: load history failed", logger.Fields{"refresh_id": id}, logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := strings.Split(historyColumns, ", ")
+	out := make(map[string]*Country)
+	for rows.Next() {
+		c, err := scanCountryColumns(rows, cols)
+		if err != nil {
+			return nil, err
+		}
+		out[strings.ToLower(c.Name)] = c
+	}
+	return out, rows.Err()
+}
+
+// DiffRefreshes lists the countries that appeared, disappeared or changed
+// between two recorded refreshes, ordered by name and paged by limit/offset.
+// estimated_gdp is ignored since it is randomized on every refresh.
+func (s *Service) DiffRefreshes(from, to *RefreshPoint, region string, limit, offset int) (*RefreshDiff, error) {
+	before, err := s.loadHistory(from.ID, region)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.loadHistory(to.ID, region)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RefreshDiff{From: *from, To: *to, Countries: []CountryDiff{}}
+	var all []CountryDiff
+	for key, c := range after {
+		old, ok := before[key]
+		if !ok {
+			all = append(all, CountryDiff{Name: c.Name, Status: "appeared"})
+			res.Appeared++
+			continue
+		}
+		if changes := diffCountry(old, c); len(changes) > 0 {
+			all = append(all, CountryDiff{Name: c.Name, Status: "changed", Changes: changes})
+			res.Changed++
+		}
+	}
+	for key, c := range before {
+		if _, ok := after[key]; !ok {
+			all = append(all, CountryDiff{Name: c.Name, Status: "disappeared"})
+			res.Disappeared++
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+
+	res.Total = len(all)
+	if offset < len(all) {
+		end := offset + limit
+		if end > len(all) {
+			end = len(all)
+		}
+		res.Countries = all[offset:end]
+	}
+	return res, nil
+}
@@ -1,41 +1,159 @@
 package countries
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"image/color"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fogleman/gg"
+	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/pkg/logger"
 )
 
-// GenerateSummaryImage generates a PNG summary at destPath (e.g., cache/summary.png)
-func GenerateSummaryImage(db *sql.DB, destPath string) error {
-	total, err := TotalCount(db)
+// summaryImagePath is where the summary image is written and served from
+const summaryImagePath = "cache/summary.png"
+
+const summaryFontPath = "/Library/Fonts/Arial.ttf"
+
+// imageDisabledReason says why the image feature is off, or "" when it is
+// available. It turns the feature off when configured so or when the cache
+// directory can't be written (e.g. a read-only filesystem), so the rest of
+// the service keeps working.
+func imageDisabledReason(cfg *config.ImageConfig) string {
+	if !cfg.Enabled {
+		logger.Info("image: summary image disabled by IMAGE_ENABLED")
+		return "image generation disabled by configuration"
+	}
+	dir := filepath.Dir(summaryImagePath)
+	if err := checkWritable(dir); err != nil {
+		logger.Warn("image: cache directory not writable, summary image disabled", logger.Fields{"dir": dir, "error": err.Error()})
+		return "image generation disabled: cache not writable"
+	}
+	return ""
+}
+
+// checkWritable creates dir if needed and proves a file can be written in it
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
 	if err != nil {
 		return err
 	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// minFontScale is how far fitText shrinks a line before truncating it
+const minFontScale = 0.6
+
+// fitText returns s drawn at the largest size between size and
+// size*minFontScale whose width fits maxWidth, leaving that face loaded on
+// dc. Lines that still overflow are truncated with an ellipsis. Without the
+// TTF font gg falls back to a fixed face, so only truncation applies.
+func fitText(dc *gg.Context, s string, maxWidth, size float64) string {
+	for sz := size; sz >= size*minFontScale; sz -= 2 {
+		if dc.LoadFontFace(summaryFontPath, sz) != nil {
+			break
+		}
+		if w, _ := dc.MeasureString(s); w <= maxWidth {
+			return s
+		}
+	}
+	if w, _ := dc.MeasureString(s); w <= maxWidth {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 {
+		r = r[:len(r)-1]
+		t := strings.TrimRight(string(r), " ") + "…"
+		if w, _ := dc.MeasureString(t); w <= maxWidth {
+			return t
+		}
+	}
+	return ""
+}
+
+// gdpEntry is one bar of the summary chart
+type gdpEntry struct {
+	Name string
+	GDP  float64
+}
 
-	// get top 5 by estimated_gdp
-	q := `SELECT name, estimated_gdp FROM countries WHERE estimated_gdp IS NOT NULL ORDER BY estimated_gdp DESC LIMIT 5`
-	rows, err := db.Query(q)
+// topGDP returns up to n countries by descending estimated GDP. Countries
+// without one (NULL) are never ranked; with stddevs > 0 those further than
+// that many standard deviations from the mean are left out as well.
+func (s *Service) topGDP(n int, stddevs float64) ([]gdpEntry, error) {
+	// with the outlier filter on we need every value to compute the mean
+	// and standard deviation
+	q := `SELECT name, estimated_gdp FROM countries WHERE estimated_gdp IS NOT NULL ORDER BY estimated_gdp DESC, id ASC`
+	args := []interface{}{}
+	if stddevs <= 0 {
+		q += ` LIMIT ?`
+		args = append(args, n)
+	}
+	rows, err := s.DB.Query(q, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 
-	type entry struct {
-		Name string
-		GDP  float64
-	}
-	var top []entry
+	var all []gdpEntry
 	for rows.Next() {
-		var e entry
+		var e gdpEntry
 		if err := rows.Scan(&e.Name, &e.GDP); err != nil {
+			return nil, err
+		}
+		all = append(all, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	gdps := make([]float64, len(all))
+	for i, e := range all {
+		gdps[i] = e.GDP
+	}
+	kept := withinStdDevs(gdps, stddevs)
+	var top []gdpEntry
+	for _, i := range kept {
+		if len(top) == n {
+			break
+		}
+		top = append(top, all[i])
+	}
+	if dropped := len(all) - len(kept); dropped > 0 {
+		logger.Info("image: excluded GDP outliers from summary", logger.Fields{"excluded": dropped, "stddevs": stddevs})
+	}
+	return top, nil
+}
+
+// GenerateSummaryImage generates a PNG summary at destPath (e.g., cache/summary.png)
+func (s *Service) GenerateSummaryImage(destPath string) error {
+	cfg := &s.Config.Image
+	// runs in the background, after the request that triggered it is gone
+	ctx := context.Background()
+	total, err := s.TotalCount(ctx)
+	if err != nil {
+		return err
+	}
+
+	top, err := s.topGDP(5, cfg.OutlierStdDevs)
+	if err != nil {
+		return err
+	}
+
+	// optional secondary panel with the most common currencies
+	var currencies []CurrencyCount
+	if cfg.ShowCurrencyCounts {
+		currencies, err = s.CurrencyCounts(ctx, 5)
+		if err != nil {
 			return err
 		}
-		top = append(top, e)
 	}
 
 	// create canvas
@@ -47,19 +165,36 @@ func GenerateSummaryImage(db *sql.DB, destPath string) error {
 
 	// header
 	dc.SetRGB(0, 0, 0)
-	if err := dc.LoadFontFace("/Library/Fonts/Arial.ttf", 28); err != nil {
-		// ignore font load error; gg has fallback
+	header := fitText(dc, fmt.Sprintf("Countries Summary (total: %d)", total), W-40, cfg.HeaderFontSize)
+	dc.DrawStringAnchored(header, W/2, 60, 0.5, 0.5)
+
+	// lines must stay inside their column; the left one is narrower when
+	// the currency column is drawn
+	leftWidth := float64(W - 120)
+	if cfg.ShowCurrencyCounts {
+		leftWidth = W/2 - 80
 	}
-	dc.DrawStringAnchored(fmt.Sprintf("Countries Summary (total: %d)", total), W/2, 60, 0.5, 0.5)
 
 	// list top5
 	y := 120.0
 	for i, e := range top {
 		line := fmt.Sprintf("%d. %s — %.2f", i+1, e.Name, e.GDP)
-		dc.DrawStringAnchored(line, 60, y, 0, 0.5)
+		dc.DrawStringAnchored(fitText(dc, line, leftWidth, cfg.TextFontSize), 60, y, 0, 0.5)
 		y += 40
 	}
 
+	// list top currencies in the right column
+	if cfg.ShowCurrencyCounts {
+		const rightWidth = W/2 - 120
+		dc.DrawStringAnchored(fitText(dc, "Top currencies", rightWidth, cfg.TextFontSize), W/2+60, 120, 0, 0.5)
+		y = 160.0
+		for _, cc := range currencies {
+			line := fmt.Sprintf("%s — %d countries", cc.CurrencyCode, cc.Count)
+			dc.DrawStringAnchored(fitText(dc, line, rightWidth, cfg.TextFontSize), W/2+60, y, 0, 0.5)
+			y += 40
+		}
+	}
+
 	// ensure directory
 	dir := filepath.Dir(destPath)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -0,0 +1,111 @@
+package countries
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/api"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// image job states
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// finished jobs are forgotten after this long
+const imageJobRetention = time.Hour
+
+// ImageJob tracks an asynchronous summary image generation
+type ImageJob struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  api.Time  `json:"created_at"`
+	FinishedAt *api.Time `json:"finished_at,omitempty"`
+}
+
+// imageJobStore holds job state shared between the generate and status handlers
+type imageJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*ImageJob
+}
+
+// startImageJob registers a new job and renders the image in the background
+func (s *Service) startImageJob(destPath string) (ImageJob, error) {
+	id, err := newJobID()
+	if err != nil {
+		return ImageJob{}, err
+	}
+
+	jobs := s.imageJobs
+	job := &ImageJob{ID: id, Status: JobPending, CreatedAt: api.Time{Time: time.Now().UTC()}}
+	jobs.mu.Lock()
+	jobs.pruneLocked()
+	jobs.jobs[id] = job
+	snapshot := *job
+	jobs.mu.Unlock()
+
+	s.goBackground(func() {
+		jobs.update(id, func(j *ImageJob) { j.Status = JobRunning })
+		err := s.GenerateSummaryImage(destPath)
+		jobs.update(id, func(j *ImageJob) {
+			j.FinishedAt = api.NewTime(time.Now().UTC())
+			if err != nil {
+				j.Status = JobFailed
+				j.Error = err.Error()
+				return
+			}
+			j.Status = JobDone
+		})
+		if err != nil {
+			logger.Warn("image job failed", logger.Fields{"job_id": id}, logger.WithError(err))
+		} else {
+			logger.Info("image job completed", logger.Fields{"job_id": id})
+		}
+	})
+
+	return snapshot, nil
+}
+
+// get returns a copy of the job so callers never race with the worker
+func (s *imageJobStore) get(id string) (ImageJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return ImageJob{}, false
+	}
+	return *job, true
+}
+
+func (s *imageJobStore) update(id string, fn func(*ImageJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+// pruneLocked drops finished jobs past the retention window; s.mu must be held
+func (s *imageJobStore) pruneLocked() {
+	cutoff := time.Now().Add(-imageJobRetention)
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
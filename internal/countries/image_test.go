@@ -0,0 +1,125 @@
+package countries
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+)
+
+func TestFitText(t *testing.T) {
+	dc := gg.NewContext(800, 600)
+	long := "The United Kingdom of Great Britain and Northern Ireland"
+	full, _ := dc.MeasureString(long)
+
+	tests := []struct {
+		name     string
+		s        string
+		maxWidth float64
+		want     string // "" checks truncation instead
+	}{
+		{"fits", "Ghana", full, "Ghana"},
+		{"long name fits exactly", long, full, long},
+		{"long name truncated", long, full / 2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fitText(dc, tt.s, tt.maxWidth, 28)
+			if w, _ := dc.MeasureString(got); w > tt.maxWidth {
+				t.Errorf("fitText(%q) = %q, %.0fpx wide, over %.0fpx", tt.s, got, w, tt.maxWidth)
+			}
+			if tt.want != "" {
+				if got != tt.want {
+					t.Errorf("fitText(%q) = %q, want it unchanged", tt.s, got)
+				}
+				return
+			}
+			prefix := strings.TrimSuffix(got, "…")
+			if prefix == got || prefix == "" || !strings.HasPrefix(tt.s, prefix) {
+				t.Errorf("fitText(%q) = %q, want a prefix of it with an ellipsis", tt.s, got)
+			}
+		})
+	}
+
+	if got := fitText(dc, long, 1, 28); got != "" {
+		t.Errorf("fitText with no room = %q, want empty", got)
+	}
+}
+
+func TestSummaryImageLongName(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry("The United Kingdom of Great Britain and Northern Ireland", "Europe", "GBP", 67, 0.8),
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+	)
+	dest := filepath.Join(t.TempDir(), "summary.png")
+	if err := svc.GenerateSummaryImage(dest); err != nil {
+		t.Fatalf("GenerateSummaryImage: %v", err)
+	}
+	if fi, err := os.Stat(dest); err != nil || fi.Size() == 0 {
+		t.Errorf("summary image not written: %v", err)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkWritable(filepath.Join(dir, "cache")); err != nil {
+		t.Errorf("fresh dir: %v", err)
+	}
+
+	// a file where the directory should be fails even for root
+	blocker := filepath.Join(dir, "blocked")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWritable(filepath.Join(blocker, "cache")); err == nil {
+		t.Error("dir under a file: no error")
+	}
+
+	if os.Geteuid() == 0 {
+		t.Log("running as root; skipping the read-only permission case")
+		return
+	}
+	readOnly := filepath.Join(dir, "read-only")
+	if err := os.Mkdir(readOnly, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWritable(readOnly); err == nil {
+		t.Error("read-only dir: no error")
+	}
+}
+
+func TestImageDisabledWhenCacheNotWritable(t *testing.T) {
+	// the cache dir is relative to the working directory; make "cache" a file
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("cache", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := newTestService(t)
+	svc.Config.Image.Enabled = true
+	if reason := imageDisabledReason(&svc.Config.Image); !strings.Contains(reason, "not writable") {
+		t.Fatalf("imageDisabledReason = %q, want the cache reported not writable", reason)
+	}
+	svc = NewService(svc.DB, svc.Config, svc.Dialect)
+	r := newTestRouter(svc)
+
+	if rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries/image", nil)); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /countries/image = %d, want 503", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/countries/image/generate", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	if rec := serve(r, req); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST /countries/image/generate = %d, want 503", rec.Code)
+	}
+
+	// rendering straight into the unwritable path errors rather than panics
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	if err := svc.GenerateSummaryImage(summaryImagePath); err == nil {
+		t.Error("GenerateSummaryImage into a file path: no error")
+	}
+}
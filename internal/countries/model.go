@@ -1,46 +1,142 @@
 package countries
 
-import "time"
+import (
+	"time"
 
-// ValidationError represents field-level validation errors
-type ValidationError struct {
-	Errors map[string]string `json:"details"`
-}
+	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/pkg/api"
+)
 
-func (v *ValidationError) Error() string {
-	return "Validation failed"
-}
+// ValidationError and Country live in pkg/api so pkg/client can share them
+type (
+	ValidationError = api.ValidationError
+	Country         = api.Country
+)
 
-// Country represents a country record stored in the DB and returned by the API
-type Country struct {
-	ID              int64      `json:"id"`
-	Name            string     `json:"name"`
-	Capital         *string    `json:"capital,omitempty"`
-	Region          *string    `json:"region,omitempty"`
-	Population      int64      `json:"population"`
-	CurrencyCode    *string    `json:"currency_code,omitempty"`
-	ExchangeRate    *float64   `json:"exchange_rate,omitempty"`
-	EstimatedGDP    *float64   `json:"estimated_gdp,omitempty"`
-	FlagURL         *string    `json:"flag_url,omitempty"`
-	LastRefreshedAt *time.Time `json:"last_refreshed_at,omitempty"`
+// annotateRateAge sets how old the stored exchange rate of c is and whether
+// it is older than staleAfter. Countries without a rate are left untouched.
+func annotateRateAge(c *Country, now time.Time, staleAfter time.Duration) {
+	if c.ExchangeRate == nil || c.LastRefreshedAt == nil {
+		return
+	}
+	age := now.Sub(c.LastRefreshedAt.Time)
+	secs := int64(age.Seconds())
+	stale := age > staleAfter
+	c.RateAgeSeconds = &secs
+	c.RateStale = &stale
 }
 
-// Validate ensures required fields are present and valid
-func (c *Country) Validate() error {
-	errors := make(map[string]string)
+// densityExpr is population_density in SQL, NULL without a positive area
+const densityExpr = "(CASE WHEN area > 0 THEN population / area END)"
 
-	if c.Name == "" {
-		errors["name"] = "is required"
+// annotateDensity sets population_density from population and area, leaving
+// it null when the area is missing or zero
+func annotateDensity(c *Country) {
+	if c.Area == nil || *c.Area <= 0 {
+		return
 	}
-	if c.Population <= 0 {
-		errors["population"] = "must be positive"
+	d := float64(c.Population) / *c.Area
+	c.PopulationDensity = &d
+}
+
+// annotate fills in the computed response fields of c, then hides the
+// fields the operator excluded from public responses
+func annotate(c *Country, now time.Time, cfg *config.Config) {
+	annotateRateAge(c, now, cfg.RateStaleAfter)
+	annotateDensity(c)
+	if cfg.CurrencySymbols {
+		annotateCurrencySymbol(c)
 	}
-	if c.CurrencyCode == nil || *c.CurrencyCode == "" {
-		errors["currency_code"] = "is required"
+	if c.EstimatedGDP != nil {
+		unit := cfg.GDP.Unit
+		c.GDPUnit = &unit
 	}
+	redact(c, cfg.ExcludedFields)
+}
 
-	if len(errors) > 0 {
-		return &ValidationError{Errors: errors}
-	}
-	return nil
+// Country sources record which write path produced a row
+const (
+	SourceRefresh = "refresh"
+	SourceManual  = "manual"
+	SourceImport  = "import"
+)
+
+// isValidSource reports whether s is one of the known sources
+func isValidSource(s string) bool {
+	return s == SourceRefresh || s == SourceManual || s == SourceImport
+}
+
+// ListFilter holds the optional filters and sort accepted by GetAll. It is
+// used as a map key by the snapshot store, so keep every field comparable
+// by value (no pointers or slices).
+type ListFilter struct {
+	Region   string
+	Currency string
+	Source   string
+	// HasFlag is "true", "false" or "" (no filter)
+	HasFlag string
+	// FlagStatus is FlagStatusMissing, FlagStatusBroken or "" (no filter)
+	FlagStatus string
+	// MinGDP and MaxGDP are validated decimal strings ("" = unbounded).
+	// Rows without an estimated GDP never match a bound.
+	MinGDP string
+	MaxGDP string
+	// MinPopulation and MaxPopulation are validated integer strings
+	// ("" = unbounded)
+	MinPopulation string
+	MaxPopulation string
+	// ModifiedSince keeps rows refreshed after this instant (zero = no filter)
+	ModifiedSince time.Time
+	Sort          string
+	// Fields is a validated, comma-separated column list from parseFields
+	// ("" selects every column)
+	Fields string
+	// Limit and Offset page the result; Limit 0 returns every row
+	Limit  int
+	Offset int
+}
+
+// ?flag_status= values: no flag_url at all, or a flag_url whose last
+// prefetch failed
+const (
+	FlagStatusMissing = "missing"
+	FlagStatusBroken  = "broken"
+)
+
+// CountryDetail is a Country with optional computed fields requested via expand
+type CountryDetail struct {
+	*Country
+	CurrencyPeers *int64 `json:"currency_peers,omitempty"`
+	// GDPRank is 1 + the number of countries with a higher estimated_gdp
+	// (ties share a rank); null when the country has no GDP
+	GDPRank *int64 `json:"gdp_rank"`
+	// FlagDataURI is set by ?embed_flag=true when the flag could be loaded
+	FlagDataURI *string `json:"flag_data_uri,omitempty"`
+}
+
+// GroupStats aggregates the countries matched by a filter. TotalGDP is nil
+// when none of them has an estimated GDP.
+type GroupStats struct {
+	Count           int64    `json:"count"`
+	TotalPopulation int64    `json:"total_population"`
+	TotalGDP        *float64 `json:"total_gdp"`
+}
+
+// CurrencyCount is the number of countries using a currency
+type CurrencyCount struct {
+	CurrencyCode string `json:"currency_code"`
+	Count        int64  `json:"count"`
+}
+
+// CountryStatus is one entry of POST /countries/status
+type CountryStatus struct {
+	Name            string    `json:"name"`
+	Exists          bool      `json:"exists"`
+	LastRefreshedAt *api.Time `json:"last_refreshed_at"`
+}
+
+// AggregateCount is one row of the /regions and /currencies aggregations
+type AggregateCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
 }
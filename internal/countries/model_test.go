@@ -0,0 +1,85 @@
+package countries
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// withArea returns a test country with the given area; nil leaves it unknown
+func withArea(name string, population int64, area *float64) *Country {
+	c := testCountry(name, "Africa", "XOF", population, 600)
+	c.Area = area
+	return c
+}
+
+func TestAnnotateDensity(t *testing.T) {
+	tests := []struct {
+		name string
+		area *float64
+		want *float64
+	}{
+		{"positive area", ptr(20), ptr(5)},
+		{"null area", nil, nil},
+		{"zero area", ptr(0), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := withArea("Togo", 100, tt.area)
+			annotateDensity(c)
+			if !equalFloatPtr(c.PopulationDensity, tt.want) {
+				t.Errorf("density = %v, want %v", fmtPtr(c.PopulationDensity), fmtPtr(tt.want))
+			}
+		})
+	}
+}
+
+func TestDensityNullAndZeroArea(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		withArea("Togo", 100, ptr(20)),   // 5
+		withArea("Benin", 100, nil),      // unknown
+		withArea("Mali", 100, ptr(10)),   // 10
+		withArea("Niger", 100, ptr(0)),   // unknown
+		withArea("Ghana", 100, ptr(100)), // 1
+	)
+
+	// rows without a density sort as NULL (lowest), ties in id order
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"density_desc", []string{"Mali", "Togo", "Ghana", "Benin", "Niger"}},
+		{"density_asc", []string{"Benin", "Niger", "Ghana", "Togo", "Mali"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			list, err := svc.GetAll(context.Background(), ListFilter{Sort: tt.sort})
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+			if got := names(list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sorted %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	rec := serve(newTestRouter(svc), httptest.NewRequest(http.MethodGet, "/countries", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+	}
+	var body []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := map[string]interface{}{"Togo": 5.0, "Benin": nil, "Mali": 10.0, "Niger": nil, "Ghana": 1.0}
+	for _, c := range body {
+		name := c["name"].(string)
+		if got := c["population_density"]; got != want[name] {
+			t.Errorf("%s population_density = %v, want %v", name, got, want[name])
+		}
+	}
+}
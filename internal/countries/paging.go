@@ -0,0 +1,54 @@
+package countries
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultListLimit and maxListLimit bound ?limit= on GET /countries and the
+// /regions and /currencies aggregations
+const (
+	defaultListLimit = 50
+	maxListLimit     = 250
+)
+
+// isPaged reports whether the caller asked for a page rather than the full list
+func isPaged(req *http.Request) bool {
+	q := req.URL.Query()
+	return q.Get("limit") != "" || q.Get("offset") != ""
+}
+
+// writePagingHeaders sets X-Total-Count and an RFC 5988 Link header with
+// first/prev/next/last relations built from the current request URL
+func writePagingHeaders(w http.ResponseWriter, req *http.Request, total int64, limit, offset int) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	link := func(rel string, off int) string {
+		q := req.URL.Query()
+		q.Set("limit", strconv.Itoa(limit))
+		q.Set("offset", strconv.Itoa(off))
+		u := url.URL{Path: req.URL.Path, RawQuery: q.Encode()}
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+	}
+
+	last := 0
+	if total > 0 {
+		last = int((total - 1) / int64(limit) * int64(limit))
+	}
+	links := []string{link("first", 0)}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link("prev", prev))
+	}
+	if int64(offset+limit) < total {
+		links = append(links, link("next", offset+limit))
+	}
+	links = append(links, link("last", last))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,256 @@
+package countries
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// linkRel matches one `<url>; rel="name"` entry of a Link header
+var linkRel = regexp.MustCompile(`<([^>]*)>; rel="([a-z]+)"`)
+
+// parseLinks maps each relation of a Link header to its URL
+func parseLinks(t *testing.T, header string) map[string]string {
+	t.Helper()
+	links := make(map[string]string)
+	for _, m := range linkRel.FindAllStringSubmatch(header, -1) {
+		links[m[2]] = m[1]
+	}
+	return links
+}
+
+func TestPagingLinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int
+		want   map[string]string
+	}{
+		{"first page", 0, map[string]string{
+			"first": "/countries?limit=2&offset=0&region=Africa",
+			"next":  "/countries?limit=2&offset=2&region=Africa",
+			"last":  "/countries?limit=2&offset=4&region=Africa",
+		}},
+		{"middle page", 2, map[string]string{
+			"first": "/countries?limit=2&offset=0&region=Africa",
+			"prev":  "/countries?limit=2&offset=0&region=Africa",
+			"next":  "/countries?limit=2&offset=4&region=Africa",
+			"last":  "/countries?limit=2&offset=4&region=Africa",
+		}},
+		{"last page", 4, map[string]string{
+			"first": "/countries?limit=2&offset=0&region=Africa",
+			"prev":  "/countries?limit=2&offset=2&region=Africa",
+			"last":  "/countries?limit=2&offset=4&region=Africa",
+		}},
+		{"offset off the grid", 3, map[string]string{
+			"first": "/countries?limit=2&offset=0&region=Africa",
+			"prev":  "/countries?limit=2&offset=1&region=Africa",
+			"last":  "/countries?limit=2&offset=4&region=Africa",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/countries?region=Africa&limit=2", nil)
+			rec := httptest.NewRecorder()
+			writePagingHeaders(rec, req, 5, 2, tt.offset)
+
+			if got := rec.Header().Get("X-Total-Count"); got != "5" {
+				t.Errorf("X-Total-Count = %q, want 5", got)
+			}
+			got := parseLinks(t, rec.Header().Get("Link"))
+			if len(got) != len(tt.want) {
+				t.Errorf("relations = %v, want %v", got, tt.want)
+			}
+			for rel, want := range tt.want {
+				if got[rel] != want {
+					t.Errorf("rel=%s = %q, want %q", rel, got[rel], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPagingLinksEmpty(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/countries?limit=10", nil)
+	rec := httptest.NewRecorder()
+	writePagingHeaders(rec, req, 0, 10, 0)
+
+	got := parseLinks(t, rec.Header().Get("Link"))
+	if _, ok := got["next"]; ok {
+		t.Errorf("next on an empty list: %v", got)
+	}
+	if _, ok := got["prev"]; ok {
+		t.Errorf("prev on the first page: %v", got)
+	}
+	if got["last"] != "/countries?limit=10&offset=0" {
+		t.Errorf("rel=last = %q, want offset 0", got["last"])
+	}
+}
+
+func TestListLinkHeader(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry("Benin", "Africa", "XOF", 10, 600),
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+		testCountry("Kenya", "Africa", "KES", 50, 130),
+		testCountry("Togo", "Africa", "XOF", 8, 600),
+		testCountry("Peru", "Americas", "PEN", 33, 3.7),
+	)
+	r := newTestRouter(svc)
+
+	rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries?region=Africa&sort=name_asc&limit=2&offset=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("X-Total-Count"); got != "4" {
+		t.Errorf("X-Total-Count = %q, want 4", got)
+	}
+	links := parseLinks(t, rec.Header().Get("Link"))
+	want := map[string]string{
+		"first": "/countries?limit=2&offset=0&region=Africa&sort=name_asc",
+		"prev":  "/countries?limit=2&offset=0&region=Africa&sort=name_asc",
+		"last":  "/countries?limit=2&offset=2&region=Africa&sort=name_asc",
+	}
+	if len(links) != len(want) {
+		t.Errorf("relations = %v, want %v", links, want)
+	}
+	for rel, w := range want {
+		if links[rel] != w {
+			t.Errorf("rel=%s = %q, want %q", rel, links[rel], w)
+		}
+	}
+
+	// an unpaged list carries neither header
+	rec = serve(r, httptest.NewRequest(http.MethodGet, "/countries", nil))
+	if rec.Header().Get("Link") != "" || rec.Header().Get("X-Total-Count") != "" {
+		t.Errorf("unpaged list has paging headers: %v", rec.Header())
+	}
+}
+
+func TestAggregatePaging(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+		testCountry("Togo", "Africa", "XOF", 8, 600),
+		testCountry("Benin", "Africa", "XOF", 12, 600),
+		testCountry("France", "Europe", "EUR", 60, 0.9),
+		testCountry("Spain", "Europe", "EUR", 48, 0.9),
+		testCountry("Japan", "Asia", "JPY", 125, 150),
+	)
+	r := newTestRouter(svc)
+
+	tests := []struct {
+		path      string
+		want      []AggregateCount
+		wantTotal string
+		wantLinks map[string]string
+	}{
+		{"/regions?limit=2", []AggregateCount{{"Africa", 3}, {"Europe", 2}}, "3", map[string]string{
+			"first": "/regions?limit=2&offset=0",
+			"next":  "/regions?limit=2&offset=2",
+			"last":  "/regions?limit=2&offset=2",
+		}},
+		{"/regions?limit=2&offset=2", []AggregateCount{{"Asia", 1}}, "3", map[string]string{
+			"first": "/regions?limit=2&offset=0",
+			"prev":  "/regions?limit=2&offset=0",
+			"last":  "/regions?limit=2&offset=2",
+		}},
+		// ties on count are ordered by name
+		{"/currencies?limit=2&offset=1", []AggregateCount{{"XOF", 2}, {"GHS", 1}}, "4", map[string]string{
+			"first": "/currencies?limit=2&offset=0",
+			"prev":  "/currencies?limit=2&offset=0",
+			"next":  "/currencies?limit=2&offset=3",
+			"last":  "/currencies?limit=2&offset=2",
+		}},
+		{"/currencies?offset=10", []AggregateCount{}, "4", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (%s)", rec.Code, rec.Body)
+			}
+			var got []AggregateCount
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("page = %v, want %v", got, tt.want)
+			}
+			if total := rec.Header().Get("X-Total-Count"); total != tt.wantTotal {
+				t.Errorf("X-Total-Count = %q, want %s", total, tt.wantTotal)
+			}
+			links := parseLinks(t, rec.Header().Get("Link"))
+			for rel, want := range tt.wantLinks {
+				if links[rel] != want {
+					t.Errorf("rel=%s = %q, want %q", rel, links[rel], want)
+				}
+			}
+			if tt.wantLinks != nil && len(links) != len(tt.wantLinks) {
+				t.Errorf("relations = %v, want %v", links, tt.wantLinks)
+			}
+		})
+	}
+
+	for _, path := range []string{"/regions?limit=0", "/currencies?offset=-1"} {
+		if rec := serve(r, httptest.NewRequest(http.MethodGet, path, nil)); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status = %d, want 400", path, rec.Code)
+		}
+	}
+}
+
+func TestListOverflow(t *testing.T) {
+	tests := []struct {
+		mode       string
+		path       string
+		wantStatus int
+		wantPaged  bool
+	}{
+		{"reject", "/countries", http.StatusRequestEntityTooLarge, false},
+		{"reject", "/countries?region=Europe", http.StatusOK, false},
+		{"reject", "/countries?limit=2", http.StatusOK, true},
+		{"limit", "/countries", http.StatusOK, true},
+		{"limit", "/countries?region=Europe", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.path, func(t *testing.T) {
+			svc := newTestService(t)
+			svc.Config.ListMaxRows = 2
+			svc.Config.ListOverflow = tt.mode
+			seed(t, svc,
+				testCountry("Ghana", "Africa", "GHS", 30, 15),
+				testCountry("Togo", "Africa", "XOF", 8, 600),
+				testCountry("France", "Europe", "EUR", 60, 0.9),
+			)
+
+			rec := serve(newTestRouter(svc), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusRequestEntityTooLarge {
+				var body struct {
+					Details map[string]int64 `json:"details"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Details["total"] != 3 || body.Details["max_rows"] != 2 {
+					t.Errorf("413 body = %s, want total 3 and max_rows 2", rec.Body)
+				}
+				return
+			}
+			if got := rec.Header().Get("X-Total-Count") != ""; got != tt.wantPaged {
+				t.Errorf("paging headers sent = %v, want %v", got, tt.wantPaged)
+			}
+			// only the overflow sets the header; an explicit limit doesn't
+			wantApplied := tt.mode == "limit" && tt.wantPaged
+			if got := rec.Header().Get("X-Pagination-Applied") == "true"; got != wantApplied {
+				t.Errorf("X-Pagination-Applied = %v, want %v", got, wantApplied)
+			}
+			if wantApplied {
+				if first := parseLinks(t, rec.Header().Get("Link"))["first"]; first != "/countries?limit=50&offset=0" {
+					t.Errorf("rel=first = %q, want the default page size", first)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package countries
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// parsePositiveInt reads a count parameter such as limit, top or n. A missing
+// value yields def and values above max are clamped to max. Non-numeric,
+// zero or negative values are rejected so every endpoint answers the same
+// 400 for bad counts.
+func parsePositiveInt(req *http.Request, param string, def, max int) (int, error) {
+	v := req.URL.Query().Get(param)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", param)
+	}
+	if n > max {
+		return max, nil
+	}
+	return n, nil
+}
+
+// parseNonNegativeInt reads an offset-style parameter, defaulting to 0
+func parseNonNegativeInt(req *http.Request, param string) (int, error) {
+	v := req.URL.Query().Get(param)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", param)
+	}
+	return n, nil
+}
+
+// parseGDPRange reads min_gdp/max_gdp as non-negative numbers, rejecting
+// min > max, and returns them normalized for use in a ListFilter
+func parseGDPRange(req *http.Request) (min, max string, err error) {
+	bounds := make(map[string]float64)
+	for _, param := range []string{"min_gdp", "max_gdp"} {
+		v := req.URL.Query().Get(param)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", "", fmt.Errorf("%s must be a non-negative number", param)
+		}
+		bounds[param] = f
+	}
+	lo, hasMin := bounds["min_gdp"]
+	hi, hasMax := bounds["max_gdp"]
+	if hasMin && hasMax && lo > hi {
+		return "", "", fmt.Errorf("min_gdp must not be greater than max_gdp")
+	}
+	if hasMin {
+		min = strconv.FormatFloat(lo, 'f', -1, 64)
+	}
+	if hasMax {
+		max = strconv.FormatFloat(hi, 'f', -1, 64)
+	}
+	return min, max, nil
+}
+
+// parsePopulationRange reads min_population/max_population as non-negative
+// integers, rejecting min > max, and returns them normalized for use in a
+// ListFilter
+func parsePopulationRange(req *http.Request) (min, max string, err error) {
+	bounds := make(map[string]int64)
+	for _, param := range []string{"min_population", "max_population"} {
+		v := req.URL.Query().Get(param)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return "", "", fmt.Errorf("%s must be a non-negative integer", param)
+		}
+		bounds[param] = n
+	}
+	lo, hasMin := bounds["min_population"]
+	hi, hasMax := bounds["max_population"]
+	if hasMin && hasMax && lo > hi {
+		return "", "", fmt.Errorf("min_population must not be greater than max_population")
+	}
+	if hasMin {
+		min = strconv.FormatInt(lo, 10)
+	}
+	if hasMax {
+		max = strconv.FormatInt(hi, 10)
+	}
+	return min, max, nil
+}
+
+// writeParamError writes the standard 400 for an invalid query parameter
+func writeParamError(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusBadRequest, "Invalid query parameter", err.Error())
+}
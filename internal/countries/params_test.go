@@ -0,0 +1,132 @@
+package countries
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePositiveInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"missing", "", 50, false},
+		{"empty", "limit=", 50, false},
+		{"in range", "limit=7", 7, false},
+		{"at max", "limit=250", 250, false},
+		{"over max", "limit=251", 250, false},
+		{"far over max", "limit=99999999", 250, false},
+		{"one", "limit=1", 1, false},
+		{"zero", "limit=0", 0, true},
+		{"negative", "limit=-3", 0, true},
+		{"non-numeric", "limit=ten", 0, true},
+		{"fraction", "limit=2.5", 0, true},
+		{"overflow", "limit=99999999999999999999", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/countries?"+tt.query, nil)
+			got, err := parsePositiveInt(req, "limit", 50, 250)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %d, want an error", got)
+				}
+				if err.Error() != "limit must be a positive integer" {
+					t.Errorf("error = %q", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNonNegativeInt(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"offset=0", 0, false},
+		{"offset=12", 12, false},
+		{"offset=-1", 0, true},
+		{"offset=abc", 0, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/countries?"+tt.query, nil)
+		got, err := parseNonNegativeInt(req, "offset")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%q: got %d, %v; want %d, error %t", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestCountParamsUniform checks that the endpoints taking a count answer a
+// bad one with the same 400
+func TestCountParamsUniform(t *testing.T) {
+	svc := newTestService(t)
+	r := newTestRouter(svc)
+
+	for _, path := range []string{
+		"/countries?limit=0",
+		"/countries?limit=-1",
+		"/countries/search?q=a&limit=x",
+		"/regions?limit=-5",
+	} {
+		t.Run(path, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400 (%s)", rec.Code, rec.Body)
+			}
+			var body struct {
+				Error   string `json:"error"`
+				Details string `json:"details"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != "Invalid query parameter" || body.Details != "limit must be a positive integer" {
+				t.Errorf("body = %+v", body)
+			}
+		})
+	}
+}
+
+func TestParsePopulationRange(t *testing.T) {
+	tests := []struct {
+		query, min, max string
+		wantErr         string
+	}{
+		{"", "", "", ""},
+		{"min_population=0", "0", "", ""},
+		{"min_population=007&max_population=10", "7", "10", ""},
+		{"min_population=10&max_population=10", "10", "10", ""},
+		{"min_population=11&max_population=10", "", "", "min_population must not be greater than max_population"},
+		{"min_population=-1", "", "", "min_population must be a non-negative integer"},
+		{"max_population=1.5", "", "", "max_population must be a non-negative integer"},
+		{"max_population=lots", "", "", "max_population must be a non-negative integer"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/countries?"+tt.query, nil)
+		min, max, err := parsePopulationRange(req)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%q: error = %v, want %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || min != tt.min || max != tt.max {
+			t.Errorf("%q: got %q, %q, %v; want %q, %q", tt.query, min, max, err, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package countries
+
+import "strings"
+
+func isExcluded(excluded []string, field string) bool {
+	for _, f := range excluded {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// redact clears the excluded fields of c so omitempty drops them from the
+// response; the stored row is unaffected
+func redact(c *Country, excluded []string) {
+	for _, f := range excluded {
+		switch f {
+		case "capital":
+			c.Capital = nil
+		case "region":
+			c.Region = nil
+		case "currency_code":
+			c.CurrencyCode = nil
+		case "currency_codes":
+			c.CurrencyCodes = nil
+		case "exchange_rate":
+			// the primary rate is also listed in currency_rates
+			c.ExchangeRate = nil
+			c.CurrencyRates = nil
+		case "currency_rates":
+			c.CurrencyRates = nil
+		case "estimated_gdp":
+			c.EstimatedGDP = nil
+			c.GDPUnit = nil
+		case "flag_url":
+			c.FlagURL = nil
+		case "numeric_code":
+			c.NumericCode = nil
+		case "area":
+			c.Area = nil
+			c.PopulationDensity = nil
+		case "source":
+			c.Source = ""
+		case "last_refreshed_at":
+			c.LastRefreshedAt = nil
+		case "rate_age_seconds":
+			c.RateAgeSeconds = nil
+		case "rate_stale":
+			c.RateStale = nil
+		case "currency_symbol":
+			c.CurrencySymbol = nil
+		case "population_density":
+			c.PopulationDensity = nil
+		}
+	}
+}
+
+// withoutExcluded drops excluded columns from a parseFields result
+func withoutExcluded(fields string, excluded []string) string {
+	if fields == "" || len(excluded) == 0 {
+		return fields
+	}
+	var out []string
+	for _, f := range strings.Split(fields, ",") {
+		if !isExcluded(excluded, f) {
+			out = append(out, f)
+		}
+	}
+	return strings.Join(out, ",")
+}
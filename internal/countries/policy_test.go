@@ -0,0 +1,75 @@
+package countries
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExcludedFieldsNeverAppear(t *testing.T) {
+	svc := newTestService(t)
+	svc.Config.ExcludedFields = []string{"estimated_gdp", "exchange_rate", "capital"}
+	gh := testCountry("Ghana", "Africa", "GHS", 30, 15)
+	capital := "Accra"
+	gh.Capital = &capital
+	seed(t, svc, gh)
+	r := newTestRouter(svc)
+
+	// each JSON response decoded into a list of objects
+	jsonPaths := map[string]func(body []byte) ([]map[string]interface{}, error){
+		"/countries":                decodeList,
+		"/countries?numbers=string": decodeList,
+		"/countries?fields=name,estimated_gdp,capital": decodeList,
+		"/countries/search?q=gha":                      decodeList,
+		"/countries/Ghana":                             decodeOne,
+		"/countries/Ghana?numbers=string":              decodeOne,
+	}
+	for path, decode := range jsonPaths {
+		t.Run(path, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			list, err := decode(rec.Body.Bytes())
+			if err != nil || len(list) != 1 {
+				t.Fatalf("decoded %d countries, %v: %s", len(list), err, rec.Body)
+			}
+			for _, f := range svc.Config.ExcludedFields {
+				if v, ok := list[0][f]; ok {
+					t.Errorf("%s = %v in the response", f, v)
+				}
+			}
+		})
+	}
+
+	t.Run("/countries/export", func(t *testing.T) {
+		rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries/export", nil))
+		rows, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil || len(rows) != 2 {
+			t.Fatalf("rows = %v, %v", rows, err)
+		}
+		header := strings.Join(rows[0], ",")
+		for _, f := range svc.Config.ExcludedFields {
+			for _, col := range rows[0] {
+				if col == f {
+					t.Errorf("column %s in the export header %s", f, header)
+				}
+			}
+		}
+	})
+}
+
+func decodeList(body []byte) ([]map[string]interface{}, error) {
+	var list []map[string]interface{}
+	err := json.Unmarshal(body, &list)
+	return list, err
+}
+
+func decodeOne(body []byte) ([]map[string]interface{}, error) {
+	var one map[string]interface{}
+	err := json.Unmarshal(body, &one)
+	return []map[string]interface{}{one}, err
+}
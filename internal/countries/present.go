@@ -0,0 +1,107 @@
+package countries
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/zjoart/countryxchange/internal/config"
+)
+
+// countryStringNumbers shadows the float fields of Country with plain
+// decimal strings so large GDP values never use scientific notation
+type countryStringNumbers struct {
+	*Country
+	CurrencyRates map[string]string `json:"currency_rates,omitempty"`
+	ExchangeRate  *string           `json:"exchange_rate,omitempty"`
+	EstimatedGDP  *string           `json:"estimated_gdp,omitempty"`
+}
+
+// detailStringNumbers is countryStringNumbers for CountryDetail
+type detailStringNumbers struct {
+	*CountryDetail
+	CurrencyRates map[string]string `json:"currency_rates,omitempty"`
+	ExchangeRate  *string           `json:"exchange_rate,omitempty"`
+	EstimatedGDP  *string           `json:"estimated_gdp,omitempty"`
+}
+
+// ratePointStringNumbers is RatePoint with its rate as a decimal string
+type ratePointStringNumbers struct {
+	RatePoint
+	Rate string `json:"rate"`
+}
+
+// rateHistoryStringNumbers is RateHistory with string-formatted points
+type rateHistoryStringNumbers struct {
+	*RateHistory
+	Points []ratePointStringNumbers `json:"points"`
+}
+
+// formatDecimal renders f in fixed-point notation with no trailing zeros
+func formatDecimal(f *float64) *string {
+	if f == nil {
+		return nil
+	}
+	s := strconv.FormatFloat(*f, 'f', -1, 64)
+	return &s
+}
+
+// formatRates is formatDecimal for each rate of a currency_rates map
+func formatRates(rates map[string]float64) map[string]string {
+	if rates == nil {
+		return nil
+	}
+	out := make(map[string]string, len(rates))
+	for code, rate := range rates {
+		out[code] = *formatDecimal(&rate)
+	}
+	return out
+}
+
+// numbersAsStrings resolves ?numbers=string|number, falling back to the
+// configured default
+func numbersAsStrings(req *http.Request, cfg *config.Config) (bool, error) {
+	switch v := req.URL.Query().Get("numbers"); v {
+	case "":
+		return cfg.NumbersAsStrings, nil
+	case "string":
+		return true, nil
+	case "number":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown numbers value %q (allowed: string, number)", v)
+	}
+}
+
+// presentList shapes a country list for the response
+func presentList(list []Country, asStrings bool) interface{} {
+	if !asStrings {
+		return list
+	}
+	out := make([]countryStringNumbers, len(list))
+	for i := range list {
+		c := &list[i]
+		out[i] = countryStringNumbers{Country: c, CurrencyRates: formatRates(c.CurrencyRates), ExchangeRate: formatDecimal(c.ExchangeRate), EstimatedGDP: formatDecimal(c.EstimatedGDP)}
+	}
+	return out
+}
+
+// presentDetail shapes a single country for the response
+func presentDetail(d *CountryDetail, asStrings bool) interface{} {
+	if !asStrings {
+		return d
+	}
+	return detailStringNumbers{CountryDetail: d, CurrencyRates: formatRates(d.CurrencyRates), ExchangeRate: formatDecimal(d.ExchangeRate), EstimatedGDP: formatDecimal(d.EstimatedGDP)}
+}
+
+// presentRateHistory shapes a rate history series for the response
+func presentRateHistory(h *RateHistory, asStrings bool) interface{} {
+	if !asStrings {
+		return h
+	}
+	points := make([]ratePointStringNumbers, len(h.Points))
+	for i, p := range h.Points {
+		points[i] = ratePointStringNumbers{RatePoint: p, Rate: *formatDecimal(&p.Rate)}
+	}
+	return rateHistoryStringNumbers{RateHistory: h, Points: points}
+}
@@ -0,0 +1,129 @@
+package countries
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCurrencyRatesAsStrings(t *testing.T) {
+	svc := newTestService(t)
+	li := testCountry("Liechtenstein", "Europe", "CHF", 1, 0.8)
+	li.CurrencyCodes = []string{"CHF", "EUR"}
+	li.CurrencyRates = map[string]float64{"CHF": 0.8, "EUR": 1e-7}
+	seed(t, svc, li)
+	r := newTestRouter(svc)
+
+	want := map[string]interface{}{"CHF": "0.8", "EUR": "0.0000001"}
+	tests := []struct {
+		path string
+		list bool
+	}{
+		{"/countries?numbers=string", true},
+		{"/countries?numbers=string&fields=name,currency_rates", true},
+		{"/countries/Liechtenstein?numbers=string", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var got map[string]interface{}
+			if tt.list {
+				var list []map[string]interface{}
+				if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list) != 1 {
+					t.Fatalf("decode %s: %v", rec.Body, err)
+				}
+				got = list[0]
+			} else if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			if !reflect.DeepEqual(got["currency_rates"], want) {
+				t.Errorf("currency_rates = %#v, want %#v", got["currency_rates"], want)
+			}
+		})
+	}
+}
+
+func TestCurrencyRatesAsNumbers(t *testing.T) {
+	c := testCountry("Ghana", "Africa", "GHS", 30, 15)
+	b, err := json.Marshal(presentDetail(&CountryDetail{Country: c}, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(b, &got)
+	if want := map[string]interface{}{"GHS": 15.0}; !reflect.DeepEqual(got["currency_rates"], want) {
+		t.Errorf("currency_rates = %#v, want %#v", got["currency_rates"], want)
+	}
+}
+
+// scientific matches an exponent such as 2.1433225e+07 or 1E-7
+var scientific = regexp.MustCompile(`[0-9][eE][+-]?[0-9]`)
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{2.1433225e+07, "21433225"},
+		{2.1433225e+21, "2143322500000000000000"},
+		{1e-7, "0.0000001"},
+		{1600.5, "1600.5"},
+		{0, "0"},
+	}
+	for _, tt := range tests {
+		if got := formatDecimal(&tt.in); *got != tt.want {
+			t.Errorf("formatDecimal(%g) = %q, want %q", tt.in, *got, tt.want)
+		}
+	}
+	if got := formatDecimal(nil); got != nil {
+		t.Errorf("formatDecimal(nil) = %q, want nil", *got)
+	}
+}
+
+func TestNoScientificNotation(t *testing.T) {
+	svc := newTestService(t)
+	// default float encoding writes these as 2.1433225e+21 and 1e-07
+	huge := testCountry("Bigland", "Europe", "BIG", 1, 1e-7)
+	gdp := 2.1433225e+21
+	huge.EstimatedGDP = &gdp
+	huge.CurrencyRates = map[string]float64{"BIG": 1e-7}
+	seed(t, svc, huge)
+	r := newTestRouter(svc)
+
+	for _, path := range []string{
+		"/countries?numbers=string",
+		"/countries?numbers=string&limit=1",
+		"/countries?numbers=string&fields=name,estimated_gdp,exchange_rate",
+		"/countries/Bigland?numbers=string",
+	} {
+		t.Run(path, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			body := rec.Body.String()
+			if m := scientific.FindString(body); m != "" {
+				t.Errorf("body has %q in scientific notation: %s", m, body)
+			}
+			for _, want := range []string{`"estimated_gdp":"2143322500000000000000"`, `"exchange_rate":"0.0000001"`} {
+				if !strings.Contains(body, want) {
+					t.Errorf("body lacks %s: %s", want, body)
+				}
+			}
+		})
+	}
+
+	// NUMBERS_AS_STRINGS makes it the default
+	svc.Config.NumbersAsStrings = true
+	rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries/Bigland", nil))
+	if m := scientific.FindString(rec.Body.String()); m != "" {
+		t.Errorf("default with NUMBERS_AS_STRINGS has %q: %s", m, rec.Body)
+	}
+}
@@ -0,0 +1,107 @@
+package countries
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/api"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// default and widest span of GET /countries/{name}/rates/history
+const (
+	defaultRateHistoryRange = 30 * 24 * time.Hour
+	maxRateHistoryRange     = 366 * 24 * time.Hour
+)
+
+// RatePoint is one captured exchange rate of a currency
+type RatePoint struct {
+	CapturedAt api.Time `json:"captured_at"`
+	Rate       float64  `json:"rate"`
+	// Base is the currency Rate is quoted against
+	Base string `json:"base"`
+}
+
+// RateHistory is the series served by GET /countries/{name}/rates/history
+type RateHistory struct {
+	Name         string      `json:"name"`
+	CurrencyCode *string     `json:"currency_code"`
+	From         api.Time    `json:"from"`
+	To           api.Time    `json:"to"`
+	Points       []RatePoint `json:"points"`
+}
+
+// ensureRateHistory creates the table every refresh appends the rates feed to
+func (s *Service) ensureRateHistory() error {
+	createRateHistory := `
+    CREATE TABLE IF NOT EXISTS rate_history (
+        currency_code VARCHAR(32) NOT NULL,
+        captured_at DATETIME NOT NULL,
+        base VARCHAR(3) NOT NULL,
+        rate DOUBLE NOT NULL,
+        PRIMARY KEY (currency_code, captured_at)
+    );`
+	if _, err := s.DB.Exec(createRateHistory); err != nil {
+		logger.Error("repo: create rate_history table failed", logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+// recordRates appends rates captured at t, the time the feed was fetched,
+// and deletes points older than retention (0 keeps all). A second capture
+// within the same second overwrites the first, so recording a cached feed
+// again adds no point.
+func (s *Service) recordRates(tx *sql.Tx, t time.Time, base string, rates map[string]float64, retention time.Duration) error {
+	t = t.UTC()
+	stmt, err := tx.Prepare(`INSERT INTO rate_history (currency_code, captured_at, base, rate) VALUES (?, ?, ?, ?) ` +
+		s.Dialect.Upsert([]string{"currency_code", "captured_at"}, "base", "rate"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for code, rate := range rates {
+		if _, err := stmt.Exec(code, t, base, rate); err != nil {
+			logger.Error("repo: insert rate history failed", logger.Fields{"currency": code, "error": err.Error()})
+			return err
+		}
+	}
+
+	if retention > 0 {
+		if _, err := tx.Exec(`DELETE FROM rate_history WHERE captured_at < ?`, t.Add(-retention)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRateHistory returns the points of code captured in [from, to], oldest
+// first, paged by limit/offset, along with how many points the range holds
+func (s *Service) GetRateHistory(code string, from, to time.Time, limit, offset int) ([]RatePoint, int64, error) {
+	var total int64
+	if err := s.DB.QueryRow(`SELECT COUNT(*) FROM rate_history WHERE currency_code = ? AND captured_at BETWEEN ? AND ?`,
+		code, from.UTC(), to.UTC()).Scan(&total); err != nil {
+		logger.Error("repo: count rate history failed", logger.Fields{"currency": code, "error": err.Error()})
+		return nil, 0, err
+	}
+
+	rows, err := s.DB.Query(`SELECT captured_at, rate, base FROM rate_history WHERE currency_code = ? AND captured_at BETWEEN ? AND ?
+        ORDER BY captured_at LIMIT ? OFFSET ?`, code, from.UTC(), to.UTC(), limit, offset)
+	if err != nil {
+		logger.Error("repo: query rate history failed", logger.Fields{"currency": code, "error": err.Error()})
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	points := []RatePoint{}
+	for rows.Next() {
+		var p RatePoint
+		var at time.Time
+		if err := rows.Scan(&at, &p.Rate, &p.Base); err != nil {
+			return nil, 0, err
+		}
+		p.CapturedAt = api.Time{Time: at}
+		points = append(points, p)
+	}
+	return points, total, rows.Err()
+}
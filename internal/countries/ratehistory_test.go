@@ -0,0 +1,185 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRatesServer serves a USD-based rates feed and counts its hits
+func newRatesServer(t *testing.T, rates map[string]float64) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": "success", "base_code": "USD", "rates": rates})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestRateHistoryRecordsFetchTime(t *testing.T) {
+	svc := newTestService(t)
+	srv, hits := newRatesServer(t, map[string]float64{"USD": 1, "GHS": 15})
+	svc.RatesURL = srv.URL + "/"
+	svc.Config.External.RatesCacheTTL = time.Hour
+	fetched := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := fetched
+	svc.Now = func() time.Time { return now }
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 14))
+
+	if _, err := svc.RefreshRates(context.Background()); err != nil {
+		t.Fatalf("first RefreshRates: %v", err)
+	}
+	// served from the cache: the same observation, not a new point
+	now = fetched.Add(10 * time.Minute)
+	if _, err := svc.RefreshRates(context.Background()); err != nil {
+		t.Fatalf("second RefreshRates: %v", err)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Fatalf("rates feed fetched %d times, want 1", n)
+	}
+
+	points, total, err := svc.GetRateHistory("GHS", fetched.Add(-time.Hour), fetched.Add(time.Hour), 10, 0)
+	if err != nil {
+		t.Fatalf("GetRateHistory: %v", err)
+	}
+	if total != 1 || len(points) != 1 {
+		t.Fatalf("got %d points (total %d), want 1: %+v", len(points), total, points)
+	}
+	if !points[0].CapturedAt.Equal(fetched) || points[0].Rate != 15 || points[0].Base != "USD" {
+		t.Errorf("point = %+v, want 15 USD captured at %v", points[0], fetched)
+	}
+}
+
+func TestRateHistoryNumbersAsStrings(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 14))
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	err := svc.withTx(context.Background(), func(tx *sql.Tx) error {
+		return svc.recordRates(tx, at, "USD", map[string]float64{"GHS": 123456789012.5}, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(svc)
+
+	tests := []struct {
+		query string
+		want  interface{}
+	}{
+		{"numbers=string", "123456789012.5"},
+		{"numbers=number", 123456789012.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries/Ghana/rates/history?to=2025-03-02T00:00:00Z&"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var body struct {
+				Points []map[string]interface{} `json:"points"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Points) != 1 {
+				t.Fatalf("points = %v", body.Points)
+			}
+			if got := body.Points[0]["rate"]; got != tt.want {
+				t.Errorf("rate = %#v, want %#v", got, tt.want)
+			}
+			if got := body.Points[0]["base"]; got != "USD" {
+				t.Errorf("base = %#v", got)
+			}
+		})
+	}
+}
+
+// seedRateHistory records USD-based rates captured at t, as a refresh would
+func seedRateHistory(t *testing.T, svc *Service, at time.Time, rates map[string]float64) {
+	t.Helper()
+	err := svc.withTx(context.Background(), func(tx *sql.Tx) error {
+		if err := svc.recordRates(tx, at, "USD", rates, 0); err != nil {
+			return err
+		}
+		return svc.SaveRatesBase(tx, "USD")
+	})
+	if err != nil {
+		t.Fatalf("seed rate history: %v", err)
+	}
+}
+
+func TestRefreshFallsBackToLatestHistoricRate(t *testing.T) {
+	svc := newTestService(t)
+	svc.Config.Refresh.UseLastKnownRatesOnFailure = true
+	svc.CountriesURL = delayedServer(t, 0, http.StatusOK, countriesFeed).URL
+	svc.RatesURL = delayedServer(t, 0, http.StatusInternalServerError, `{}`).URL + "/"
+
+	older := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	seedRateHistory(t, svc, older, map[string]float64{"GHS": 20})
+	seedRateHistory(t, svc, older.Add(24*time.Hour), map[string]float64{"GHS": 12})
+
+	res, err := svc.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if !res.StaleRates {
+		t.Error("StaleRates = false, want true")
+	}
+	c, err := svc.GetByName(context.Background(), "Ghana")
+	if err != nil {
+		t.Fatalf("GetByName: %v", err)
+	}
+	if c.ExchangeRate == nil || *c.ExchangeRate != 12 {
+		t.Errorf("exchange rate = %v, want the latest historic rate 12", fmtPtr(c.ExchangeRate))
+	}
+}
+
+func TestRefreshPartialStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		partialStatus int
+		ratesUp       bool
+		want          int
+		wantPartial   bool
+	}{
+		{"partial with 200", http.StatusOK, false, http.StatusOK, true},
+		{"partial with 207", http.StatusMultiStatus, false, http.StatusMultiStatus, true},
+		{"complete with 207 configured", http.StatusMultiStatus, true, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t)
+			svc.Config.Refresh.UseLastKnownRatesOnFailure = true
+			svc.Config.Refresh.PartialStatus = tt.partialStatus
+			svc.CountriesURL = delayedServer(t, 0, http.StatusOK, countriesFeed).URL
+			ratesStatus := http.StatusInternalServerError
+			if tt.ratesUp {
+				ratesStatus = http.StatusOK
+			}
+			svc.RatesURL = delayedServer(t, 0, ratesStatus, ratesFeed).URL + "/"
+			seedRateHistory(t, svc, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), map[string]float64{"GHS": 12})
+
+			rec := serve(newTestRouter(svc), httptest.NewRequest(http.MethodPost, "/countries/refresh", nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body)
+			}
+			var body struct {
+				Partial  bool     `json:"partial"`
+				Warnings []string `json:"warnings"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			if body.Partial != tt.wantPartial || (len(body.Warnings) > 0) != tt.wantPartial {
+				t.Errorf("partial = %v, warnings = %q; want partial %v", body.Partial, body.Warnings, tt.wantPartial)
+			}
+		})
+	}
+}
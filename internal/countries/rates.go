@@ -0,0 +1,90 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// RefreshRates fetches only the exchange rates feed and, in one transaction,
+// updates exchange_rate, currency_rates and estimated_gdp of every stored
+// country that has a currency, without calling the countries API. Countries whose currency is
+// missing from the feed get NULL for both, as in a full refresh. It returns
+// how many rows were updated. The base currency used is recorded alongside.
+func (s *Service) RefreshRates(ctx context.Context) (int64, error) {
+	cfg := s.Config
+	rr, err := s.cachedFetchRates(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	release, err := s.bulkOps.acquire(ctx, &cfg.DB)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	r := newGDPRand(&cfg.GDP)
+	now := s.Now().UTC()
+	var updated int64
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		updated = 0
+		rows, err := tx.QueryContext(ctx, `SELECT id, population, currency_code, currency_codes FROM countries WHERE currency_code IS NOT NULL`+s.Dialect.ForUpdate())
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id         int64
+			population int64
+			currency   string
+			currencies sql.NullString
+		}
+		var todo []row
+		for rows.Next() {
+			var rw row
+			if err := rows.Scan(&rw.id, &rw.population, &rw.currency, &rw.currencies); err != nil {
+				rows.Close()
+				return err
+			}
+			todo = append(todo, rw)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		stmt, err := tx.PrepareContext(ctx, `UPDATE countries SET exchange_rate = ?, currency_rates = ?, estimated_gdp = ?, last_refreshed_at = ? WHERE id = ?`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, rw := range todo {
+			var rate, est sql.NullFloat64
+			if v, ok := rr.Rates[rw.currency]; ok {
+				rate = sql.NullFloat64{Float64: v, Valid: true}
+				est = sql.NullFloat64{Float64: estimateGDP(rw.population, v, r, &cfg.GDP), Valid: true}
+			}
+			codes := []string{rw.currency}
+			if rw.currencies.Valid && rw.currencies.String != "" {
+				codes = strings.Split(rw.currencies.String, ",")
+			}
+			rates := encodeCurrencyRates(currencyRates(codes, rr.Rates))
+			if _, err := stmt.ExecContext(ctx, rate, rates, est, now, rw.id); err != nil {
+				return err
+			}
+			updated++
+		}
+		if err := s.recordRates(tx, rr.fetchedAt, rr.BaseCode, rr.Rates, cfg.Refresh.RateHistoryRetention); err != nil {
+			return err
+		}
+		return s.SaveRatesBase(tx, rr.BaseCode)
+	})
+	if err != nil {
+		logger.Error("service: RefreshRates failed", logger.WithError(err))
+		return 0, err
+	}
+	logger.Info("service: RefreshRates complete", logger.Fields{"updated": updated, "rates": len(rr.Rates)})
+	return updated, nil
+}
@@ -0,0 +1,134 @@
+package countries
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// forbidCountriesFeed points the countries feed at a server that fails t
+// when called
+func forbidCountriesFeed(t *testing.T, svc *Service) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("rates refresh called the countries API")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+	svc.CountriesURL = srv.URL
+}
+
+func TestRatesRefreshRoute(t *testing.T) {
+	svc := newTestService(t)
+	forbidCountriesFeed(t, svc)
+	srv, hits := newRatesServer(t, map[string]float64{"USD": 1, "GHS": 15, "PEN": 4, "EUR": 0.9})
+	svc.RatesURL = srv.URL + "/"
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	svc.Now = func() time.Time { return now }
+
+	ghana := testCountry("Ghana", "Africa", "GHS", 30, 12)
+	peru := testCountry("Peru", "Americas", "PEN", 40, 3.7)
+	peru.CurrencyCodes = []string{"PEN", "EUR"}
+	// its currency isn't in the feed, so the rate and GDP go NULL
+	tuvalu := testCountry("Tuvalu", "Oceania", "TVD", 11, 1.5)
+	// no currency at all: never touched
+	antarctica := testCountry("Antarctica", "Polar", "XXX", 1, 0)
+	antarctica.CurrencyCode = nil
+	seed(t, svc, ghana, peru, tuvalu, antarctica)
+
+	req := httptest.NewRequest(http.MethodPost, "/rates/refresh", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	rec := serve(newTestRouter(svc), req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body)
+	}
+	var body struct {
+		Updated int64 `json:"updated"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Updated != 3 {
+		t.Errorf("updated = %d, want 3", body.Updated)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Errorf("rates feed called %d times, want 1", n)
+	}
+
+	got := func(name string) *Country {
+		t.Helper()
+		c, err := svc.GetByName(context.Background(), name)
+		if err != nil {
+			t.Fatalf("GetByName(%s): %v", name, err)
+		}
+		return c
+	}
+	// GDP_MULTIPLIER is 1500 in the test config
+	tests := []struct {
+		name string
+		rate *float64
+		gdp  *float64
+	}{
+		{"Ghana", ptr(15.0), ptr(30 * 1500 / 15.0)},
+		{"Peru", ptr(4.0), ptr(40 * 1500 / 4.0)},
+		{"Tuvalu", nil, nil},
+	}
+	for _, tt := range tests {
+		c := got(tt.name)
+		if !equalFloatPtr(c.ExchangeRate, tt.rate) || !equalFloatPtr(c.EstimatedGDP, tt.gdp) {
+			t.Errorf("%s: rate %v gdp %v, want %v and %v", tt.name, fmtPtr(c.ExchangeRate), fmtPtr(c.EstimatedGDP), fmtPtr(tt.rate), fmtPtr(tt.gdp))
+		}
+		if !c.LastRefreshedAt.Equal(now) {
+			t.Errorf("%s: last_refreshed_at = %v, want %v", tt.name, c.LastRefreshedAt, now)
+		}
+	}
+	if rates := got("Peru").CurrencyRates; rates["PEN"] != 4 || rates["EUR"] != 0.9 {
+		t.Errorf("Peru currency_rates = %v, want PEN 4 and EUR 0.9", rates)
+	}
+	if c := got("Antarctica"); c.LastRefreshedAt.Equal(now) {
+		t.Error("Antarctica, without a currency, was updated")
+	}
+	if base, err := svc.GetRatesBase(); err != nil || base != "USD" {
+		t.Errorf("rates base = %q, %v; want USD", base, err)
+	}
+}
+
+func TestRatesRefreshProviderDown(t *testing.T) {
+	svc := newTestService(t)
+	forbidCountriesFeed(t, svc)
+	svc.RatesURL = delayedServer(t, 0, http.StatusInternalServerError, "").URL + "/"
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 12))
+
+	req := httptest.NewRequest(http.MethodPost, "/rates/refresh", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	if rec := serve(newTestRouter(svc), req); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503 (%s)", rec.Code, rec.Body)
+	}
+	c, err := svc.GetByName(context.Background(), "Ghana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *c.ExchangeRate != 12 {
+		t.Errorf("rate = %g after a failed fetch, want the stored 12", *c.ExchangeRate)
+	}
+}
+
+func ptr(f float64) *float64 { return &f }
+
+func equalFloatPtr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func fmtPtr(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
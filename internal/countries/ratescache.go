@@ -0,0 +1,101 @@
+package countries
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// ratesCache keeps the last decoded rates feed per base currency so refreshes
+// in quick succession don't call open.er-api again. Refreshes may run
+// concurrently (the bulk slot is only taken for the DB phase), hence the mutex.
+type ratesCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedRates
+}
+
+type cachedRates struct {
+	rates     *ratesResp
+	fetchedAt time.Time
+}
+
+func newRatesCache() *ratesCache {
+	return &ratesCache{entries: make(map[string]cachedRates)}
+}
+
+// get returns the rates cached for base if they are younger than ttl, along
+// with their age
+func (c *ratesCache) get(base string, ttl time.Duration, now time.Time) (*ratesResp, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[base]
+	if !ok {
+		return nil, 0, false
+	}
+	age := now.Sub(e.fetchedAt)
+	if age >= ttl {
+		return nil, age, false
+	}
+	return e.rates, age, true
+}
+
+func (c *ratesCache) put(base string, rr *ratesResp, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[base] = cachedRates{rates: rr, fetchedAt: now}
+}
+
+type (
+	forceRatesKey struct{}
+	ratesBaseKey  struct{}
+)
+
+// withForcedRates marks ctx so fetches under it skip the rates cache (they
+// still refill it)
+func withForcedRates(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceRatesKey{}, true)
+}
+
+func ratesForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(forceRatesKey{}).(bool)
+	return forced
+}
+
+// withRatesBase makes fetches under ctx quote rates against base instead
+// of External.RatesBase
+func withRatesBase(ctx context.Context, base string) context.Context {
+	return context.WithValue(ctx, ratesBaseKey{}, base)
+}
+
+// ratesBase is the base currency rates are fetched against under ctx
+func (s *Service) ratesBase(ctx context.Context) string {
+	if base, ok := ctx.Value(ratesBaseKey{}).(string); ok && base != "" {
+		return base
+	}
+	return s.Config.External.RatesBase
+}
+
+// cachedFetchRates serves the rates feed from the cache while it is younger
+// than External.RatesCacheTTL, fetching and caching it otherwise. A TTL of 0
+// disables the cache.
+func (s *Service) cachedFetchRates(ctx context.Context) (*ratesResp, error) {
+	base := s.ratesBase(ctx)
+	ttl := s.Config.External.RatesCacheTTL
+	if ttl <= 0 || s.rates == nil {
+		return s.fetchRates(ctx, base)
+	}
+	if !ratesForced(ctx) {
+		if rr, age, ok := s.rates.get(base, ttl, s.Now()); ok {
+			logger.Info("service: using cached exchange rates", logFields(ctx, logger.Fields{"base": base, "age_seconds": int64(age.Seconds())}))
+			return rr, nil
+		}
+	}
+	rr, err := s.fetchRates(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	s.rates.put(base, rr, s.Now())
+	return rr, nil
+}
@@ -1,29 +1,168 @@
 package countries
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/zjoart/countryxchange/internal/database"
+	"github.com/zjoart/countryxchange/pkg/api"
 	"github.com/zjoart/countryxchange/pkg/logger"
 )
 
 var ErrNotFound = errors.New("not found")
 
-// DropTables drops the countries and metadata tables
-func DropTables(db *sql.DB) error {
+// ErrDuplicate is returned when an insert hits the unique name key
+var ErrDuplicate = errors.New("already exists")
+
+// SchemaVersion is bumped whenever EnsureTables changes the schema
+//
+//	1: countries + metadata
+//	2: countries.numeric_code
+//	3: audit_log
+//	4: countries.source
+//	5: countries.currency_codes
+//	6: aliases
+//	7: countries.flag_ok
+//	8: refreshes + country_history
+//	9: countries.area
+//	10: countries.currency_rates
+//	11: rate_history
+const SchemaVersion = 11
+
+// countryColumns lists the columns read by scanCountry, in scan order
+const countryColumns = `id, name, capital, region, population, currency_code, currency_codes, exchange_rate, estimated_gdp, flag_url, numeric_code, source, last_refreshed_at, area, currency_rates`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// allCountryColumns is countryColumns split into column names
+var allCountryColumns = strings.Split(countryColumns, ", ")
+
+// scanCountry reads a row selected with countryColumns into a Country
+func scanCountry(row rowScanner) (*Country, error) {
+	return scanCountryColumns(row, allCountryColumns)
+}
+
+// scanCountryColumns reads a row selecting only cols (in that order) into a
+// Country; fields that weren't selected are left at their zero value
+func scanCountryColumns(row rowScanner, cols []string) (*Country, error) {
+	var c Country
+	var capital, region, currency, currencies, rates, flag, numeric sql.NullString
+	var exchange, est, area sql.NullFloat64
+	var last sql.NullTime
+
+	dest := make([]interface{}, len(cols))
+	for i, col := range cols {
+		switch col {
+		case "id":
+			dest[i] = &c.ID
+		case "name":
+			dest[i] = &c.Name
+		case "capital":
+			dest[i] = &capital
+		case "region":
+			dest[i] = &region
+		case "population":
+			dest[i] = &c.Population
+		case "currency_code":
+			dest[i] = &currency
+		case "currency_codes":
+			dest[i] = &currencies
+		case "exchange_rate":
+			dest[i] = &exchange
+		case "estimated_gdp":
+			dest[i] = &est
+		case "flag_url":
+			dest[i] = &flag
+		case "numeric_code":
+			dest[i] = &numeric
+		case "source":
+			dest[i] = &c.Source
+		case "last_refreshed_at":
+			dest[i] = &last
+		case "area":
+			dest[i] = &area
+		case "currency_rates":
+			dest[i] = &rates
+		default:
+			return nil, fmt.Errorf("unknown country column %q", col)
+		}
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if capital.Valid {
+		c.Capital = &capital.String
+	}
+	if region.Valid {
+		c.Region = &region.String
+	}
+	if currency.Valid {
+		c.CurrencyCode = &currency.String
+	}
+	if currencies.Valid && currencies.String != "" {
+		c.CurrencyCodes = strings.Split(currencies.String, ",")
+	}
+	if exchange.Valid {
+		c.ExchangeRate = &exchange.Float64
+	}
+	if est.Valid {
+		c.EstimatedGDP = &est.Float64
+	}
+	if flag.Valid {
+		c.FlagURL = &flag.String
+	}
+	if numeric.Valid {
+		c.NumericCode = &numeric.String
+	}
+	if last.Valid {
+		c.LastRefreshedAt = api.NewTime(last.Time)
+	}
+	if area.Valid {
+		c.Area = &area.Float64
+	}
+	if rates.Valid && rates.String != "" {
+		if err := json.Unmarshal([]byte(rates.String), &c.CurrencyRates); err != nil {
+			return nil, fmt.Errorf("country %q: decode currency_rates: %w", c.Name, err)
+		}
+	}
+	return &c, nil
+}
+
+// DropTables drops the countries, aliases, metadata and history tables
+func (s *Service) DropTables() error {
 	logger.Info("repo: DropTables start")
 
 	// Drop tables in reverse order of dependencies
 	dropMetadata := `DROP TABLE IF EXISTS metadata;`
-	if _, err := db.Exec(dropMetadata); err != nil {
+	if _, err := s.DB.Exec(dropMetadata); err != nil {
 		logger.Error("repo: drop metadata table failed", logger.WithError(err))
 		return err
 	}
 
+	for _, table := range []string{"country_history", "refreshes", "rate_history"} {
+		if _, err := s.DB.Exec(`DROP TABLE IF EXISTS ` + table + `;`); err != nil {
+			logger.Error("repo: drop "+table+" table failed", logger.WithError(err))
+			return err
+		}
+	}
+
+	dropAliases := `DROP TABLE IF EXISTS aliases;`
+	if _, err := s.DB.Exec(dropAliases); err != nil {
+		logger.Error("repo: drop aliases table failed", logger.WithError(err))
+		return err
+	}
+
 	dropCountries := `DROP TABLE IF EXISTS countries;`
-	if _, err := db.Exec(dropCountries); err != nil {
+	if _, err := s.DB.Exec(dropCountries); err != nil {
 		logger.Error("repo: drop countries table failed", logger.WithError(err))
 		return err
 	}
@@ -33,29 +172,57 @@ func DropTables(db *sql.DB) error {
 }
 
 // EnsureTables creates countries and metadata tables when needed
-func EnsureTables(db *sql.DB) error {
+func (s *Service) EnsureTables() error {
 	logger.Info("repo: EnsureTables start")
 	// countries table
 	createCountries := `
     CREATE TABLE IF NOT EXISTS countries (
-        id BIGINT AUTO_INCREMENT PRIMARY KEY,
+        id ` + s.Dialect.AutoIncrementPK() + `,
         name VARCHAR(255) NOT NULL,
         capital VARCHAR(255),
         region VARCHAR(255),
         population BIGINT NOT NULL,
         currency_code VARCHAR(32),
+        currency_codes VARCHAR(255),
         exchange_rate DOUBLE,
         estimated_gdp DOUBLE,
         flag_url VARCHAR(512),
+        numeric_code VARCHAR(3),
+        source VARCHAR(16) NOT NULL DEFAULT 'refresh',
         last_refreshed_at DATETIME,
-        UNIQUE KEY unique_name (name)
+        area DOUBLE,
+        currency_rates TEXT,
+        CONSTRAINT unique_name UNIQUE (name)
     );`
 
-	if _, err := db.Exec(createCountries); err != nil {
+	if _, err := s.DB.Exec(createCountries); err != nil {
 		logger.Error("repo: create countries table failed", logger.WithError(err))
 		return err
 	}
 
+	// columns added after the initial schema
+	if err := s.ensureColumn("countries", "numeric_code", "VARCHAR(3)"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("countries", "source", "VARCHAR(16) NOT NULL DEFAULT 'refresh'"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("countries", "currency_codes", "VARCHAR(255)"); err != nil {
+		return err
+	}
+	// NULL until a flag prefetch has tried the flag_url
+	if err := s.ensureColumn("countries", "flag_ok", "BOOLEAN"); err != nil {
+		return err
+	}
+	// km², NULL when upstream has no area
+	if err := s.ensureColumn("countries", "area", "DOUBLE"); err != nil {
+		return err
+	}
+	// JSON object of currency code to rate, for every currency of a country
+	if err := s.ensureColumn("countries", "currency_rates", "TEXT"); err != nil {
+		return err
+	}
+
 	// metadata table for storing global values like last refresh
 	createMeta := `
     CREATE TABLE IF NOT EXISTS metadata (
@@ -64,33 +231,91 @@ func EnsureTables(db *sql.DB) error {
         updated_at DATETIME
     );`
 
-	if _, err := db.Exec(createMeta); err != nil {
+	if _, err := s.DB.Exec(createMeta); err != nil {
 		logger.Error("repo: create metadata table failed", logger.WithError(err))
 		return err
 	}
 
-	logger.Info("repo: EnsureTables complete")
+	// audit log of who triggered refreshes and destructive operations
+	createAudit := `
+    CREATE TABLE IF NOT EXISTS audit_log (
+        id ` + s.Dialect.AutoIncrementPK() + `,
+        action VARCHAR(64) NOT NULL,
+        actor VARCHAR(255) NOT NULL,
+        target VARCHAR(255),
+        result VARCHAR(32) NOT NULL,
+        created_at DATETIME NOT NULL
+    );`
+
+	if _, err := s.DB.Exec(createAudit); err != nil {
+		logger.Error("repo: create audit_log table failed", logger.WithError(err))
+		return err
+	}
+
+	// alternate names consulted by GetByName
+	if err := s.ensureAliases(); err != nil {
+		return err
+	}
+
+	// per-refresh snapshots behind GET /refreshes/diff
+	if err := s.ensureHistory(); err != nil {
+		return err
+	}
+
+	// exchange rates captured by every refresh, behind the rates history
+	if err := s.ensureRateHistory(); err != nil {
+		return err
+	}
+
+	if err := s.saveMeta("schema_version", strconv.Itoa(SchemaVersion)); err != nil {
+		return err
+	}
+
+	logger.Info("repo: EnsureTables complete", logger.Fields{"schema_version": SchemaVersion})
+	return nil
+}
+
+// ensureColumn adds column to table when an older schema is missing it
+func (s *Service) ensureColumn(table, column, definition string) error {
+	var n int
+	if err := s.DB.QueryRow(s.Dialect.ColumnExistsQuery(), table, column).Scan(&n); err != nil {
+		logger.Error("repo: column lookup failed", logger.Fields{"table": table, "column": column}, logger.WithError(err))
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	alter := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := s.DB.Exec(alter); err != nil {
+		logger.Error("repo: add column failed", logger.Fields{"table": table, "column": column}, logger.WithError(err))
+		return err
+	}
+	logger.Info("repo: added column", logger.Fields{"table": table, "column": column})
 	return nil
 }
 
 // UpsertCountry inserts or updates country by name (unique)
-func UpsertCountry(tx *sql.Tx, c *Country) error {
+func (s *Service) UpsertCountry(tx *sql.Tx, c *Country) error {
 	q := `INSERT INTO countries
-        (name, capital, region, population, currency_code, exchange_rate, estimated_gdp, flag_url, last_refreshed_at)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-        ON DUPLICATE KEY UPDATE
-            capital = VALUES(capital),
-            region = VALUES(region),
-            population = VALUES(population),
-            currency_code = VALUES(currency_code),
-            exchange_rate = VALUES(exchange_rate),
-            estimated_gdp = VALUES(estimated_gdp),
-            flag_url = VALUES(flag_url),
-            last_refreshed_at = VALUES(last_refreshed_at)
-    `
-
-	var capital, region, currency, flag sql.NullString
-	var exchange, est sql.NullFloat64
+        (name, capital, region, population, currency_code, currency_codes, exchange_rate, estimated_gdp, flag_url, numeric_code, source, last_refreshed_at, area, currency_rates)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ` + s.Dialect.Upsert([]string{"name"}, "capital", "region", "population", "currency_code", "currency_codes",
+		"exchange_rate", "estimated_gdp", "flag_url", "numeric_code", "source", "last_refreshed_at", "area", "currency_rates")
+
+	_, err := tx.Exec(q, countryArgs(c)...)
+
+	if err != nil {
+		logger.Error("repo: UpsertCountry failed", logger.Fields{"country": c.Name}, logger.WithError(err))
+	}
+	return err
+}
+
+// countryArgs returns the insert values of c in the column order used by
+// UpsertCountry and InsertCountry
+func countryArgs(c *Country) []interface{} {
+	var capital, region, currency, currencies, flag, numeric sql.NullString
+	var exchange, est, area sql.NullFloat64
 
 	if c.Capital != nil {
 		capital = sql.NullString{String: *c.Capital, Valid: true}
@@ -101,158 +326,402 @@ func UpsertCountry(tx *sql.Tx, c *Country) error {
 	if c.CurrencyCode != nil {
 		currency = sql.NullString{String: *c.CurrencyCode, Valid: true}
 	}
+	if len(c.CurrencyCodes) > 0 {
+		currencies = sql.NullString{String: strings.Join(c.CurrencyCodes, ","), Valid: true}
+	}
 	if c.FlagURL != nil {
 		flag = sql.NullString{String: *c.FlagURL, Valid: true}
 	}
+	if c.NumericCode != nil {
+		numeric = sql.NullString{String: *c.NumericCode, Valid: true}
+	}
+	source := c.Source
+	if source == "" {
+		source = SourceRefresh
+	}
 	if c.ExchangeRate != nil {
 		exchange = sql.NullFloat64{Float64: *c.ExchangeRate, Valid: true}
 	}
 	if c.EstimatedGDP != nil {
 		est = sql.NullFloat64{Float64: *c.EstimatedGDP, Valid: true}
 	}
+	if c.Area != nil {
+		area = sql.NullFloat64{Float64: *c.Area, Valid: true}
+	}
+	rates := encodeCurrencyRates(c.CurrencyRates)
 
-	_, err := tx.Exec(q,
+	return []interface{}{
 		c.Name,
 		capital,
 		region,
 		c.Population,
 		currency,
+		currencies,
 		exchange,
 		est,
 		flag,
+		numeric,
+		source,
 		c.LastRefreshedAt,
-	)
+		area,
+		rates,
+	}
+}
 
-	if err != nil {
-		logger.Error("repo: UpsertCountry failed", logger.Fields{"country": c.Name}, logger.WithError(err))
+// encodeCurrencyRates serializes rates for the currency_rates column
+func encodeCurrencyRates(rates map[string]float64) sql.NullString {
+	if len(rates) == 0 {
+		return sql.NullString{}
 	}
-	return err
+	// a map of finite floats always marshals
+	b, _ := json.Marshal(rates)
+	return sql.NullString{String: string(b), Valid: true}
 }
 
-// GetAll returns countries matching optional filters and sorting
-func GetAll(db *sql.DB, region, currency, sort string) ([]Country, error) {
-	base := `SELECT id, name, capital, region, population, currency_code, exchange_rate, estimated_gdp, flag_url, last_refreshed_at FROM countries`
+// UpdateCountry overwrites the stored row of c (matched by ID) outside any
+// refresh transaction
+func (s *Service) UpdateCountry(ctx context.Context, c *Country) error {
+	q := `UPDATE countries SET
+        name = ?, capital = ?, region = ?, population = ?, currency_code = ?, currency_codes = ?, exchange_rate = ?, estimated_gdp = ?,
+        flag_url = ?, numeric_code = ?, source = ?, last_refreshed_at = ?, area = ?, currency_rates = ?
+        WHERE id = ?`
+	args := append(countryArgs(c), c.ID)
+	if _, err := s.DB.ExecContext(ctx, q, args...); err != nil {
+		logger.Error("repo: UpdateCountry failed", logger.Fields{"country": c.Name}, logger.WithError(err))
+		return err
+	}
+	return nil
+}
 
-	// Build WHERE conditions in a slice so multiple filters combine cleanly
+// InsertCountry stores a new country, relying on the unique name key rather
+// than a prior existence check. It returns ErrDuplicate when the name is
+// already taken, including when a concurrent insert won the race.
+func (s *Service) InsertCountry(ctx context.Context, c *Country) (int64, error) {
+	q := `INSERT INTO countries
+        (name, capital, region, population, currency_code, currency_codes, exchange_rate, estimated_gdp, flag_url, numeric_code, source, last_refreshed_at, area, currency_rates)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := s.DB.ExecContext(ctx, q, countryArgs(c)...)
+	if err != nil {
+		if s.Dialect.IsDuplicateKey(err) {
+			return 0, ErrDuplicate
+		}
+		logger.Error("repo: InsertCountry failed", logger.Fields{"country": c.Name}, logger.WithError(err))
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// whereClause builds the WHERE conditions for f, in dialect d, so multiple
+// filters combine cleanly. It returns "" when no filter is set.
+func (f ListFilter) whereClause(d database.Dialect) (string, []interface{}) {
 	var conds []string
 	var args []interface{}
-	if region != "" {
+	if f.Region != "" {
 		// case-insensitive match
 		conds = append(conds, "LOWER(region) = LOWER(?)")
-		args = append(args, region)
+		args = append(args, f.Region)
+	}
+	if f.Currency != "" {
+		// match the primary currency or any of the others a country uses
+		conds = append(conds, "(LOWER(currency_code) = LOWER(?) OR "+d.InList("currency_codes")+")")
+		args = append(args, f.Currency, strings.ToUpper(f.Currency))
+	}
+	if f.Source != "" {
+		conds = append(conds, "source = ?")
+		args = append(args, f.Source)
+	}
+	if f.MinGDP != "" {
+		min, _ := strconv.ParseFloat(f.MinGDP, 64)
+		conds = append(conds, "estimated_gdp >= ?")
+		args = append(args, min)
 	}
-	if currency != "" {
-		conds = append(conds, "LOWER(currency_code) = LOWER(?)")
-		args = append(args, currency)
+	if f.MaxGDP != "" {
+		max, _ := strconv.ParseFloat(f.MaxGDP, 64)
+		conds = append(conds, "estimated_gdp <= ?")
+		args = append(args, max)
+	}
+	if f.MinPopulation != "" {
+		min, _ := strconv.ParseInt(f.MinPopulation, 10, 64)
+		conds = append(conds, "population >= ?")
+		args = append(args, min)
+	}
+	if f.MaxPopulation != "" {
+		max, _ := strconv.ParseInt(f.MaxPopulation, 10, 64)
+		conds = append(conds, "population <= ?")
+		args = append(args, max)
+	}
+	if !f.ModifiedSince.IsZero() {
+		conds = append(conds, "last_refreshed_at > ?")
+		args = append(args, f.ModifiedSince)
+	}
+	switch f.HasFlag {
+	case "true":
+		conds = append(conds, "flag_url IS NOT NULL AND flag_url <> ''")
+	case "false":
+		conds = append(conds, "(flag_url IS NULL OR flag_url = '')")
+	}
+	switch f.FlagStatus {
+	case FlagStatusMissing:
+		conds = append(conds, "(flag_url IS NULL OR flag_url = '')")
+	case FlagStatusBroken:
+		conds = append(conds, "flag_url IS NOT NULL AND flag_url <> '' AND flag_ok = FALSE")
 	}
 
-	order := ""
-	if sort == "gdp_desc" {
-		order = " ORDER BY estimated_gdp DESC"
-	} else if sort == "gdp_asc" {
-		order = " ORDER BY estimated_gdp ASC"
+	if len(conds) == 0 {
+		return "", nil
 	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
 
-	where := ""
-	if len(conds) > 0 {
-		where = " WHERE " + strings.Join(conds, " AND ")
+// sortOrders maps each accepted ?sort= value to its ORDER BY expression.
+// Only these fixed strings ever reach the SQL.
+var sortOrders = map[string]string{
+	"gdp_asc":         "estimated_gdp ASC",
+	"gdp_desc":        "estimated_gdp DESC",
+	"density_asc":     densityExpr + " ASC",
+	"density_desc":    densityExpr + " DESC",
+	"population_asc":  "population ASC",
+	"population_desc": "population DESC",
+	"name_asc":        "name ASC",
+	"name_desc":       "name DESC",
+}
+
+// GetAll returns countries matching optional filters and sorting
+func (s *Service) GetAll(ctx context.Context, f ListFilter) ([]Country, error) {
+	// empty, not nil, so an empty list still encodes as []
+	out := []Country{}
+	err := s.EachCountry(ctx, f, func(c *Country) error {
+		out = append(out, *c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("repo: GetAll complete", logger.Fields{"count": len(out)})
+	return out, nil
+}
+
+// EachCountry runs the GetAll query for f and calls fn with each row as it
+// is read, so callers can stream a result of any size. An error from fn
+// stops the iteration and is returned.
+func (s *Service) EachCountry(ctx context.Context, f ListFilter, fn func(c *Country) error) error {
+	// only select the requested columns for sparse fieldsets
+	cols := allCountryColumns
+	if f.Fields != "" {
+		cols = strings.Split(f.Fields, ",")
+	}
+	base := `SELECT ` + strings.Join(cols, ", ") + ` FROM countries`
+	where, args := f.whereClause(s.Dialect)
+
+	// MySQL gives no ordering guarantee without ORDER BY, so always order
+	// explicitly and break ties by id to keep responses deterministic
+	order := " ORDER BY id ASC"
+	if o, ok := sortOrders[f.Sort]; ok {
+		order = " ORDER BY " + o + ", id ASC"
 	}
 
 	q := base + where + order
-	logger.Debug("repo: GetAll final query", logger.Fields{"query": q, "args": args})
-	rows, err := db.Query(q, args...)
+	if f.Limit > 0 {
+		q += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+	if s.queryLog.Allow() {
+		logger.Debug("repo: GetAll final query", logger.Fields{"query": q, "args": args})
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
 	if err != nil {
 		logger.Error("repo: GetAll query failed", logger.WithError(err))
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var out []Country
 	for rows.Next() {
-		var c Country
-		var capital, region, currency, flag sql.NullString
-		var exchange, est sql.NullFloat64
-		var last sql.NullTime
-
-		if err := rows.Scan(&c.ID, &c.Name, &capital, &region, &c.Population, &currency, &exchange, &est, &flag, &last); err != nil {
-			return nil, err
-		}
-		if capital.Valid {
-			c.Capital = &capital.String
-		}
-		if region.Valid {
-			c.Region = &region.String
-		}
-		if currency.Valid {
-			c.CurrencyCode = &currency.String
+		c, err := scanCountryColumns(rows, cols)
+		if err != nil {
+			return err
 		}
-		if exchange.Valid {
-			c.ExchangeRate = &exchange.Float64
+		if err := fn(c); err != nil {
+			return err
 		}
-		if est.Valid {
-			c.EstimatedGDP = &est.Float64
-		}
-		if flag.Valid {
-			c.FlagURL = &flag.String
-		}
-		if last.Valid {
-			c.LastRefreshedAt = &last.Time
-		}
-		out = append(out, c)
 	}
-
-	logger.Info("repo: GetAll complete", logger.Fields{"count": len(out)})
-	return out, nil
+	return rows.Err()
 }
 
 // GetByName fetches a single country by case-insensitive name
-func GetByName(db *sql.DB, name string) (*Country, error) {
-	q := `SELECT id, name, capital, region, population, currency_code, exchange_rate, estimated_gdp, flag_url, last_refreshed_at FROM countries WHERE LOWER(name) = LOWER(?) LIMIT 1`
-	row := db.QueryRow(q, name)
+func (s *Service) GetByName(ctx context.Context, name string) (*Country, error) {
+	q := `SELECT ` + countryColumns + ` FROM countries WHERE LOWER(name) = LOWER(?) LIMIT 1`
+	c, err := scanCountry(s.DB.QueryRowContext(ctx, q, name))
+	if err == sql.ErrNoRows {
+		// fall back to alternate names such as "USA"
+		canonical, aerr := s.resolveAlias(ctx, name)
+		if aerr != nil {
+			if aerr != ErrNotFound {
+				logger.Warn("repo: alias lookup failed", logger.Fields{"name": name}, logger.WithError(aerr))
+			}
+			logger.Debug("repo: GetByName not found", logger.Fields{"name": name})
+			return nil, ErrNotFound
+		}
+		logger.Debug("repo: GetByName resolved alias", logger.Fields{"alias": name, "name": canonical})
+		c, err = scanCountry(s.DB.QueryRowContext(ctx, q, canonical))
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+	}
+	if err != nil {
+		logger.Error("repo: GetByName failed", logger.Fields{"name": name}, logger.WithError(err))
+		return nil, err
+	}
 
-	var c Country
-	var capital, region, currency, flag sql.NullString
-	var exchange, est sql.NullFloat64
-	var last sql.NullTime
+	logger.Info("repo: GetByName success", logger.Fields{"name": c.Name, "id": c.ID})
+	return c, nil
+}
 
-	if err := row.Scan(&c.ID, &c.Name, &capital, &region, &c.Population, &currency, &exchange, &est, &flag, &last); err != nil {
+// GetByNumericCode fetches a single country by its ISO 3166-1 numeric code
+func (s *Service) GetByNumericCode(ctx context.Context, code string) (*Country, error) {
+	q := `SELECT ` + countryColumns + ` FROM countries WHERE numeric_code = ? LIMIT 1`
+	c, err := scanCountry(s.DB.QueryRowContext(ctx, q, code))
+	if err != nil {
 		if err == sql.ErrNoRows {
-			logger.Debug("repo: GetByName not found", logger.Fields{"name": name})
+			logger.Debug("repo: GetByNumericCode not found", logger.Fields{"numeric_code": code})
 			return nil, ErrNotFound
 		}
-		logger.Error("repo: GetByName failed", logger.Fields{"name": name}, logger.WithError(err))
+		logger.Error("repo: GetByNumericCode failed", logger.Fields{"numeric_code": code}, logger.WithError(err))
 		return nil, err
 	}
-	if capital.Valid {
-		c.Capital = &capital.String
+
+	logger.Info("repo: GetByNumericCode success", logger.Fields{"name": c.Name, "numeric_code": code})
+	return c, nil
+}
+
+// lowerNamesIn returns the placeholder list and lowercased args for a
+// LOWER(name) IN (...) condition
+func lowerNamesIn(names []string) (string, []interface{}) {
+	placeholders := make([]string, len(names))
+	args := make([]interface{}, len(names))
+	for i, n := range names {
+		placeholders[i] = "?"
+		args[i] = strings.ToLower(n)
 	}
-	if region.Valid {
-		c.Region = &region.String
+	return strings.Join(placeholders, ", "), args
+}
+
+// GetByNames fetches the countries matching names (case-insensitive), keyed
+// by lowercased name. Names that are not stored are simply absent.
+func (s *Service) GetByNames(ctx context.Context, names []string) (map[string]*Country, error) {
+	out := make(map[string]*Country, len(names))
+	if len(names) == 0 {
+		return out, nil
 	}
-	if currency.Valid {
-		c.CurrencyCode = &currency.String
+
+	in, args := lowerNamesIn(names)
+	q := `SELECT ` + countryColumns + ` FROM countries WHERE LOWER(name) IN (` + in + `)`
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		logger.Error("repo: GetByNames query failed", logger.WithError(err))
+		return nil, err
 	}
-	if exchange.Valid {
-		c.ExchangeRate = &exchange.Float64
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanCountry(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[strings.ToLower(c.Name)] = c
 	}
-	if est.Valid {
-		c.EstimatedGDP = &est.Float64
+
+	logger.Info("repo: GetByNames complete", logger.Fields{"requested": len(names), "found": len(out)})
+	return out, nil
+}
+
+// likeEscaper escapes the LIKE wildcards (and the escape character itself)
+// in user input; pair it with ESCAPE '!'
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// SearchCountries returns up to limit countries whose name, one of its
+// aliases or (with inCapital) capital contains q case-insensitively, ordered
+// by name
+func (s *Service) SearchCountries(ctx context.Context, q string, inCapital bool, limit int) ([]Country, error) {
+	pattern := "%" + strings.ToLower(likeEscaper.Replace(q)) + "%"
+	where := ` WHERE (LOWER(name) LIKE ? ESCAPE '!'` +
+		` OR name IN (SELECT country_name FROM aliases WHERE LOWER(alias) LIKE ? ESCAPE '!')`
+	args := []interface{}{pattern, pattern}
+	if inCapital {
+		where += ` OR LOWER(capital) LIKE ? ESCAPE '!'`
+		args = append(args, pattern)
 	}
-	if flag.Valid {
-		c.FlagURL = &flag.String
+	where += `)`
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+countryColumns+` FROM countries`+where+` ORDER BY name ASC, id ASC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		logger.Error("repo: SearchCountries failed", logger.Fields{"q": q}, logger.WithError(err))
+		return nil, err
 	}
-	if last.Valid {
-		c.LastRefreshedAt = &last.Time
+	defer rows.Close()
+
+	list := []Country{}
+	for rows.Next() {
+		c, err := scanCountry(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *c)
 	}
+	return list, rows.Err()
+}
 
-	logger.Info("repo: GetByName success", logger.Fields{"name": c.Name, "id": c.ID})
-	return &c, nil
+// DeleteByNames deletes every country in names (case-insensitive) with a
+// single DELETE and returns the stored names that were removed plus the
+// requested names that didn't exist
+func (s *Service) DeleteByNames(ctx context.Context, names []string) (deleted, notFound []string, err error) {
+	in, args := lowerNamesIn(names)
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		deleted = nil
+		rows, err := tx.QueryContext(ctx, `SELECT name FROM countries WHERE LOWER(name) IN (`+in+`)`+s.Dialect.ForUpdate(), args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			deleted = append(deleted, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM countries WHERE LOWER(name) IN (`+in+`)`, args...)
+		return err
+	})
+	if err != nil {
+		logger.Error("repo: DeleteByNames failed", logger.Fields{"requested": len(names)}, logger.WithError(err))
+		return nil, nil, err
+	}
+
+	found := make(map[string]bool, len(deleted))
+	for _, n := range deleted {
+		found[strings.ToLower(n)] = true
+	}
+	notFound = []string{}
+	for _, n := range names {
+		if !found[strings.ToLower(n)] {
+			notFound = append(notFound, n)
+		}
+	}
+	logger.Info("repo: DeleteByNames complete", logger.Fields{"requested": len(names), "deleted": len(deleted)})
+	return deleted, notFound, nil
 }
 
 // DeleteByName deletes a country by name
-func DeleteByName(db *sql.DB, name string) (bool, error) {
+func (s *Service) DeleteByName(ctx context.Context, name string) (bool, error) {
 	q := `DELETE FROM countries WHERE LOWER(name) = LOWER(?)`
-	res, err := db.Exec(q, name)
+	res, err := s.DB.ExecContext(ctx, q, name)
 	if err != nil {
 		logger.Error("repo: DeleteByName failed", logger.Fields{"name": name}, logger.WithError(err))
 		return false, err
@@ -267,10 +736,10 @@ func DeleteByName(db *sql.DB, name string) (bool, error) {
 }
 
 // TotalCount returns number of countries
-func TotalCount(db *sql.DB) (int64, error) {
+func (s *Service) TotalCount(ctx context.Context) (int64, error) {
 	q := `SELECT COUNT(*) FROM countries`
 	var n int64
-	if err := db.QueryRow(q).Scan(&n); err != nil {
+	if err := s.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
 		logger.Error("repo: TotalCount failed", logger.WithError(err))
 		return 0, err
 	}
@@ -278,9 +747,200 @@ func TotalCount(db *sql.DB) (int64, error) {
 	return n, nil
 }
 
+// LastKnownRates returns the newest rate of each currency in the rate
+// history quoted against base, keyed by currency code
+func (s *Service) LastKnownRates(ctx context.Context, base string) (map[string]float64, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT h.currency_code, h.rate FROM rate_history h
+        JOIN (SELECT currency_code, MAX(captured_at) AS captured_at FROM rate_history WHERE base = ? GROUP BY currency_code) latest
+        ON h.currency_code = latest.currency_code AND h.captured_at = latest.captured_at
+        WHERE h.base = ?`, base, base)
+	if err != nil {
+		logger.Error("repo: LastKnownRates query failed", logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]float64)
+	for rows.Next() {
+		var code string
+		var rate float64
+		if err := rows.Scan(&code, &rate); err != nil {
+			return nil, err
+		}
+		out[code] = rate
+	}
+	return out, rows.Err()
+}
+
+// CountFiltered returns how many countries match f, ignoring paging
+func (s *Service) CountFiltered(ctx context.Context, f ListFilter) (int64, error) {
+	where, args := f.whereClause(s.Dialect)
+	var n int64
+	if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM countries`+where, args...).Scan(&n); err != nil {
+		logger.Error("repo: CountFiltered failed", logger.WithError(err))
+		return 0, err
+	}
+	return n, nil
+}
+
+// FacetCounts returns the number of countries per region and per currency.
+// Each facet honors the other active filter but not its own, so a UI can
+// show every region still reachable under the chosen currency and vice versa.
+func (s *Service) FacetCounts(ctx context.Context, region, currency string) (regions, currencies map[string]int64, err error) {
+	regions, err = s.facetCount(ctx, "region", ListFilter{Currency: currency})
+	if err != nil {
+		return nil, nil, err
+	}
+	currencies, err = s.facetCount(ctx, "currency_code", ListFilter{Region: region})
+	if err != nil {
+		return nil, nil, err
+	}
+	return regions, currencies, nil
+}
+
+// facetCount groups the countries matching f by column, skipping NULLs
+func (s *Service) facetCount(ctx context.Context, column string, f ListFilter) (map[string]int64, error) {
+	where, args := f.whereClause(s.Dialect)
+	if where == "" {
+		where = " WHERE " + column + " IS NOT NULL"
+	} else {
+		where += " AND " + column + " IS NOT NULL"
+	}
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+column+`, COUNT(*) FROM countries`+where+` GROUP BY `+column, args...)
+	if err != nil {
+		logger.Error("repo: facet count failed", logger.Fields{"column": column}, logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]int64)
+	for rows.Next() {
+		var key string
+		var n int64
+		if err := rows.Scan(&key, &n); err != nil {
+			return nil, err
+		}
+		out[key] = n
+	}
+	return out, rows.Err()
+}
+
+// SetFlagStatus records whether the last download of each named country's
+// flag succeeded
+func (s *Service) SetFlagStatus(ok map[string]bool) error {
+	for name, good := range ok {
+		if _, err := s.DB.Exec(`UPDATE countries SET flag_ok = ? WHERE name = ?`, good, name); err != nil {
+			logger.Error("repo: SetFlagStatus failed", logger.Fields{"name": name}, logger.WithError(err))
+			return err
+		}
+	}
+	return nil
+}
+
+// AggregateCounts returns one page of country counts grouped by column
+// (ordered by count desc, then name) and the total number of groups
+func (s *Service) AggregateCounts(ctx context.Context, column string, limit, offset int) ([]AggregateCount, int64, error) {
+	var total int64
+	if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(DISTINCT `+column+`) FROM countries`).Scan(&total); err != nil {
+		logger.Error("repo: aggregate total failed", logger.Fields{"column": column}, logger.WithError(err))
+		return nil, 0, err
+	}
+
+	q := `SELECT ` + column + `, COUNT(*) AS n FROM countries WHERE ` + column + ` IS NOT NULL GROUP BY ` + column + ` ORDER BY n DESC, ` + column + ` ASC LIMIT ? OFFSET ?`
+	rows, err := s.DB.QueryContext(ctx, q, limit, offset)
+	if err != nil {
+		logger.Error("repo: aggregate query failed", logger.Fields{"column": column}, logger.WithError(err))
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := []AggregateCount{}
+	for rows.Next() {
+		var a AggregateCount
+		if err := rows.Scan(&a.Name, &a.Count); err != nil {
+			return nil, 0, err
+		}
+		out = append(out, a)
+	}
+	return out, total, rows.Err()
+}
+
+// GroupStatsFor aggregates count, population and GDP over the countries
+// matching f
+func (s *Service) GroupStatsFor(ctx context.Context, f ListFilter) (*GroupStats, error) {
+	where, args := f.whereClause(s.Dialect)
+	q := `SELECT COUNT(*), COALESCE(SUM(population), 0), SUM(estimated_gdp) FROM countries` + where
+	var st GroupStats
+	var gdp sql.NullFloat64
+	if err := s.DB.QueryRowContext(ctx, q, args...).Scan(&st.Count, &st.TotalPopulation, &gdp); err != nil {
+		logger.Error("repo: GroupStatsFor failed", logger.WithError(err))
+		return nil, err
+	}
+	if gdp.Valid {
+		st.TotalGDP = &gdp.Float64
+	}
+	return &st, nil
+}
+
+// CountCurrencyPeers returns how many other countries share the given currency
+func (s *Service) CountCurrencyPeers(ctx context.Context, currency, excludeName string) (int64, error) {
+	q := `SELECT COUNT(*) FROM countries WHERE LOWER(currency_code) = LOWER(?) AND LOWER(name) <> LOWER(?)`
+	var n int64
+	if err := s.DB.QueryRowContext(ctx, q, currency, excludeName).Scan(&n); err != nil {
+		logger.Error("repo: CountCurrencyPeers failed", logger.Fields{"currency": currency}, logger.WithError(err))
+		return 0, err
+	}
+	return n, nil
+}
+
+// GDPRank returns the 1-based rank of gdp among all estimated GDP values
+func (s *Service) GDPRank(ctx context.Context, gdp float64) (int64, error) {
+	q := `SELECT COUNT(*) FROM countries WHERE estimated_gdp > ?`
+	var n int64
+	if err := s.DB.QueryRowContext(ctx, q, gdp).Scan(&n); err != nil {
+		logger.Error("repo: GDPRank failed", logger.WithError(err))
+		return 0, err
+	}
+	return n + 1, nil
+}
+
+// CurrencyCounts returns the most used currencies with their country counts
+func (s *Service) CurrencyCounts(ctx context.Context, limit int) ([]CurrencyCount, error) {
+	q := `SELECT currency_code, COUNT(*) AS n FROM countries WHERE currency_code IS NOT NULL GROUP BY currency_code ORDER BY n DESC, currency_code ASC LIMIT ?`
+	rows, err := s.DB.QueryContext(ctx, q, limit)
+	if err != nil {
+		logger.Error("repo: CurrencyCounts query failed", logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CurrencyCount
+	for rows.Next() {
+		var cc CurrencyCount
+		if err := rows.Scan(&cc.CurrencyCode, &cc.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, cc)
+	}
+
+	logger.Info("repo: CurrencyCounts complete", logger.Fields{"count": len(out)})
+	return out, nil
+}
+
+// PingDB checks the DB answers within DB.PingTimeout, logging when it doesn't
+func (s *Service) PingDB(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.Config.DB.PingTimeout)
+	defer cancel()
+	if err := s.DB.PingContext(ctx); err != nil {
+		logger.Error("repo: DB ping failed", logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
 // SaveLastRefreshed stores the last refresh timestamp in metadata
-func SaveLastRefreshed(tx *sql.Tx, t time.Time) error {
-	q := `INSERT INTO metadata (meta_key, meta_value, updated_at) VALUES ('last_refreshed_at', ?, ?) ON DUPLICATE KEY UPDATE meta_value = VALUES(meta_value), updated_at = VALUES(updated_at)`
+func (s *Service) SaveLastRefreshed(tx *sql.Tx, t time.Time) error {
+	q := `INSERT INTO metadata (meta_key, meta_value, updated_at) VALUES ('last_refreshed_at', ?, ?) ` + s.Dialect.Upsert([]string{"meta_key"}, "meta_value", "updated_at")
 	_, err := tx.Exec(q, t.UTC().Format(time.RFC3339), t)
 	if err != nil {
 		logger.Error("repo: SaveLastRefreshed failed", logger.WithError(err))
@@ -290,11 +950,85 @@ func SaveLastRefreshed(tx *sql.Tx, t time.Time) error {
 	return err
 }
 
+// SaveRatesBase records the currency stored exchange rates are quoted against
+func (s *Service) SaveRatesBase(tx *sql.Tx, base string) error {
+	q := `INSERT INTO metadata (meta_key, meta_value, updated_at) VALUES ('rates_base', ?, ?) ` + s.Dialect.Upsert([]string{"meta_key"}, "meta_value", "updated_at")
+	if _, err := tx.Exec(q, base, time.Now().UTC()); err != nil {
+		logger.Error("repo: SaveRatesBase failed", logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+// GetRatesBase reads the currency stored exchange rates are quoted against.
+// Data refreshed before the base was recorded is USD-based, and so is an
+// empty table.
+func (s *Service) GetRatesBase() (string, error) {
+	q := `SELECT meta_value FROM metadata WHERE meta_key='rates_base' LIMIT 1`
+	var v sql.NullString
+	if err := s.DB.QueryRow(q).Scan(&v); err != nil {
+		if err == sql.ErrNoRows {
+			return "USD", nil
+		}
+		logger.Error("repo: GetRatesBase failed", logger.WithError(err))
+		return "", err
+	}
+	if !v.Valid || v.String == "" {
+		return "USD", nil
+	}
+	return v.String, nil
+}
+
+// saveMeta upserts a metadata key
+func (s *Service) saveMeta(key, value string) error {
+	q := `INSERT INTO metadata (meta_key, meta_value, updated_at) VALUES (?, ?, ?) ` + s.Dialect.Upsert([]string{"meta_key"}, "meta_value", "updated_at")
+	if _, err := s.DB.Exec(q, key, value, time.Now().UTC()); err != nil {
+		logger.Error("repo: saveMeta failed", logger.Fields{"key": key}, logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+// GetSchemaVersion reads the schema version recorded by EnsureTables.
+// It returns nil when the tables have never been created.
+func (s *Service) GetSchemaVersion() (*int, error) {
+	q := `SELECT meta_value FROM metadata WHERE meta_key='schema_version' LIMIT 1`
+	var v sql.NullString
+	if err := s.DB.QueryRow(q).Scan(&v); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	n, err := strconv.Atoi(v.String)
+	if err != nil {
+		return nil, nil
+	}
+	return &n, nil
+}
+
+// ClearLastRefreshed removes the last refresh timestamp, as if the data had
+// never been refreshed, and returns the value that was cleared
+func (s *Service) ClearLastRefreshed() (*time.Time, error) {
+	prev, err := s.GetLastRefreshed()
+	if err != nil {
+		return nil, err
+	}
+
+	q := `DELETE FROM metadata WHERE meta_key='last_refreshed_at'`
+	if _, err := s.DB.Exec(q); err != nil {
+		logger.Error("repo: ClearLastRefreshed failed", logger.WithError(err))
+		return nil, err
+	}
+	logger.Info("repo: ClearLastRefreshed", logger.Fields{"had_value": prev != nil})
+	return prev, nil
+}
+
 // GetLastRefreshed reads the last refresh timestamp
-func GetLastRefreshed(db *sql.DB) (*time.Time, error) {
+func (s *Service) GetLastRefreshed() (*time.Time, error) {
 	q := `SELECT meta_value FROM metadata WHERE meta_key='last_refreshed_at' LIMIT 1`
 	var v sql.NullString
-	if err := db.QueryRow(q).Scan(&v); err != nil {
+	if err := s.DB.QueryRow(q).Scan(&v); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -0,0 +1,375 @@
+package countries
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zjoart/countryxchange/internal/database"
+)
+
+func TestGetAll(t *testing.T) {
+	svc := newTestService(t)
+	ng := testCountry("Nigeria", "Africa", "NGN", 200, 1600)
+	gh := testCountry("Ghana", "Africa", "GHS", 30, 15)
+	fr := testCountry("France", "Europe", "EUR", 60, 0.9)
+	// uses CHF as well as its primary EUR
+	li := testCountry("Liechtenstein", "Europe", "CHF", 1, 0.8)
+	li.CurrencyCodes = []string{"CHF", "EUR"}
+	seed(t, svc, ng, gh, fr, li)
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string
+	}{
+		{"all in id order", ListFilter{}, []string{"Nigeria", "Ghana", "France", "Liechtenstein"}},
+		{"region is case-insensitive", ListFilter{Region: "africa"}, []string{"Nigeria", "Ghana"}},
+		{"currency matches secondary codes", ListFilter{Currency: "eur"}, []string{"France", "Liechtenstein"}},
+		{"sorted", ListFilter{Sort: "population_desc"}, []string{"Nigeria", "France", "Ghana", "Liechtenstein"}},
+		{"paged", ListFilter{Sort: "name_asc", Limit: 2, Offset: 1}, []string{"Ghana", "Liechtenstein"}},
+		{"no match", ListFilter{Region: "Oceania"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := svc.GetAll(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+			if got := names(list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAll(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllRoundTrip(t *testing.T) {
+	svc := newTestService(t)
+	want := testCountry("Nigeria", "Africa", "NGN", 200, 1600)
+	seed(t, svc, want)
+
+	list, err := svc.GetAll(context.Background(), ListFilter{})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("GetAll = %d rows, %v", len(list), err)
+	}
+	got := list[0]
+	if got.ID == 0 || *got.Region != "Africa" || *got.ExchangeRate != 1600 || *got.EstimatedGDP != *want.EstimatedGDP {
+		t.Errorf("stored row = %+v", got)
+	}
+	if !reflect.DeepEqual(got.CurrencyRates, want.CurrencyRates) {
+		t.Errorf("CurrencyRates = %v, want %v", got.CurrencyRates, want.CurrencyRates)
+	}
+	if !got.LastRefreshedAt.Equal(want.LastRefreshedAt.Time) {
+		t.Errorf("LastRefreshedAt = %v, want %v", got.LastRefreshedAt, want.LastRefreshedAt)
+	}
+}
+
+func TestGetByName(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("United States of America", "Americas", "USD", 330, 1))
+
+	for _, name := range []string{"United States of America", "united states of america", "USA"} {
+		c, err := svc.GetByName(context.Background(), name)
+		if err != nil {
+			t.Fatalf("GetByName(%q): %v", name, err)
+		}
+		if c.Name != "United States of America" {
+			t.Errorf("GetByName(%q) = %q", name, c.Name)
+		}
+	}
+	if _, err := svc.GetByName(context.Background(), "Atlantis"); err != ErrNotFound {
+		t.Errorf("GetByName(unknown) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpsertCountry(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	first, err := svc.GetByName(context.Background(), "Ghana")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 31, 12))
+	n, err := svc.TotalCount(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("TotalCount = %d, %v; want 1 row after upserting the same name", n, err)
+	}
+	got, err := svc.GetByName(context.Background(), "Ghana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != first.ID || got.Population != 31 || *got.ExchangeRate != 12 {
+		t.Errorf("after upsert = id %d population %d rate %v, want id %d population 31 rate 12", got.ID, got.Population, *got.ExchangeRate, first.ID)
+	}
+}
+
+func TestInsertCountryDuplicate(t *testing.T) {
+	svc := newTestService(t)
+	c := testCountry("Ghana", "Africa", "GHS", 30, 15)
+	if _, err := svc.InsertCountry(context.Background(), c); err != nil {
+		t.Fatalf("first insert: %v", err)
+	}
+	if _, err := svc.InsertCountry(context.Background(), c); err != ErrDuplicate {
+		t.Errorf("second insert error = %v, want ErrDuplicate", err)
+	}
+}
+
+func TestDeleteByName(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+
+	deleted, err := svc.DeleteByName(context.Background(), "GHANA")
+	if err != nil || !deleted {
+		t.Fatalf("DeleteByName = %v, %v; want true", deleted, err)
+	}
+	deleted, err = svc.DeleteByName(context.Background(), "Ghana")
+	if err != nil || deleted {
+		t.Errorf("second DeleteByName = %v, %v; want false", deleted, err)
+	}
+}
+
+func TestDeleteByNames(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc,
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+		testCountry("Togo", "Africa", "XOF", 8, 600),
+		testCountry("Benin", "Africa", "XOF", 12, 600),
+	)
+
+	deleted, notFound, err := svc.DeleteByNames(context.Background(), []string{"ghana", "Togo", "Atlantis"})
+	if err != nil {
+		t.Fatalf("DeleteByNames: %v", err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"Ghana", "Togo"}) {
+		t.Errorf("deleted = %v", deleted)
+	}
+	if !reflect.DeepEqual(notFound, []string{"Atlantis"}) {
+		t.Errorf("notFound = %v", notFound)
+	}
+	list, err := svc.GetAll(context.Background(), ListFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(list); !reflect.DeepEqual(got, []string{"Benin"}) {
+		t.Errorf("remaining = %v", got)
+	}
+}
+
+func TestReadsStopWithContext(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := svc.GetAll(ctx, ListFilter{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetAll = %v, want context.Canceled", err)
+	}
+	if _, err := svc.CountFiltered(ctx, ListFilter{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CountFiltered = %v, want context.Canceled", err)
+	}
+	if _, err := svc.GetByName(ctx, "Ghana"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetByName = %v, want context.Canceled", err)
+	}
+	if _, err := svc.DeleteByName(ctx, "Ghana"); !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteByName = %v, want context.Canceled", err)
+	}
+	if _, err := svc.GetByName(context.Background(), "Ghana"); err != nil {
+		t.Errorf("Ghana gone after a canceled delete: %v", err)
+	}
+}
+
+func TestGetAllStableOrder(t *testing.T) {
+	svc := newTestService(t)
+	// inserted out of name order, with tied populations
+	seed(t, svc,
+		testCountry("Togo", "Africa", "XOF", 10, 600),
+		testCountry("Benin", "Africa", "XOF", 10, 600),
+		testCountry("Mali", "Africa", "XOF", 20, 600),
+		testCountry("Chad", "Africa", "XAF", 10, 600),
+	)
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string
+	}{
+		{"unsorted is id order", ListFilter{}, []string{"Togo", "Benin", "Mali", "Chad"}},
+		// a name-only projection could otherwise be served from the unique
+		// name index, in name order
+		{"projection is id order", ListFilter{Fields: "name"}, []string{"Togo", "Benin", "Mali", "Chad"}},
+		{"filtered is id order", ListFilter{Currency: "XOF"}, []string{"Togo", "Benin", "Mali"}},
+		{"ties broken by id", ListFilter{Sort: "population_asc"}, []string{"Togo", "Benin", "Chad", "Mali"}},
+		{"paged ties broken by id", ListFilter{Sort: "gdp_desc", Limit: 2, Offset: 1}, []string{"Togo", "Benin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := svc.GetAll(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+			second, err := svc.GetAll(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+			if !reflect.DeepEqual(names(first), names(second)) {
+				t.Errorf("two calls ordered %v and %v", names(first), names(second))
+			}
+			if !reflect.DeepEqual(names(first), tt.want) {
+				t.Errorf("GetAll(%+v) = %v, want %v", tt.filter, names(first), tt.want)
+			}
+		})
+	}
+}
+
+func TestWhereClausePopulation(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    ListFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{"none", ListFilter{}, "", nil},
+		{"min only", ListFilter{MinPopulation: "1000"}, " WHERE population >= ?", []interface{}{int64(1000)}},
+		{"max only", ListFilter{MaxPopulation: "0"}, " WHERE population <= ?", []interface{}{int64(0)}},
+		{"range with region and currency",
+			ListFilter{Region: "Africa", Currency: "xof", MinPopulation: "10", MaxPopulation: "50"},
+			" WHERE LOWER(region) = LOWER(?) AND (LOWER(currency_code) = LOWER(?) OR FIND_IN_SET(?, currency_codes) > 0)" +
+				" AND population >= ? AND population <= ?",
+			[]interface{}{"Africa", "xof", "XOF", int64(10), int64(50)}},
+		{"with a GDP range",
+			ListFilter{MinGDP: "1.5", MinPopulation: "10"},
+			" WHERE estimated_gdp >= ? AND population >= ?",
+			[]interface{}{1.5, int64(10)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.filter.whereClause(database.MySQL{})
+			if where != tt.wantWhere {
+				t.Errorf("where = %q\nwant    %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestGetAllPopulationRange(t *testing.T) {
+	svc := newTestService(t)
+	benin := testCountry("Benin", "Africa", "XOF", 12, 600)
+	benin.CurrencyCodes = []string{"XOF"}
+	seed(t, svc,
+		benin,
+		testCountry("Togo", "Africa", "XOF", 8, 600),
+		testCountry("Mali", "Africa", "XOF", 20, 600),
+		testCountry("Ghana", "Africa", "GHS", 30, 15),
+		testCountry("France", "Europe", "EUR", 60, 0.9),
+	)
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string
+	}{
+		{"inclusive bounds", ListFilter{MinPopulation: "8", MaxPopulation: "20"}, []string{"Benin", "Togo", "Mali"}},
+		{"min only", ListFilter{MinPopulation: "30"}, []string{"Ghana", "France"}},
+		{"max only", ListFilter{MaxPopulation: "10"}, []string{"Togo"}},
+		{"with region", ListFilter{Region: "africa", MinPopulation: "20"}, []string{"Mali", "Ghana"}},
+		{"with currency", ListFilter{Currency: "XOF", MaxPopulation: "15"}, []string{"Benin", "Togo"}},
+		{"all three", ListFilter{Region: "Africa", Currency: "xof", MinPopulation: "10", MaxPopulation: "15"}, []string{"Benin"}},
+		{"empty range", ListFilter{MinPopulation: "21", MaxPopulation: "29"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := svc.GetAll(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+			if got := names(list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAll(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+			n, err := svc.CountFiltered(context.Background(), tt.filter)
+			if err != nil || n != int64(len(tt.want)) {
+				t.Errorf("CountFiltered = %d, %v; want %d", n, err, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestGetAllGDPRange(t *testing.T) {
+	svc := newTestService(t)
+	// estimated GDP is population * 1500 / rate
+	seed(t, svc,
+		testCountry("Ghana", "Africa", "GHS", 30, 15),   // 3000
+		testCountry("Togo", "Africa", "XOF", 8, 600),    // 20
+		testCountry("France", "Europe", "EUR", 60, 0.9), // 100000
+		testCountry("Atlantis", "Oceania", "ATL", 5, 0), // NULL
+	)
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string
+	}{
+		{"inclusive bounds", ListFilter{MinGDP: "20", MaxGDP: "3000"}, []string{"Ghana", "Togo"}},
+		{"min only", ListFilter{MinGDP: "3000"}, []string{"Ghana", "France"}},
+		{"max only", ListFilter{MaxGDP: "20"}, []string{"Togo"}},
+		{"zero min skips NULL", ListFilter{MinGDP: "0"}, []string{"Ghana", "Togo", "France"}},
+		{"with region", ListFilter{Region: "Africa", MinGDP: "21"}, []string{"Ghana"}},
+		{"empty range", ListFilter{MinGDP: "21", MaxGDP: "2999"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := svc.GetAll(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+			if got := names(list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAll(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+			n, err := svc.CountFiltered(context.Background(), tt.filter)
+			if err != nil || n != int64(len(tt.want)) {
+				t.Errorf("CountFiltered = %d, %v; want %d", n, err, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestGetAllHasFlag(t *testing.T) {
+	svc := newTestService(t)
+	flagged := func(name, flag string) *Country {
+		c := testCountry(name, "Africa", "XOF", 10, 600)
+		c.FlagURL = &flag
+		return c
+	}
+	seed(t, svc,
+		flagged("Ghana", "https://flagcdn.com/gh.svg"),
+		testCountry("Togo", "Africa", "XOF", 8, 600),
+		flagged("Benin", ""),
+		flagged("Mali", "https://flagcdn.com/ml.svg"),
+	)
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string
+	}{
+		{"no filter", ListFilter{}, []string{"Ghana", "Togo", "Benin", "Mali"}},
+		{"with a flag", ListFilter{HasFlag: "true"}, []string{"Ghana", "Mali"}},
+		{"null or empty flag", ListFilter{HasFlag: "false"}, []string{"Togo", "Benin"}},
+		{"with population", ListFilter{HasFlag: "true", MaxPopulation: "9"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := svc.GetAll(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+			if got := names(list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAll(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,202 +5,764 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/internal/database"
+	"github.com/zjoart/countryxchange/internal/metrics"
+	"github.com/zjoart/countryxchange/internal/middleware"
+	"github.com/zjoart/countryxchange/pkg/api"
 	"github.com/zjoart/countryxchange/pkg/logger"
 )
 
 const (
-	countriesURL = "https://restcountries.com/v2/all?fields=name,capital,region,population,flag,currencies"
-	ratesURL     = "https://open.er-api.com/v6/latest/USD"
+	restCountryFields   = "name,capital,region,population,flag,currencies,numericCode,area"
+	defaultCountriesURL = "https://restcountries.com/v2/all?fields=" + restCountryFields
+	// %s is the path-escaped country name
+	defaultCountryURL = "https://restcountries.com/v2/name/%s?fullText=true&fields=" + restCountryFields
+	// the base currency code is appended to the rates URL
+	defaultRatesURL = "https://open.er-api.com/v6/latest/"
 )
 
+// Service carries what the refresh, the repo functions and the handlers
+// depend on, so they can be pointed at other feeds, another database or a
+// fixed clock
+type Service struct {
+	DB     *sql.DB
+	Config *config.Config
+	// Dialect renders the statements whose syntax differs per driver
+	Dialect database.Dialect
+	// Client fetches the upstream feeds
+	Client *http.Client
+	// CountriesURL and RatesURL are the live feeds; fixtures mode ignores
+	// them. RatesURL is completed with the base currency code.
+	CountriesURL string
+	RatesURL     string
+	// CountryURL looks up one country by name, with %s for the name
+	CountryURL string
+	// Now stamps last_refreshed_at
+	Now func() time.Time
+
+	rates *ratesCache
+	// snapshots serves reads (marked stale) while the DB is unavailable
+	snapshots *snapshotStore
+	// bulkOps caps concurrent transaction-heavy operations
+	bulkOps *bulkLimiter
+	// imageJobs holds the state of POST /countries/image/generate jobs
+	imageJobs *imageJobStore
+	// imageDisabled is why the image feature is off ("" = available)
+	imageDisabled string
+	// queryLog thins the debug logging of list queries (and their filter
+	// args), per cfg.QueryLogSample
+	queryLog *logger.Sampler
+	// background tracks work that outlives its request, see goBackground
+	background sync.WaitGroup
+}
+
+// NewService returns a Service using the live upstream feeds and wall clock.
+// dialect must match the driver db was opened with.
+func NewService(db *sql.DB, cfg *config.Config, dialect database.Dialect) *Service {
+	return &Service{
+		DB:            db,
+		Config:        cfg,
+		Dialect:       dialect,
+		Client:        &http.Client{Timeout: cfg.External.Timeout},
+		CountriesURL:  defaultCountriesURL,
+		RatesURL:      defaultRatesURL,
+		CountryURL:    defaultCountryURL,
+		Now:           time.Now,
+		rates:         newRatesCache(),
+		snapshots:     newSnapshotStore(),
+		bulkOps:       &bulkLimiter{},
+		imageJobs:     &imageJobStore{jobs: make(map[string]*ImageJob)},
+		imageDisabled: imageDisabledReason(&cfg.Image),
+		queryLog:      logger.NewSampler(cfg.QueryLogSample),
+	}
+}
+
+// logFields merges fields and tags them with the request ID on ctx, if any,
+// so log lines of concurrent requests can be told apart
+func logFields(ctx context.Context, fields ...logger.Fields) logger.Fields {
+	if id := middleware.RequestID(ctx); id != "" {
+		fields = append(fields, logger.WithRequestID(id))
+	}
+	return logger.Merge(fields...)
+}
+
 // RefreshResult summarizes a refresh operation
 type RefreshResult struct {
 	Total         int
+	Skipped       int // below Refresh.MinPopulation
+	StaleRates    bool
+	Warnings      []string // why a partial (StaleRates) refresh is incomplete
+	ByRegion      map[string]int
 	LastRefreshed time.Time
+	Timings       RefreshTimings
+	Image         *RefreshImage // only set when the image is rendered synchronously
 }
 
+// RefreshTimings is shared with pkg/client
+type RefreshTimings = api.RefreshTimings
+
+// RefreshImage reports the summary image rendered during a sync refresh
+type RefreshImage = api.RefreshImage
+
+// RefreshImage statuses
+const (
+	ImageGenerated = "generated"
+	ImageFailed    = "failed"
+	ImageDisabled  = "disabled"
+)
+
 // external structs
 type restCountry struct {
-	Name       string `json:"name"`
-	Capital    string `json:"capital"`
-	Region     string `json:"region"`
-	Population int64  `json:"population"`
-	Flag       string `json:"flag"`
-	Currencies []struct {
+	Name        string   `json:"name"`
+	Capital     string   `json:"capital"`
+	Region      string   `json:"region"`
+	Population  int64    `json:"population"`
+	Flag        string   `json:"flag"`
+	NumericCode string   `json:"numericCode"`
+	Area        *float64 `json:"area"`
+	Currencies  []struct {
 		Code string `json:"code"`
 	} `json:"currencies"`
 }
 
 type ratesResp struct {
-	Result string             `json:"result"`
-	Rates  map[string]float64 `json:"rates"`
+	Result   string             `json:"result"`
+	BaseCode string             `json:"base_code"`
+	Rates    map[string]float64 `json:"rates"`
+	// fetchedAt is when the feed was downloaded; a cached feed keeps it
+	fetchedAt time.Time
 }
 
-// ExternalError marks which external API failed
+// ExternalError marks which external API failed. Status is the upstream HTTP
+// status when one was received; RetryAfter is only set for a 429 that
+// carried a Retry-After header.
 type ExternalError struct {
-	API string
+	API        string
+	Status     int
+	RetryAfter time.Duration
 }
 
 func (e ExternalError) Error() string {
+	if e.RateLimited() {
+		return fmt.Sprintf("Could not fetch data from %s (rate limited)", e.API)
+	}
 	return fmt.Sprintf("Could not fetch data from %s", e.API)
 }
 
-// Refresh fetches external data and updates DB in a transaction.
-// If external fetch fails, no DB changes are made.
-func Refresh(ctx context.Context, db *sql.DB) (*RefreshResult, error) {
-	logger.Info("service: Refresh started")
-	client := &http.Client{Timeout: 20 * time.Second}
+// RateLimited reports whether the upstream answered 429
+func (e ExternalError) RateLimited() bool {
+	return e.Status == http.StatusTooManyRequests
+}
+
+// refreshFailureAPI names the upstream a failed refresh is blamed on in
+// metrics, "other" when it wasn't an upstream failure
+func refreshFailureAPI(err error) string {
+	if extErr, ok := err.(ExternalError); ok {
+		return extErr.API
+	}
+	return "other"
+}
+
+// parseRetryAfter reads a Retry-After header given either as delay seconds
+// or as an HTTP date; it returns 0 when absent or unparseable
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
 
-	// fetch countries
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, countriesURL, nil)
-	resp, err := client.Do(req)
+// openFeed returns the body of an upstream feed: the HTTP response in live
+// mode, or the fixture file in fixtures mode
+func openFeed(ctx context.Context, client *http.Client, ext *config.ExternalConfig, url, fixture, api string) (io.ReadCloser, error) {
+	if ext.Mode == "fixtures" {
+		f, err := os.Open(fixture)
+		if err != nil {
+			logger.Warn("service: failed opening fixture", logFields(ctx, logger.Fields{"api": api, "path": fixture}, logger.WithError(err)))
+			return nil, ExternalError{API: api}
+		}
+		return f, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			logger.Warn("service: failed fetching "+api, logFields(ctx, logger.WithError(err)))
+			return nil, ExternalError{API: api}
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp.Body, nil
+		}
+		resp.Body.Close()
+
+		extErr := ExternalError{API: api, Status: resp.StatusCode}
+		switch {
+		case extErr.RateLimited():
+			extErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			logger.Warn("service: "+api+" rate limited", logFields(ctx, logger.Fields{"retry_after": extErr.RetryAfter.String(), "attempt": attempt + 1}))
+		case resp.StatusCode >= 500:
+			logger.Warn("service: "+api+" server error", logFields(ctx, logger.Fields{"status": resp.StatusCode}))
+		default:
+			logger.Warn("service: "+api+" returned non-200", logFields(ctx, logger.Fields{"status": resp.StatusCode}))
+		}
+
+		// wait out a short Retry-After once; longer ones go back to the caller
+		if attempt > 0 || !extErr.RateLimited() || extErr.RetryAfter <= 0 || extErr.RetryAfter > ext.MaxRetryAfter {
+			return nil, extErr
+		}
+		select {
+		case <-ctx.Done():
+			return nil, extErr
+		case <-time.After(extErr.RetryAfter):
+		}
+	}
+}
+
+// fetchCountries downloads and decodes the restcountries feed
+func (s *Service) fetchCountries(ctx context.Context) ([]restCountry, error) {
+	return s.fetchCountriesFrom(ctx, s.CountriesURL)
+}
+
+// fetchCountry looks name up upstream, returning ErrNotFound when
+// restcountries doesn't know it. Fixtures mode searches the whole fixture.
+func (s *Service) fetchCountry(ctx context.Context, name string) (restCountry, error) {
+	rc, err := s.fetchCountriesFrom(ctx, fmt.Sprintf(s.CountryURL, url.PathEscape(name)))
+	if extErr, ok := err.(ExternalError); ok && extErr.Status == http.StatusNotFound {
+		return restCountry{}, ErrNotFound
+	}
 	if err != nil {
-		logger.Warn("service: failed fetching countries", logger.WithError(err))
-		return nil, ExternalError{API: "restcountries"}
+		return restCountry{}, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		logger.Warn("service: restcountries returned non-200", logger.Fields{"status": resp.StatusCode})
-		return nil, ExternalError{API: "restcountries"}
+	for _, rcountry := range rc {
+		if strings.EqualFold(rcountry.Name, name) {
+			return rcountry, nil
+		}
 	}
+	return restCountry{}, ErrNotFound
+}
+
+// fetchCountriesFrom downloads and decodes a restcountries response
+func (s *Service) fetchCountriesFrom(ctx context.Context, feedURL string) ([]restCountry, error) {
+	ext := &s.Config.External
+	body, err := openFeed(ctx, s.Client, ext, feedURL, ext.CountriesFixture, "restcountries")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
 
 	var rc []restCountry
-	if err := json.NewDecoder(resp.Body).Decode(&rc); err != nil {
-		logger.Warn("service: failed decoding restcountries response", logger.WithError(err))
+	if err := json.NewDecoder(body).Decode(&rc); err != nil {
+		logger.Warn("service: failed decoding restcountries response", logFields(ctx, logger.WithError(err)))
 		return nil, ExternalError{API: "restcountries"}
 	}
+	return rc, nil
+}
 
-	// fetch rates
-	req2, _ := http.NewRequestWithContext(ctx, http.MethodGet, ratesURL, nil)
-	resp2, err := client.Do(req2)
+// fetchRates downloads and decodes the exchange rates feed quoted against
+// base, normalizing its keys to uppercase currency codes. A base the feed
+// has no rate for is a *ValidationError.
+func (s *Service) fetchRates(ctx context.Context, base string) (*ratesResp, error) {
+	ext := &s.Config.External
+	body, err := openFeed(ctx, s.Client, ext, s.RatesURL+base, ext.RatesFixture, "exchangerates")
 	if err != nil {
-		logger.Warn("service: failed fetching exchange rates", logger.WithError(err))
-		return nil, ExternalError{API: "exchangerates"}
-	}
-	defer resp2.Body.Close()
-	if resp2.StatusCode != http.StatusOK {
-		logger.Warn("service: exchangerates returned non-200", logger.Fields{"status": resp2.StatusCode})
-		return nil, ExternalError{API: "exchangerates"}
+		return nil, err
 	}
+	defer body.Close()
 
 	var rr ratesResp
-	if err := json.NewDecoder(resp2.Body).Decode(&rr); err != nil {
-		logger.Warn("service: failed decoding exchangerates response", logger.WithError(err))
+	if err := json.NewDecoder(body).Decode(&rr); err != nil {
+		logger.Warn("service: failed decoding exchangerates response", logFields(ctx, logger.WithError(err)))
 		return nil, ExternalError{API: "exchangerates"}
 	}
-
-	// prepare DB
-	if err := EnsureTables(db); err != nil {
-		logger.Error("service: EnsureTables failed", logger.WithError(err))
-		return nil, err
+	rr.Rates = normalizeRates(rr.Rates, ext.StrictRateKeys)
+	if _, ok := rr.Rates[base]; !ok {
+		return nil, &ValidationError{Errors: map[string]string{"base": fmt.Sprintf("%s is not a currency the rates API knows", base)}}
 	}
+	// fixtures hold one feed; quote it against base ourselves
+	if rr.BaseCode != "" && !strings.EqualFold(rr.BaseCode, base) {
+		rr.Rates = rebaseRates(rr.Rates, base)
+	}
+	rr.BaseCode = base
+	rr.fetchedAt = s.Now()
+	return &rr, nil
+}
 
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		logger.Error("service: begin tx failed", logger.WithError(err))
-		return nil, err
+// rebaseRates converts rates to be quoted against base, which must be one
+// of their keys
+func rebaseRates(rates map[string]float64, base string) map[string]float64 {
+	div := rates[base]
+	out := make(map[string]float64, len(rates))
+	for code, v := range rates {
+		out[code] = v / div
 	}
+	return out
+}
 
-	// seed rand
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+// normalizeRates uppercases every rate key so lookups don't depend on the
+// provider's casing. Keys that don't look like currency codes are logged,
+// and dropped when strict is set.
+func normalizeRates(raw map[string]float64, strict bool) map[string]float64 {
+	out := make(map[string]float64, len(raw))
+	for k, v := range raw {
+		code := strings.ToUpper(strings.TrimSpace(k))
+		if !isCurrencyCode(code) {
+			logger.Warn("service: unexpected exchange rate key", logger.Fields{"key": k, "dropped": strict})
+			if strict {
+				continue
+			}
+		}
+		if _, dup := out[code]; dup {
+			logger.Warn("service: duplicate exchange rate key after normalization", logger.Fields{"key": k})
+			continue
+		}
+		out[code] = v
+	}
+	return out
+}
 
-	now := time.Now().UTC()
+// isCurrencyCode reports whether s looks like an ISO 4217 code (e.g. USD)
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
 
-	processed := 0
-	for _, rcountry := range rc {
-		// prepare Country struct for validation
-		if rcountry.Name == "" {
-			logger.Warn("service: country name missing from external API")
+// currencyCodes returns every distinct currency code of rcountry, uppercased,
+// in upstream order so the primary currency comes first
+func currencyCodes(rcountry restCountry) []string {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, cur := range rcountry.Currencies {
+		code := strings.ToUpper(strings.TrimSpace(cur.Code))
+		if code == "" || seen[code] {
 			continue
 		}
+		seen[code] = true
+		codes = append(codes, code)
+	}
+	return codes
+}
 
-		var currencyCode *string
-		var exchangeRate *float64
-		var estimatedGDP *float64
+// currencyRates picks the rate of each code from rates, leaving out codes
+// the feed doesn't list
+func currencyRates(codes []string, rates map[string]float64) map[string]float64 {
+	var out map[string]float64
+	for _, code := range codes {
+		if rate, ok := rates[code]; ok {
+			if out == nil {
+				out = make(map[string]float64, len(codes))
+			}
+			out[code] = rate
+		}
+	}
+	return out
+}
 
-		if len(rcountry.Currencies) > 0 && rcountry.Currencies[0].Code != "" {
-			code := rcountry.Currencies[0].Code
-			currencyCode = &code
-			if rate, ok := rr.Rates[code]; ok {
-				exchangeRate = &rate
-				// compute estimated_gdp = population * random(1000-2000) / exchange_rate
-				mult := float64(r.Intn(1001) + 1000) // 1000..2000
-				est := float64(rcountry.Population) * mult / (*exchangeRate)
+// buildCountry maps an upstream country and the rates onto a Country
+func buildCountry(rcountry restCountry, rates map[string]float64, r *rand.Rand, now time.Time, gdpCfg *config.GDPConfig) *Country {
+	var currencyCode *string
+	var exchangeRate *float64
+	var estimatedGDP *float64
+
+	if len(rcountry.Currencies) > 0 && rcountry.Currencies[0].Code != "" {
+		code := strings.ToUpper(rcountry.Currencies[0].Code)
+		currencyCode = &code
+		if rate, ok := rates[code]; ok {
+			exchangeRate = &rate
+			// skipped when no rand is supplied, e.g. for read-only diffs
+			if r != nil {
+				est := estimateGDP(rcountry.Population, rate, r, gdpCfg)
 				estimatedGDP = &est
-			} else {
-				// not found in rates => leave exchangeRate nil and estimated_gdp nil
-				exchangeRate = nil
-				estimatedGDP = nil
 			}
 		} else {
-			// currencies empty
-			currencyCode = nil
+			// not found in rates => leave exchangeRate nil and estimated_gdp nil
 			exchangeRate = nil
+			estimatedGDP = nil
+		}
+	} else {
+		// currencies empty: NULL by default so the country doesn't show up
+		// as a legitimate 0 in GDP sorts and the top-5 chart
+		currencyCode = nil
+		exchangeRate = nil
+		if gdpCfg.EmptyCurrencyZero {
 			zero := 0.0
 			estimatedGDP = &zero
 		}
+	}
+
+	codes := currencyCodes(rcountry)
+	c := &Country{
+		Name:            rcountry.Name,
+		CurrencyCodes:   codes,
+		CurrencyRates:   currencyRates(codes, rates),
+		Population:      rcountry.Population,
+		Source:          SourceRefresh,
+		LastRefreshedAt: api.NewTime(now),
+	}
+	if rcountry.Capital != "" {
+		c.Capital = &rcountry.Capital
+	}
+	if rcountry.Region != "" {
+		c.Region = &rcountry.Region
+	}
+	if rcountry.Flag != "" {
+		c.FlagURL = &rcountry.Flag
+	}
+	if rcountry.NumericCode != "" {
+		c.NumericCode = &rcountry.NumericCode
+	}
+	c.Area = rcountry.Area
+	c.CurrencyCode = currencyCode
+	c.ExchangeRate = exchangeRate
+	c.EstimatedGDP = estimatedGDP
+	return c
+}
 
-		c := &Country{
-			Name:            rcountry.Name,
-			Population:      rcountry.Population,
-			LastRefreshedAt: &now,
+// UpstreamCountry is the raw upstream entry for one country plus the rate
+// its primary currency would be matched to
+type UpstreamCountry struct {
+	Upstream     restCountry `json:"upstream"`
+	CurrencyCode *string     `json:"currency_code"`
+	ExchangeRate *float64    `json:"exchange_rate"`
+}
+
+// FetchUpstreamCountry looks a country up in the live upstream feeds without
+// touching the DB. It returns ErrNotFound when upstream doesn't know name.
+func (s *Service) FetchUpstreamCountry(ctx context.Context, name string) (*UpstreamCountry, error) {
+	rc, err := s.fetchCountries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rcountry := range rc {
+		if !strings.EqualFold(rcountry.Name, name) {
+			continue
+		}
+
+		rr, err := s.fetchRates(ctx, s.ratesBase(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		out := &UpstreamCountry{Upstream: rcountry}
+		if len(rcountry.Currencies) > 0 && rcountry.Currencies[0].Code != "" {
+			code := strings.ToUpper(rcountry.Currencies[0].Code)
+			out.CurrencyCode = &code
+			if rate, ok := rr.Rates[code]; ok {
+				out.ExchangeRate = &rate
+			}
+		}
+		return out, nil
+	}
+	return nil, ErrNotFound
+}
+
+// RefreshCountry re-fetches one country and the current rates (quoted
+// against the stored base, so the row matches the others) and upserts just
+// that row. It returns ErrNotFound when upstream doesn't know name.
+func (s *Service) RefreshCountry(ctx context.Context, name string) (*Country, error) {
+	logger.Info("service: RefreshCountry started", logFields(ctx, logger.Fields{"name": name}))
+	cfg := s.Config
+
+	if err := s.EnsureTables(); err != nil {
+		return nil, err
+	}
+	base, err := s.GetRatesBase()
+	if err != nil {
+		return nil, err
+	}
+
+	rcountry, err := s.fetchCountry(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := s.cachedFetchRates(withRatesBase(ctx, base))
+	if err != nil {
+		return nil, err
+	}
+
+	c := buildCountry(rcountry, rr.Rates, newGDPRand(&cfg.GDP), s.Now().UTC(), &cfg.GDP)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		return s.UpsertCountry(tx, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.GetByName(ctx, c.Name)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("service: RefreshCountry completed", logFields(ctx, logger.Fields{"name": stored.Name, "id": stored.ID}))
+	return stored, nil
+}
+
+// fetchFeeds fetches the countries and rates feeds concurrently, so a
+// refresh waits for the slower of the two rather than their sum. The first
+// failure cancels the other fetch and is returned as err, except for a rates
+// ExternalError when UseLastKnownRatesOnFailure is on: that one leaves the
+// countries fetch running and comes back as ratesErr with a nil rr.
+func (s *Service) fetchFeeds(ctx context.Context, timings *RefreshTimings) (rc []restCountry, rr *ratesResp, ratesErr, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	fail := func(e error) {
+		once.Do(func() {
+			err = e
+			cancel()
+		})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		var e error
+		if rc, e = s.fetchCountries(ctx); e != nil {
+			fail(e)
+		}
+		timings.FetchCountriesMs = time.Since(start).Milliseconds()
+	}()
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		var e error
+		if rr, e = s.cachedFetchRates(ctx); e != nil {
+			if _, ok := e.(ExternalError); ok && s.Config.Refresh.UseLastKnownRatesOnFailure {
+				ratesErr = e
+			} else {
+				fail(e)
+			}
+		}
+		timings.FetchRatesMs = time.Since(start).Milliseconds()
+	}()
+	wg.Wait()
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return rc, rr, ratesErr, nil
+}
+
+// Refresh fetches external data and updates DB in a transaction.
+// If external fetch fails, no DB changes are made.
+func (s *Service) Refresh(ctx context.Context) (res *RefreshResult, err error) {
+	logger.Info("service: Refresh started", logFields(ctx))
+	cfg := s.Config
+
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			metrics.ObserveRefresh(time.Since(start), 0, refreshFailureAPI(err))
+			return
 		}
-		if rcountry.Capital != "" {
-			c.Capital = &rcountry.Capital
+		metrics.ObserveRefresh(time.Since(start), res.Total, "")
+	}()
+
+	var timings RefreshTimings
+	rc, rr, ratesErr, err := s.fetchFeeds(ctx, &timings)
+	if err != nil {
+		return nil, err
+	}
+
+	base := s.ratesBase(ctx)
+	staleRates := false
+	if ratesErr != nil {
+		// stored rates quoted against another base would skew every GDP
+		if stored, berr := s.GetRatesBase(); berr != nil || stored != base {
+			logger.Warn("service: last known rates use another base", logFields(ctx, logger.Fields{"base": base, "stored_base": stored}))
+			return nil, ratesErr
+		}
+		rates, lerr := s.LastKnownRates(ctx, base)
+		if lerr != nil || len(rates) == 0 {
+			logger.Warn("service: no last known rates to fall back to", logFields(ctx, logger.Fields{"stored": len(rates)}))
+			return nil, ratesErr
 		}
-		if rcountry.Region != "" {
-			c.Region = &rcountry.Region
+		logger.Warn("service: rates unavailable, reusing last known rates", logFields(ctx, logger.Fields{"currencies": len(rates)}))
+		rr = &ratesResp{Rates: rates}
+		staleRates = true
+	}
+
+	// hold a bulk slot for the DB phase only; the fetches above don't touch MySQL
+	release, err := s.bulkOps.acquire(ctx, &cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// prepare DB
+	phase := time.Now()
+	if err := s.EnsureTables(); err != nil {
+		logger.Error("service: EnsureTables failed", logFields(ctx, logger.WithError(err)))
+		return nil, err
+	}
+
+	// seed rand
+	r := newGDPRand(&cfg.GDP)
+
+	now := s.Now().UTC()
+
+	// build and validate every row up front so a retried transaction
+	// writes exactly the same data
+	var valid []*Country
+	byRegion := make(map[string]int)
+	skipped := 0
+	for _, rcountry := range rc {
+		// prepare Country struct for validation
+		if rcountry.Name == "" {
+			logger.Warn("service: country name missing from external API", logFields(ctx))
+			continue
 		}
-		if rcountry.Flag != "" {
-			c.FlagURL = &rcountry.Flag
+		if rcountry.Population < cfg.Refresh.MinPopulation {
+			skipped++
+			continue
 		}
-		c.CurrencyCode = currencyCode
-		c.ExchangeRate = exchangeRate
-		c.EstimatedGDP = estimatedGDP
+
+		c := buildCountry(rcountry, rr.Rates, r, now, &cfg.GDP)
 
 		// validate before upserting
 		if err := c.Validate(); err != nil {
-			logger.Warn("service: country validation failed", logger.Fields{
+			logger.Warn("service: country validation failed", logFields(ctx, logger.Fields{
 				"country": c.Name,
 				"errors":  err.(*ValidationError).Errors,
-			})
+			}))
 			continue
 		}
+		valid = append(valid, c)
 
-		if err := UpsertCountry(tx, c); err != nil {
-			logger.Error("service: UpsertCountry failed", logger.WithError(err))
-			tx.Rollback()
-			return nil, err
+		// tally per region so gaps in the upstream feed are easy to spot
+		regionKey := "Unknown"
+		if c.Region != nil {
+			regionKey = *c.Region
 		}
-		processed++
+		byRegion[regionKey]++
 	}
 
-	// save last refreshed
-	if err := SaveLastRefreshed(tx, now); err != nil {
-		logger.Error("service: SaveLastRefreshed failed", logger.WithError(err))
-		tx.Rollback()
+	if cfg.Refresh.UpsertWorkers > 1 {
+		err = s.upsertParallel(ctx, valid, now, base)
+	} else {
+		err = s.withTx(ctx, func(tx *sql.Tx) error {
+			for _, c := range valid {
+				if err := s.UpsertCountry(tx, c); err != nil {
+					logger.Error("service: UpsertCountry failed", logFields(ctx, logger.WithError(err)))
+					return err
+				}
+			}
+
+			// save last refreshed
+			if err := s.SaveLastRefreshed(tx, now); err != nil {
+				logger.Error("service: SaveLastRefreshed failed", logFields(ctx, logger.WithError(err)))
+				return err
+			}
+			if err := s.SaveRatesBase(tx, base); err != nil {
+				return err
+			}
+			return recordHistory(tx, now, valid, cfg.Refresh.HistoryKeep)
+		})
+	}
+	if err != nil {
 		return nil, err
 	}
+	// reused last known rates are not a new observation, and a cached feed
+	// is recorded again under the time it was fetched
+	if !staleRates {
+		err := s.withTx(ctx, func(tx *sql.Tx) error {
+			return s.recordRates(tx, rr.fetchedAt, base, rr.Rates, cfg.Refresh.RateHistoryRetention)
+		})
+		if err != nil {
+			// the countries are committed; only this point of the series is lost
+			logger.Warn("service: recording rate history failed", logFields(ctx, logger.WithError(err)))
+		}
+	}
+	processed := len(valid)
+	var warnings []string
+	if staleRates {
+		warnings = append(warnings, "exchange rates feed unavailable; last known rates reused")
+		missing := 0
+		for _, c := range valid {
+			if c.CurrencyCode != nil && c.ExchangeRate == nil {
+				missing++
+			}
+		}
+		if missing > 0 {
+			warnings = append(warnings, fmt.Sprintf("%d countries have no last known rate for their currency", missing))
+		}
+	}
+	timings.DBWriteMs = time.Since(phase).Milliseconds()
 
-	if err := tx.Commit(); err != nil {
-		logger.Error("service: tx commit failed", logger.WithError(err))
-		tx.Rollback()
-		return nil, err
+	// keep the in-memory read fallback in sync with the new data
+	if all, err := s.GetAll(ctx, ListFilter{}); err == nil {
+		s.snapshots.storeList(ListFilter{}, all)
 	}
 
-	// generate summary image (best-effort)
-	go func() {
-		if err := GenerateSummaryImage(db, "cache/summary.png"); err != nil {
-			logger.Warn("service: GenerateSummaryImage failed", logger.WithError(err))
-		} else {
-			logger.Info("service: GenerateSummaryImage completed")
+	// generate summary image (best-effort); a failure never fails the
+	// refresh, but in sync mode it is reported back to the caller
+	var image *RefreshImage
+	if s.imageDisabled != "" {
+		if cfg.Image.SyncWithRefresh {
+			image = &RefreshImage{Status: ImageDisabled, Error: s.imageDisabled}
 		}
-	}()
+	} else if cfg.Image.SyncWithRefresh {
+		phase = time.Now()
+		image = &RefreshImage{Status: ImageGenerated}
+		if err := s.GenerateSummaryImage(summaryImagePath); err != nil {
+			logger.Warn("service: GenerateSummaryImage failed", logFields(ctx, logger.WithError(err)))
+			image = &RefreshImage{Status: ImageFailed, Error: err.Error()}
+		}
+		imageMs := time.Since(phase).Milliseconds()
+		timings.ImageMs = &imageMs
+	} else {
+		s.goBackground(func() {
+			start := time.Now()
+			if err := s.GenerateSummaryImage(summaryImagePath); err != nil {
+				logger.Warn("service: GenerateSummaryImage failed", logFields(ctx, logger.WithError(err)))
+			} else {
+				logger.Info("service: GenerateSummaryImage completed", logFields(ctx, logger.Fields{"image_ms": time.Since(start).Milliseconds()}))
+			}
+		})
+	}
 
-	logger.Info("service: Refresh completed", logger.Fields{"total_processed": processed})
-	return &RefreshResult{Total: processed, LastRefreshed: now}, nil
+	logger.Info("service: Refresh completed", logFields(ctx, logger.Fields{
+		"total_processed":    processed,
+		"skipped":            skipped,
+		"stale_rates":        staleRates,
+		"by_region":          byRegion,
+		"fetch_countries_ms": timings.FetchCountriesMs,
+		"fetch_rates_ms":     timings.FetchRatesMs,
+		"db_write_ms":        timings.DBWriteMs,
+	}))
+	return &RefreshResult{Total: processed, Skipped: skipped, StaleRates: staleRates, Warnings: warnings, ByRegion: byRegion, LastRefreshed: now, Timings: timings, Image: image}, nil
 }
@@ -0,0 +1,300 @@
+package countries
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// delayedServer answers body after delay, or gives up when the client goes
+// away first
+func delayedServer(t *testing.T, delay time.Duration, status int, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+const (
+	countriesFeed = `[{"name":"Ghana","population":30,"currencies":[{"code":"GHS"}]}]`
+	ratesFeed     = `{"result":"success","base_code":"USD","rates":{"USD":1,"GHS":15}}`
+)
+
+func TestFetchFeedsConcurrent(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	svc := newTestService(t)
+	svc.CountriesURL = delayedServer(t, delay, http.StatusOK, countriesFeed).URL
+	svc.RatesURL = delayedServer(t, delay, http.StatusOK, ratesFeed).URL + "/"
+
+	var timings RefreshTimings
+	start := time.Now()
+	rc, rr, ratesErr, err := svc.fetchFeeds(context.Background(), &timings)
+	elapsed := time.Since(start)
+	if err != nil || ratesErr != nil {
+		t.Fatalf("fetchFeeds: %v, %v", err, ratesErr)
+	}
+	if len(rc) != 1 || rr.Rates["GHS"] != 15 {
+		t.Errorf("got %d countries and rates %v", len(rc), rr.Rates)
+	}
+	// max(a, b) plus slack, well short of a + b
+	if elapsed >= 2*delay-delay/4 {
+		t.Errorf("fetchFeeds took %v for two %v feeds, want close to %v", elapsed, delay, delay)
+	}
+	if timings.FetchCountriesMs < delay.Milliseconds() || timings.FetchRatesMs < delay.Milliseconds() {
+		t.Errorf("timings = %+v, want both at least %dms", timings, delay.Milliseconds())
+	}
+}
+
+func TestFetchFeedsFailureCancelsOther(t *testing.T) {
+	svc := newTestService(t)
+	svc.CountriesURL = delayedServer(t, 5*time.Second, http.StatusOK, countriesFeed).URL
+	svc.RatesURL = delayedServer(t, 0, http.StatusInternalServerError, "").URL + "/"
+
+	start := time.Now()
+	_, _, _, err := svc.fetchFeeds(context.Background(), &RefreshTimings{})
+	if extErr, ok := err.(ExternalError); !ok || extErr.API != "exchangerates" {
+		t.Fatalf("err = %v, want the exchangerates ExternalError", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("fetchFeeds took %v; the failed rates fetch should cancel the countries fetch", elapsed)
+	}
+}
+
+func TestFetchCancelledMidFetch(t *testing.T) {
+	svc := newTestService(t)
+	// the client timeout alone would take far longer than the test allows
+	svc.Client.Timeout = 10 * time.Second
+	svc.CountriesURL = delayedServer(t, 10*time.Second, http.StatusOK, countriesFeed).URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := svc.fetchCountries(ctx)
+	if _, ok := err.(ExternalError); !ok {
+		t.Fatalf("err = %v, want an ExternalError", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("fetch returned %v after the cancel, want promptly", elapsed)
+	}
+}
+
+func TestClientTimeoutFromConfig(t *testing.T) {
+	cfg := testConfig()
+	cfg.External.Timeout = 3 * time.Second
+	svc := NewService(nil, cfg, nil)
+	if svc.Client.Timeout != 3*time.Second {
+		t.Errorf("client timeout = %v, want External.Timeout", svc.Client.Timeout)
+	}
+}
+
+// sequenceServer answers each request with the next of responses, repeating
+// the last one, and counts the requests
+func sequenceServer(t *testing.T, responses ...func(w http.ResponseWriter)) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&hits, 1))
+		if n > len(responses) {
+			n = len(responses)
+		}
+		responses[n-1](w)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func rateLimited(retryAfter string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", retryAfter)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+}
+
+func TestOpenFeedRateLimited(t *testing.T) {
+	ok := func(w http.ResponseWriter) { w.Write([]byte(ratesFeed)) }
+	tests := []struct {
+		name          string
+		maxRetryAfter time.Duration
+		responses     []func(w http.ResponseWriter)
+		wantErr       bool
+		wantRetry     time.Duration
+		wantHits      int32
+	}{
+		{"passed back without a max", 0, []func(http.ResponseWriter){rateLimited("7")}, true, 7 * time.Second, 1},
+		{"longer than the max", 2 * time.Second, []func(http.ResponseWriter){rateLimited("5")}, true, 5 * time.Second, 1},
+		{"waited out and retried once", 2 * time.Second, []func(http.ResponseWriter){rateLimited("1"), ok}, false, 0, 2},
+		{"second 429 is not retried", 2 * time.Second, []func(http.ResponseWriter){rateLimited("1")}, true, time.Second, 2},
+		{"without Retry-After", 2 * time.Second, []func(http.ResponseWriter){rateLimited("")}, true, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, hits := sequenceServer(t, tt.responses...)
+			ext := &testConfig().External
+			ext.MaxRetryAfter = tt.maxRetryAfter
+
+			body, err := openFeed(context.Background(), srv.Client(), ext, srv.URL, "", "exchangerates")
+			if got := atomic.LoadInt32(hits); got != tt.wantHits {
+				t.Errorf("upstream hit %d times, want %d", got, tt.wantHits)
+			}
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("openFeed: %v", err)
+				}
+				body.Close()
+				return
+			}
+			extErr, isExt := err.(ExternalError)
+			if !isExt || !extErr.RateLimited() {
+				t.Fatalf("err = %v, want a rate-limited ExternalError", err)
+			}
+			if extErr.RetryAfter != tt.wantRetry {
+				t.Errorf("RetryAfter = %v, want %v", extErr.RetryAfter, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		v    string
+		want time.Duration
+	}{
+		{"30", 30 * time.Second},
+		{" 0 ", 0},
+		{"-5", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.v, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestWriteExternalErrorRetryAfter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeExternalError(rec, ExternalError{API: "exchangerates", Status: http.StatusTooManyRequests, RetryAfter: 1500 * time.Millisecond})
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	// rounded up so the client never retries too early
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+}
+
+func TestNormalizeRates(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    map[string]float64
+		strict bool
+		want   map[string]float64
+	}{
+		{"mixed case", map[string]float64{"usd": 1, "Ghs": 15, "EUR": 0.9}, false,
+			map[string]float64{"USD": 1, "GHS": 15, "EUR": 0.9}},
+		{"padded", map[string]float64{" xof ": 600}, false, map[string]float64{"XOF": 600}},
+		{"odd keys kept", map[string]float64{"gbp": 0.8, "BTC2": 0.01}, false,
+			map[string]float64{"GBP": 0.8, "BTC2": 0.01}},
+		{"odd keys dropped when strict", map[string]float64{"gbp": 0.8, "BTC2": 0.01, "x": 1}, true,
+			map[string]float64{"GBP": 0.8}},
+		{"empty", map[string]float64{}, false, map[string]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeRates(tt.raw, tt.strict); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeRates(%v, %v) = %v, want %v", tt.raw, tt.strict, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeRatesDuplicateKeys(t *testing.T) {
+	got := normalizeRates(map[string]float64{"usd": 1, "USD": 2, "ghs": 15}, false)
+	if len(got) != 2 || got["GHS"] != 15 {
+		t.Fatalf("normalizeRates = %v, want USD and GHS", got)
+	}
+	// either spelling may win, but only one is kept
+	if got["USD"] != 1 && got["USD"] != 2 {
+		t.Errorf("USD = %v, want one of the provider's values", got["USD"])
+	}
+}
+
+func TestRefreshSkipsBelowMinPopulation(t *testing.T) {
+	svc := newTestService(t)
+	svc.Config.Refresh.MinPopulation = 10
+	svc.CountriesURL = delayedServer(t, 0, http.StatusOK, `[
+		{"name":"Ghana","population":30,"currencies":[{"code":"GHS"}]},
+		{"name":"Tuvalu","population":9,"currencies":[{"code":"AUD"}]},
+		{"name":"Nauru","population":10,"currencies":[{"code":"AUD"}]}
+	]`).URL
+	svc.RatesURL = delayedServer(t, 0, http.StatusOK, `{"result":"success","base_code":"USD","rates":{"USD":1,"GHS":15,"AUD":1.5}}`).URL + "/"
+
+	res, err := svc.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if res.Total != 2 || res.Skipped != 1 {
+		t.Errorf("Total, Skipped = %d, %d; want 2, 1", res.Total, res.Skipped)
+	}
+	list, err := svc.GetAll(context.Background(), ListFilter{Sort: "name_asc"})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	// the minimum itself is kept
+	if got := names(list); !reflect.DeepEqual(got, []string{"Ghana", "Nauru"}) {
+		t.Errorf("stored %v, want [Ghana Nauru]", got)
+	}
+}
+
+func TestRefreshFromFixtures(t *testing.T) {
+	svc := newTestService(t)
+	svc.Config.External.Mode = "fixtures"
+	svc.Config.External.CountriesFixture = "../../fixtures/countries.json"
+	svc.Config.External.RatesFixture = "../../fixtures/rates.json"
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("fixtures mode called a live feed: %s", r.URL)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(live.Close)
+	svc.CountriesURL, svc.RatesURL = live.URL, live.URL+"/"
+
+	res, err := svc.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if res.StaleRates {
+		t.Error("StaleRates set on a fixtures refresh")
+	}
+	list, err := svc.GetAll(context.Background(), ListFilter{Sort: "name_asc"})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	// Antarctica has no currency and fails validation
+	if got := names(list); !reflect.DeepEqual(got, []string{"Germany", "Ghana", "Japan", "Nigeria"}) {
+		t.Fatalf("stored %v, want the four fixture countries with a currency", got)
+	}
+	if res.Total != len(list) {
+		t.Errorf("Total = %d, want %d", res.Total, len(list))
+	}
+	ghana := list[1]
+	if ghana.Population != 31072945 || ghana.ExchangeRate == nil || *ghana.ExchangeRate != 15.2 || ghana.EstimatedGDP == nil {
+		t.Errorf("Ghana = population %d, rate %v, GDP %v; want the fixture values", ghana.Population, fmtPtr(ghana.ExchangeRate), fmtPtr(ghana.EstimatedGDP))
+	}
+}
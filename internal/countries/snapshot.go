@@ -0,0 +1,72 @@
+package countries
+
+import (
+	"strings"
+	"sync"
+)
+
+// maxSnapshotLists bounds how many distinct filtered lists are remembered
+const maxSnapshotLists = 256
+
+// snapshotStore keeps the last successfully loaded lists in memory so reads
+// can still be served (marked stale) while the database is unavailable.
+// Lists are keyed by their exact filter; the unfiltered list doubles as the
+// source for single-country lookups.
+type snapshotStore struct {
+	mu    sync.RWMutex
+	lists map[ListFilter][]Country
+}
+
+func newSnapshotStore() *snapshotStore {
+	return &snapshotStore{lists: make(map[ListFilter][]Country)}
+}
+
+// storeList remembers a copy of the result of a successful GetAll, so the
+// caller can go on annotating its rows without touching the snapshot
+func (s *snapshotStore) storeList(f ListFilter, list []Country) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lists[f]; !ok && len(s.lists) >= maxSnapshotLists {
+		// evict an arbitrary entry, but keep the unfiltered list
+		for k := range s.lists {
+			if k != (ListFilter{}) {
+				delete(s.lists, k)
+				break
+			}
+		}
+	}
+	s.lists[f] = append([]Country(nil), list...)
+}
+
+// list returns a copy of the remembered list for f
+func (s *snapshotStore) list(f ListFilter) ([]Country, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, ok := s.lists[f]
+	if !ok {
+		return nil, false
+	}
+	return append([]Country{}, list...), true
+}
+
+// find returns the first country in the unfiltered snapshot matching fn
+func (s *snapshotStore) find(fn func(c *Country) bool) (*Country, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.lists[ListFilter{}] {
+		if fn(&c) {
+			return &c, true
+		}
+	}
+	return nil, false
+}
+
+// byName finds a country in the snapshot by case-insensitive name
+func (s *snapshotStore) byName(name string) (*Country, bool) {
+	return s.find(func(c *Country) bool { return strings.EqualFold(c.Name, name) })
+}
+
+// byNumericCode finds a country in the snapshot by numeric code
+func (s *snapshotStore) byNumericCode(code string) (*Country, bool) {
+	return s.find(func(c *Country) bool { return c.NumericCode != nil && *c.NumericCode == code })
+}
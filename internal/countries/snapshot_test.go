@@ -0,0 +1,120 @@
+package countries
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotServedWhenDBFails(t *testing.T) {
+	svc := newTestService(t)
+	gh := testCountry("Ghana", "Africa", "GHS", 30, 15)
+	code := "288"
+	gh.NumericCode = &code
+	seed(t, svc, gh, testCountry("France", "Europe", "EUR", 60, 0.9))
+	r := newTestRouter(svc)
+
+	// successful reads fill the snapshot
+	for _, path := range []string{"/countries", "/countries?region=Africa"} {
+		if rec := serve(r, httptest.NewRequest(http.MethodGet, path, nil)); rec.Code != http.StatusOK || rec.Header().Get(staleHeader) != "" {
+			t.Fatalf("GET %s before the outage = %d, stale %q", path, rec.Code, rec.Header().Get(staleHeader))
+		}
+	}
+
+	svc.DB.Close()
+
+	tests := []struct {
+		path      string
+		wantNames []string
+	}{
+		{"/countries", []string{"Ghana", "France"}},
+		{"/countries?region=Africa", []string{"Ghana"}},
+		{"/countries/ghana", []string{"Ghana"}},
+		{"/countries/numeric/288", []string{"Ghana"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := serve(r, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want the snapshot with 200", rec.Code)
+			}
+			if rec.Header().Get(staleHeader) != "true" {
+				t.Errorf("%s not set on a snapshot response", staleHeader)
+			}
+			if etag := rec.Header().Get("ETag"); etag != "" {
+				t.Errorf("ETag %q on a snapshot response", etag)
+			}
+			if got := responseNames(t, rec.Body.Bytes()); !reflect.DeepEqual(got, tt.wantNames) {
+				t.Errorf("served %v, want %v", got, tt.wantNames)
+			}
+		})
+	}
+
+	// a list that was never loaded can't be served from memory
+	for _, path := range []string{"/countries?region=Europe", "/countries/Togo"} {
+		if rec := serve(r, httptest.NewRequest(http.MethodGet, path, nil)); rec.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s = %d, want 500", path, rec.Code)
+		}
+	}
+}
+
+func TestSnapshotStoreCopies(t *testing.T) {
+	s := newSnapshotStore()
+	stored := []Country{*testCountry("Ghana", "Africa", "GHS", 30, 15)}
+	s.storeList(ListFilter{}, stored)
+	stored[0].Name = "Stored"
+
+	list, _ := s.list(ListFilter{})
+	list[0].Name = "Changed"
+	if again, _ := s.list(ListFilter{}); again[0].Name != "Ghana" {
+		t.Errorf("snapshot changed through a stored or returned list: %q", again[0].Name)
+	}
+}
+
+func TestSnapshotNotAnnotatedByHandler(t *testing.T) {
+	svc := newTestService(t)
+	seed(t, svc, testCountry("Ghana", "Africa", "GHS", 30, 15))
+	r := newTestRouter(svc)
+
+	if rec := serve(r, httptest.NewRequest(http.MethodGet, "/countries", nil)); rec.Code != http.StatusOK {
+		t.Fatalf("GET /countries = %d", rec.Code)
+	}
+	list, ok := svc.snapshots.list(ListFilter{})
+	if !ok || len(list) != 1 {
+		t.Fatalf("snapshot = %v, %v; want one row", list, ok)
+	}
+	if list[0].GDPUnit != nil || list[0].RateAgeSeconds != nil {
+		t.Errorf("snapshot row annotated by the response: unit %v, rate age %v", list[0].GDPUnit, list[0].RateAgeSeconds)
+	}
+}
+
+func TestSnapshotStoreBounded(t *testing.T) {
+	s := newSnapshotStore()
+	s.storeList(ListFilter{}, nil)
+	for i := 0; i < maxSnapshotLists+10; i++ {
+		s.storeList(ListFilter{Region: fmt.Sprint(i)}, nil)
+	}
+	if n := len(s.lists); n != maxSnapshotLists {
+		t.Errorf("holding %d lists, want at most %d", n, maxSnapshotLists)
+	}
+	if _, ok := s.list(ListFilter{}); !ok {
+		t.Error("the unfiltered list was evicted")
+	}
+}
+
+// responseNames returns the names of a JSON country list or single country
+func responseNames(t *testing.T, body []byte) []string {
+	t.Helper()
+	var list []Country
+	if err := json.Unmarshal(body, &list); err == nil {
+		return names(list)
+	}
+	var c Country
+	if err := json.Unmarshal(body, &c); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return []string{c.Name}
+}
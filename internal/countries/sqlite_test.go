@@ -0,0 +1,113 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/zjoart/countryxchange/internal/config"
+	"github.com/zjoart/countryxchange/internal/database"
+	"github.com/zjoart/countryxchange/pkg/api"
+
+	// the repo tests run against SQLite; the service itself links no driver
+	_ "modernc.org/sqlite"
+)
+
+// testAPIKey is the admin API key of testConfig
+const testAPIKey = "test-key"
+
+// testConfig returns the settings the package tests run with
+func testConfig() *config.Config {
+	return &config.Config{
+		AdminAPIKey:     testAPIKey,
+		RateStaleAfter:  24 * time.Hour,
+		ListEmptyStatus: 200,
+		QueryLogSample:  1,
+		DB:              config.DBConfig{Driver: "sqlite", PingTimeout: time.Second},
+		Refresh:         config.RefreshConfig{Timeout: 10 * time.Second, UpsertWorkers: 1, PartialStatus: 200},
+		External:        config.ExternalConfig{Mode: "live", Timeout: 5 * time.Second, RatesBase: "USD"},
+		GDP:             config.GDPConfig{Unit: "USD", Multiplier: 1500},
+	}
+}
+
+// newTestService returns a Service over a fresh in-memory SQLite database
+// with the schema created
+func newTestService(t testing.TB) *Service {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	// every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	svc := NewService(db, testConfig(), database.SQLite{})
+	if err := svc.EnsureTables(); err != nil {
+		t.Fatalf("EnsureTables: %v", err)
+	}
+	return svc
+}
+
+// testCountry returns a valid country; rate 0 leaves it without a rate or GDP
+func testCountry(name, region, currency string, population int64, rate float64) *Country {
+	c := &Country{
+		Name:            name,
+		Region:          &region,
+		Population:      population,
+		CurrencyCode:    &currency,
+		CurrencyCodes:   []string{currency},
+		Source:          SourceRefresh,
+		LastRefreshedAt: api.NewTime(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)),
+	}
+	if rate > 0 {
+		gdp := float64(population) * 1500 / rate
+		c.ExchangeRate, c.EstimatedGDP = &rate, &gdp
+		c.CurrencyRates = map[string]float64{currency: rate}
+	}
+	return c
+}
+
+// seed upserts list in one transaction
+func seed(t testing.TB, svc *Service, list ...*Country) {
+	t.Helper()
+	err := svc.withTx(context.Background(), func(tx *sql.Tx) error {
+		for _, c := range list {
+			if err := svc.UpsertCountry(tx, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+}
+
+// names returns the names of list in order
+func names(list []Country) []string {
+	out := make([]string, len(list))
+	for i, c := range list {
+		out[i] = c.Name
+	}
+	return out
+}
+
+// newTestRouter returns a router with the country routes of svc, public and
+// admin mounted together
+func newTestRouter(svc *Service) *mux.Router {
+	r := mux.NewRouter()
+	RegisterRoutes(r, r, svc)
+	return r
+}
+
+// serve sends req to h and returns the recorded response
+func serve(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,36 @@
+package countries
+
+import "math"
+
+// meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var sq float64
+	for _, v := range values {
+		d := v - mean
+		sq += d * d
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
+
+// withinStdDevs returns the indexes of values lying no more than n standard
+// deviations from the mean. A non-positive n keeps every value.
+func withinStdDevs(values []float64, n float64) []int {
+	keep := make([]int, 0, len(values))
+	mean, sd := meanStdDev(values)
+	for i, v := range values {
+		if n <= 0 || sd == 0 || math.Abs(v-mean) <= n*sd {
+			keep = append(keep, i)
+		}
+	}
+	return keep
+}
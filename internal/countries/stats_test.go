@@ -0,0 +1,56 @@
+package countries
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMeanStdDev(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []float64
+		mean, sd float64
+	}{
+		{"empty", nil, 0, 0},
+		{"single", []float64{42}, 42, 0},
+		{"constant", []float64{3, 3, 3}, 3, 0},
+		{"textbook", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+		{"negative", []float64{-1, 1}, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, sd := meanStdDev(tt.values)
+			if math.Abs(mean-tt.mean) > 1e-9 || math.Abs(sd-tt.sd) > 1e-9 {
+				t.Errorf("meanStdDev = %g, %g; want %g, %g", mean, sd, tt.mean, tt.sd)
+			}
+		})
+	}
+}
+
+func TestWithinStdDevs(t *testing.T) {
+	// mean 5, standard deviation 2
+	textbook := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	tests := []struct {
+		name   string
+		values []float64
+		n      float64
+		want   []int
+	}{
+		{"off keeps everything", textbook, 0, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{"negative n keeps everything", textbook, -1, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{"one deviation", textbook, 1, []int{1, 2, 3, 4, 5, 6}},
+		// 2 and 9 lie 1.5 and 2 deviations out; the bound is inclusive
+		{"two deviations", textbook, 2, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{"no spread", []float64{7, 7, 7}, 0.5, []int{0, 1, 2}},
+		{"empty", nil, 2, []int{}},
+		{"one huge outlier", []float64{1e15, 10, 11, 12, 9, 10, 11, 12, 9, 10}, 2, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withinStdDevs(tt.values, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withinStdDevs(%v, %g) = %v, want %v", tt.values, tt.n, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// MySQL error number for "Deadlock found when trying to get lock"
+const mysqlErrDeadlock = 1213
+
+// isDeadlock reports whether err is a MySQL deadlock
+func isDeadlock(err error) bool {
+	var myErr *mysql.MySQLError
+	return errors.As(err, &myErr) && myErr.Number == mysqlErrDeadlock
+}
+
+// withTx runs fn inside a transaction, committing on success and rolling
+// back on error. When MySQL picks the transaction as a deadlock victim the
+// whole transaction is retried up to DB.DeadlockRetries more times, so fn
+// must be safe to run again from scratch.
+func (s *Service) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	retries := s.Config.DB.DeadlockRetries
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, s.DB, fn)
+		if err == nil || !isDeadlock(err) || attempt >= retries {
+			return err
+		}
+
+		logger.Warn("repo: deadlock detected, retrying transaction", logFields(ctx, logger.Fields{"attempt": attempt + 1, "max_retries": retries}))
+		// brief linear backoff so the competing transaction can finish
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * 50 * time.Millisecond):
+		}
+	}
+}
+
+func runTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("repo: begin tx failed", logFields(ctx, logger.WithError(err)))
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("repo: tx commit failed", logFields(ctx, logger.WithError(err)))
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
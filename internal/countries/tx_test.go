@@ -0,0 +1,126 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// deadlockFirst fails the first n statements with a MySQL deadlock
+func deadlockFirst(n int) func(string, []driver.Value) error {
+	return func(string, []driver.Value) error {
+		if n > 0 {
+			n--
+			return &mysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found when trying to get lock"}
+		}
+		return nil
+	}
+}
+
+func TestWithTxDeadlockRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		deadlocks  int
+		retries    int
+		wantErr    bool
+		wantBegins int
+	}{
+		{"no deadlock", 0, 3, false, 1},
+		{"retried until it succeeds", 2, 3, false, 3},
+		{"gives up after the retries", 5, 2, true, 3},
+		{"retries disabled", 1, 0, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeDB{execErr: deadlockFirst(tt.deadlocks)}
+			svc := newFakeService(t, f)
+			svc.Config.DB.DeadlockRetries = tt.retries
+
+			runs := 0
+			err := svc.withTx(context.Background(), func(tx *sql.Tx) error {
+				runs++
+				_, err := tx.Exec(`UPDATE countries SET population = ? WHERE id = ?`, 1, 1)
+				return err
+			})
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("withTx error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !isDeadlock(err) {
+				t.Errorf("error = %v, want the deadlock", err)
+			}
+			begins, commits, rollbacks := f.txCounts()
+			if begins != tt.wantBegins || runs != tt.wantBegins {
+				t.Errorf("began %d transactions and ran fn %d times, want %d", begins, runs, tt.wantBegins)
+			}
+			wantCommits := 1
+			if tt.wantErr {
+				wantCommits = 0
+			}
+			if commits != wantCommits || rollbacks != begins-commits {
+				t.Errorf("committed %d and rolled back %d of %d", commits, rollbacks, begins)
+			}
+		})
+	}
+}
+
+func TestWithTxOtherErrorNotRetried(t *testing.T) {
+	errOther := errors.New("duplicate entry")
+	f := &fakeDB{execErr: func(string, []driver.Value) error { return errOther }}
+	svc := newFakeService(t, f)
+	svc.Config.DB.DeadlockRetries = 3
+
+	err := svc.withTx(context.Background(), func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM countries`)
+		return err
+	})
+	if !errors.Is(err, errOther) {
+		t.Fatalf("withTx error = %v, want %v", err, errOther)
+	}
+	if begins, _, _ := f.txCounts(); begins != 1 {
+		t.Errorf("began %d transactions, want 1", begins)
+	}
+}
+
+func TestWithTxRetryStopsOnCancel(t *testing.T) {
+	f := &fakeDB{execErr: deadlockFirst(100)}
+	svc := newFakeService(t, f)
+	svc.Config.DB.DeadlockRetries = 100
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	err := svc.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM countries`)
+		return err
+	})
+	if err == nil {
+		t.Fatal("withTx succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("withTx kept retrying for %v after the cancel", elapsed)
+	}
+}
+
+func TestIsDeadlock(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: mysqlErrDeadlock}, true},
+		{fmt.Errorf("upsert: %w", &mysql.MySQLError{Number: mysqlErrDeadlock}), true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{errors.New("deadlock"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isDeadlock(tt.err); got != tt.want {
+			t.Errorf("isDeadlock(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
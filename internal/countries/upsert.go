@@ -0,0 +1,131 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// upsertParallel writes list across up to Refresh.UpsertWorkers
+// transactions, one per partition, and only commits once every partition has written its rows.
+// If any partition fails before that barrier, all of them roll back, so the
+// common failure modes leave the table untouched as with a single
+// transaction. The guarantee is weaker at commit time: the commits run one
+// after another, and if one fails the partitions committed before it stay
+// committed (the rest roll back and the error says how far it got). Rows are
+// upserts, so rerunning the refresh repairs such a split. The last refresh
+// timestamp, rates base and history snapshot are written by the last
+// partition, which commits last, so they are only saved when every commit
+// succeeded.
+func (s *Service) upsertParallel(ctx context.Context, list []*Country, now time.Time, base string) error {
+	retries := s.Config.DB.DeadlockRetries
+	for attempt := 0; ; attempt++ {
+		err := s.upsertPartitions(ctx, s.Config.Refresh.UpsertWorkers, list, now, base)
+		if err == nil || !isDeadlock(err) || attempt >= retries {
+			return err
+		}
+
+		logger.Warn("repo: deadlock in parallel upsert, retrying", logFields(ctx, logger.Fields{"attempt": attempt + 1, "max_retries": retries}))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * 50 * time.Millisecond):
+		}
+	}
+}
+
+func (s *Service) upsertPartitions(ctx context.Context, workers int, list []*Country, now time.Time, base string) error {
+	if workers > len(list) {
+		workers = len(list)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	// cancelled as soon as one partition fails so the others stop early;
+	// database/sql rolls back their transactions when it fires
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	size := (len(list) + workers - 1) / workers
+	if size > 0 {
+		// e.g. 5 rows over 4 workers is 3 partitions of 2, 2 and 1; never
+		// start a partition past the end, and keep the last one (which
+		// writes the metadata) non-empty
+		workers = (len(list) + size - 1) / size
+	}
+	txs := make([]*sql.Tx, workers)
+	// only the first failure is kept; the cancellation errors it causes in
+	// the other partitions would hide the cause
+	var (
+		once     sync.Once
+		firstErr error
+		failedAt int
+	)
+	fail := func(i int, err error) {
+		once.Do(func() { firstErr, failedAt = err, i })
+		cancel()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		start, end := i*size, (i+1)*size
+		if end > len(list) {
+			end = len(list)
+		}
+		wg.Add(1)
+		go func(i int, part []*Country) {
+			defer wg.Done()
+			tx, err := s.DB.BeginTx(writeCtx, nil)
+			if err != nil {
+				fail(i, err)
+				return
+			}
+			txs[i] = tx
+			for _, c := range part {
+				if err := s.UpsertCountry(tx, c); err != nil {
+					fail(i, err)
+					return
+				}
+			}
+			if i == workers-1 {
+				if err := s.SaveLastRefreshed(tx, now); err != nil {
+					fail(i, err)
+					return
+				}
+				if err := s.SaveRatesBase(tx, base); err != nil {
+					fail(i, err)
+					return
+				}
+				if err := recordHistory(tx, now, list, s.Config.Refresh.HistoryKeep); err != nil {
+					fail(i, err)
+				}
+			}
+		}(i, list[start:end])
+	}
+	wg.Wait()
+
+	rollbackFrom := func(from int) {
+		for _, tx := range txs[from:] {
+			if tx != nil {
+				tx.Rollback()
+			}
+		}
+	}
+	if firstErr != nil {
+		rollbackFrom(0)
+		logger.Error("repo: parallel upsert partition failed", logFields(ctx, logger.Fields{"partition": failedAt, "partitions": workers}, logger.WithError(firstErr)))
+		return firstErr
+	}
+	for i, tx := range txs {
+		if err := tx.Commit(); err != nil {
+			rollbackFrom(i + 1)
+			logger.Error("repo: parallel upsert commit failed", logFields(ctx, logger.Fields{"partition": i, "committed": i, "partitions": workers}, logger.WithError(err)))
+			return fmt.Errorf("commit of partition %d failed after %d of %d partitions committed: %w", i, i, workers, err)
+		}
+	}
+	return nil
+}
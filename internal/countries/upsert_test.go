@@ -0,0 +1,128 @@
+package countries
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// makeCountries returns n valid countries named "Country 0".."Country n-1"
+func makeCountries(n int) []*Country {
+	list := make([]*Country, n)
+	for i := range list {
+		list[i] = testCountry(fmt.Sprintf("Country %d", i), "Africa", "NGN", int64(1000+i), 1600)
+	}
+	return list
+}
+
+func TestUpsertPartitionsSplit(t *testing.T) {
+	tests := []struct {
+		rows, workers, partitions int
+	}{
+		{rows: 5, workers: 4, partitions: 3},
+		{rows: 8, workers: 4, partitions: 4},
+		{rows: 10, workers: 3, partitions: 3},
+		{rows: 2, workers: 4, partitions: 2},
+		{rows: 0, workers: 4, partitions: 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d rows over %d workers", tt.rows, tt.workers), func(t *testing.T) {
+			f := &fakeDB{}
+			svc := newFakeService(t, f)
+			if err := svc.upsertPartitions(context.Background(), tt.workers, makeCountries(tt.rows), time.Now(), "USD"); err != nil {
+				t.Fatalf("upsertPartitions: %v", err)
+			}
+			if got := f.count("INSERT INTO countries"); got != tt.rows {
+				t.Errorf("upserted %d rows, want %d", got, tt.rows)
+			}
+			// the metadata and history are written once, by the last partition
+			if got := f.count("'last_refreshed_at'"); got != 1 {
+				t.Errorf("last_refreshed_at written %d times, want 1", got)
+			}
+			if got := f.count("INSERT INTO refreshes"); got != 1 {
+				t.Errorf("history recorded %d times, want 1", got)
+			}
+			if begins, commits, _ := f.txCounts(); begins != tt.partitions || commits != tt.partitions {
+				t.Errorf("began %d and committed %d transactions, want %d", begins, commits, tt.partitions)
+			}
+		})
+	}
+}
+
+func TestUpsertPartitionsRollback(t *testing.T) {
+	errInsert := errors.New("insert failed")
+	f := &fakeDB{execErr: func(query string, args []driver.Value) error {
+		if strings.Contains(query, "INSERT INTO countries") && args[0] == "Country 5" {
+			return errInsert
+		}
+		return nil
+	}}
+	svc := newFakeService(t, f)
+
+	err := svc.upsertPartitions(context.Background(), 4, makeCountries(8), time.Now(), "USD")
+	if !errors.Is(err, errInsert) {
+		t.Fatalf("upsertPartitions error = %v, want the failed insert", err)
+	}
+	begins, commits, rollbacks := f.txCounts()
+	if commits != 0 {
+		t.Errorf("committed %d partitions after a failure, want 0", commits)
+	}
+	if rollbacks != begins {
+		t.Errorf("rolled back %d of %d partitions", rollbacks, begins)
+	}
+}
+
+// benchRows is about the size of a full restcountries feed
+const benchRows = 250
+
+// benchLatency stands in for the round trip of each statement to MySQL;
+// shorter sleeps are rounded up to about this anyway
+const benchLatency = time.Millisecond
+
+// BenchmarkUpsert compares the single-transaction write of Refresh with the
+// partitioned one of UPSERT_WORKERS
+func BenchmarkUpsert(b *testing.B) {
+	list := makeCountries(benchRows)
+	now := time.Now()
+
+	b.Run("single", func(b *testing.B) {
+		svc := newFakeService(b, &fakeDB{latency: benchLatency})
+		ctx := context.Background()
+		for i := 0; i < b.N; i++ {
+			err := svc.withTx(ctx, func(tx *sql.Tx) error {
+				for _, c := range list {
+					if err := svc.UpsertCountry(tx, c); err != nil {
+						return err
+					}
+				}
+				if err := svc.SaveLastRefreshed(tx, now); err != nil {
+					return err
+				}
+				if err := svc.SaveRatesBase(tx, "USD"); err != nil {
+					return err
+				}
+				return recordHistory(tx, now, list, 0)
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, workers := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("parallel-%d", workers), func(b *testing.B) {
+			svc := newFakeService(b, &fakeDB{latency: benchLatency})
+			ctx := context.Background()
+			for i := 0; i < b.N; i++ {
+				if err := svc.upsertPartitions(ctx, workers, list, now, "USD"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -13,6 +13,11 @@ import (
 func InitDB(config *config.DBConfig) (*sql.DB, error) {
 	logger.Info("initializing database connection")
 
+	driverName := config.Driver
+	if driverName == "" {
+		driverName = "mysql"
+	}
+
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
 		config.User,
 		config.Password,
@@ -20,8 +25,9 @@ func InitDB(config *config.DBConfig) (*sql.DB, error) {
 		config.Port,
 		config.Name,
 	)
-
-	driverName := "mysql"
+	if driverName == "sqlite" {
+		dsn = config.Name
+	}
 
 	logger.Info("opening database connection",
 		logger.Fields{
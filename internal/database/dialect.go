@@ -0,0 +1,107 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Dialect covers the statements whose syntax differs between MySQL and
+// SQLite. Everything else the repo runs is written in the subset both
+// understand.
+type Dialect interface {
+	// AutoIncrementPK is the column definition of an auto-increment id
+	AutoIncrementPK() string
+	// Upsert is the clause appended to an INSERT so a conflict on
+	// conflictCols overwrites updateCols with the inserted values
+	Upsert(conflictCols []string, updateCols ...string) string
+	// InsertIgnore is the INSERT verb that silently skips conflicting rows
+	InsertIgnore() string
+	// ColumnExistsQuery counts the columns named by its (table, column) args
+	ColumnExistsQuery() string
+	// IsDuplicateKey reports whether err is a unique key violation
+	IsDuplicateKey(err error) bool
+	// InList is a condition true when the comma-separated list in column
+	// contains the value bound to its single placeholder
+	InList(column string) string
+	// ForUpdate is the suffix that row-locks the rows a SELECT reads
+	ForUpdate() string
+}
+
+// DialectFor returns the Dialect of a DB_DRIVER value
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case "mysql":
+		return MySQL{}, nil
+	case "sqlite":
+		return SQLite{}, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q", driver)
+}
+
+// MySQL is the production dialect
+type MySQL struct{}
+
+func (MySQL) AutoIncrementPK() string { return "BIGINT AUTO_INCREMENT PRIMARY KEY" }
+
+func (MySQL) Upsert(_ []string, updateCols ...string) string {
+	sets := make([]string, len(updateCols))
+	for i, c := range updateCols {
+		sets[i] = fmt.Sprintf("%s = VALUES(%s)", c, c)
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+func (MySQL) InsertIgnore() string { return "INSERT IGNORE" }
+
+func (MySQL) ColumnExistsQuery() string {
+	return `SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+}
+
+// MySQL error number for "Duplicate entry for key"
+const mysqlErrDuplicate = 1062
+
+func (MySQL) IsDuplicateKey(err error) bool {
+	var myErr *mysql.MySQLError
+	return errors.As(err, &myErr) && myErr.Number == mysqlErrDuplicate
+}
+
+func (MySQL) InList(column string) string { return "FIND_IN_SET(?, " + column + ") > 0" }
+
+func (MySQL) ForUpdate() string { return " FOR UPDATE" }
+
+// SQLite is meant for fast in-memory repo tests. No SQLite driver is linked
+// into the service; whoever selects it must register one under "sqlite".
+// The repo tests link modernc.org/sqlite.
+type SQLite struct{}
+
+func (SQLite) AutoIncrementPK() string { return "INTEGER PRIMARY KEY AUTOINCREMENT" }
+
+func (SQLite) Upsert(conflictCols []string, updateCols ...string) string {
+	sets := make([]string, len(updateCols))
+	for i, c := range updateCols {
+		sets[i] = fmt.Sprintf("%s = excluded.%s", c, c)
+	}
+	return fmt.Sprintf("ON CONFLICT(%s) DO UPDATE SET %s", strings.Join(conflictCols, ", "), strings.Join(sets, ", "))
+}
+
+func (SQLite) InsertIgnore() string { return "INSERT OR IGNORE" }
+
+func (SQLite) ColumnExistsQuery() string {
+	return `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+}
+
+// both common SQLite drivers report constraint failures with this text
+func (SQLite) IsDuplicateKey(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func (SQLite) InList(column string) string {
+	return "instr(',' || " + column + " || ',', ',' || ? || ',') > 0"
+}
+
+// SQLite locks the whole database for a write transaction, so there are no
+// row locks to take
+func (SQLite) ForUpdate() string { return "" }
@@ -22,6 +22,20 @@ const docTemplate = `{
                 "produces": ["application/json"],
                 "tags": ["countries"],
                 "summary": "Refresh country data",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Fetch fresh exchange rates even if cached ones are younger than EXTERNAL_RATES_CACHE_TTL",
+                        "name": "force",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Base currency for the exchange rates (default EXTERNAL_RATES_BASE); 400 if the rates API doesn't know it",
+                        "name": "base",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -36,6 +50,24 @@ const docTemplate = `{
                                     "type": "integer",
                                     "example": 250
                                 },
+                                "skipped": {
+                                    "type": "integer",
+                                    "example": 0
+                                },
+                                "by_region": {
+                                    "type": "object",
+                                    "additionalProperties": {"type": "integer"},
+                                    "example": {"Africa": 59, "Europe": 53}
+                                },
+                                "timings": {
+                                    "type": "object",
+                                    "properties": {
+                                        "fetch_countries_ms": {"type": "integer", "example": 850},
+                                        "fetch_rates_ms": {"type": "integer", "example": 320},
+                                        "db_write_ms": {"type": "integer", "example": 410},
+                                        "image_ms": {"type": "integer", "example": 95}
+                                    }
+                                },
                                 "last_refreshed_at": {
                                     "type": "string",
                                     "example": "2025-10-26T14:30:00Z"
@@ -79,9 +111,82 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Sort by GDP (gdp_asc or gdp_desc)",
+                        "description": "Filter by data source (refresh, manual, import)",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only countries with (true) or without (false) a flag URL",
+                        "name": "has_flag",
+                        "in": "query"
+                    },
+                    {
+                        "enum": ["missing", "broken"],
+                        "type": "string",
+                        "description": "Flag maintenance: no flag URL (missing) or last prefetch of the flag failed (broken)",
+                        "name": "flag_status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only countries refreshed after this RFC3339 timestamp (delta sync)",
+                        "name": "modified_since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Minimum estimated GDP (countries without GDP are excluded)",
+                        "name": "min_gdp",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Maximum estimated GDP (countries without GDP are excluded)",
+                        "name": "max_gdp",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum population (inclusive)",
+                        "name": "min_population",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum population (inclusive)",
+                        "name": "max_population",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated columns to return (e.g. name,population)",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size; enables X-Total-Count and Link headers",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of rows to skip when paging",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort by GDP (gdp_asc, gdp_desc), population (population_asc, population_desc), name (name_asc, name_desc) or population density (density_asc, density_desc; countries without an area sort as null). Unknown values are rejected with 400; without sort rows come in id order",
                         "name": "sort",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Encode exchange_rate/estimated_gdp as plain decimal strings (string) or JSON numbers (number)",
+                        "name": "numbers",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -94,6 +199,12 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "204": {
+                        "description": "No countries matched (only with LIST_EMPTY_STATUS=204)"
+                    },
+                    "304": {
+                        "description": "Not Modified: If-None-Match or If-Modified-Since matches the current ETag/Last-Modified"
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {"$ref": "#/definitions/ErrorResponse"}
@@ -120,6 +231,249 @@ const docTemplate = `{
                 }
             }
         },
+        "/countries/numeric/{code}": {
+            "get": {
+                "description": "Get a country by its ISO 3166-1 numeric code (e.g. 840)",
+                "produces": ["application/json"],
+                "tags": ["countries"],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ISO 3166-1 numeric code",
+                        "name": "code",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {"$ref": "#/definitions/Country"}
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    }
+                }
+            }
+        },
+        "/countries/export": {
+            "get": {
+                "description": "Download countries as a CSV attachment with a header row of stored columns; nulls are empty cells and timestamps RFC3339",
+                "produces": ["text/csv"],
+                "tags": ["countries"],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Export format (only csv)",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by region",
+                        "name": "region",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by currency code",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Same sort values as GET /countries",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "CSV file",
+                        "schema": {"type": "file"}
+                    },
+                    "400": {
+                        "description": "Invalid format or sort",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    }
+                }
+            }
+        },
+        "/countries/search": {
+            "get": {
+                "description": "Find countries whose name (optionally also capital) contains q, case-insensitive, ordered by name. Returns [] when nothing matches",
+                "produces": ["application/json"],
+                "tags": ["countries"],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Part of a country name; % and _ match literally",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also match the capital",
+                        "name": "capital",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Max results (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {"$ref": "#/definitions/Country"}
+                        }
+                    },
+                    "400": {
+                        "description": "Missing q or invalid parameter",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    }
+                }
+            }
+        },
+        "/countries/{name}/refresh": {
+            "post": {
+                "description": "Re-fetch one country from restcountries plus current exchange rates (quoted against the stored base) and upsert only that row",
+                "produces": ["application/json"],
+                "tags": ["countries"],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Country name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Fetch fresh exchange rates even if cached ones are younger than EXTERNAL_RATES_CACHE_TTL",
+                        "name": "force",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {"$ref": "#/definitions/Country"}
+                    },
+                    "404": {
+                        "description": "Upstream doesn't know the country",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
+                    "422": {
+                        "description": "Upstream data failed validation",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    }
+                }
+            }
+        },
+        "/countries/{name}/rates/history": {
+            "get": {
+                "description": "Exchange rates of the country's currency captured by past refreshes, oldest first and paged",
+                "produces": ["application/json"],
+                "tags": ["countries"],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Country name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 start (default 30 days before to)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 end (default now); the range spans at most 366 days",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 250)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Points to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "name": {"type": "string", "example": "Nigeria"},
+                                "currency_code": {"type": "string", "example": "NGN"},
+                                "from": {"type": "string", "example": "2025-09-26T14:30:00Z"},
+                                "to": {"type": "string", "example": "2025-10-26T14:30:00Z"},
+                                "points": {
+                                    "type": "array",
+                                    "items": {
+                                        "type": "object",
+                                        "properties": {
+                                            "captured_at": {"type": "string", "example": "2025-10-26T14:30:00Z"},
+                                            "rate": {"type": "number", "example": 1600.5},
+                                            "base": {"type": "string", "example": "USD"}
+                                        }
+                                    }
+                                }
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid from, to, range or paging",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
+                    "404": {
+                        "description": "Country not found",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    }
+                }
+            }
+        },
         "/countries/{name}": {
             "get": {
                 "description": "Get detailed information about a specific country",
@@ -132,6 +486,54 @@ const docTemplate = `{
                         "name": "name",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated computed fields to attach (currency_peers; gdp_rank is always included)",
+                        "name": "expand",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Embed the flag image as a base64 data URL in flag_data_uri",
+                        "name": "embed_flag",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {"$ref": "#/definitions/Country"}
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    }
+                }
+            },
+            "put": {
+                "description": "Correct the mutable fields of a stored country (capital, region, population, currency_code, exchange_rate, flag_url). Fields left out of the body are cleared; estimated_gdp is recomputed from the new rate and source becomes manual",
+                "consumes": ["application/json"],
+                "produces": ["application/json"],
+                "tags": ["countries"],
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Country name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New field values",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {"$ref": "#/definitions/CountryUpdate"}
                     }
                 ],
                 "responses": {
@@ -139,10 +541,18 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {"$ref": "#/definitions/Country"}
                     },
+                    "400": {
+                        "description": "Body is not valid JSON",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {"$ref": "#/definitions/ErrorResponse"}
                     },
+                    "422": {
+                        "description": "Validation failed; details holds the field errors",
+                        "schema": {"$ref": "#/definitions/ErrorResponse"}
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {"$ref": "#/definitions/ErrorResponse"}
@@ -196,6 +606,10 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {"$ref": "#/definitions/StatusResponse"}
                     },
+                    "503": {
+                        "description": "DB unreachable (db_ok false)",
+                        "schema": {"$ref": "#/definitions/StatusResponse"}
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {"$ref": "#/definitions/ErrorResponse"}
@@ -214,10 +628,32 @@ const docTemplate = `{
                 "region": {"type": "string", "example": "Americas"},
                 "population": {"type": "integer", "example": 331002651},
                 "currency_code": {"type": "string", "example": "USD"},
+                "currency_codes": {"type": "array", "items": {"type": "string"}, "example": ["USD"]},
+                "currency_rates": {"type": "object", "additionalProperties": {"type": "number"}, "example": {"USD": 1.0}},
                 "exchange_rate": {"type": "number", "example": 1.0},
-                "estimated_gdp": {"type": "number", "example": 21433225.0},
+                "estimated_gdp": {"type": "number", "description": "population * multiplier / exchange_rate in gdp_unit; multiplier is GDP_MULTIPLIER, or random in 1000-2000 when unset", "example": 21433225.0},
                 "flag_url": {"type": "string", "example": "https://example.com/us-flag.png"},
-                "last_refreshed_at": {"type": "string", "example": "2025-10-26T14:30:00Z"}
+                "numeric_code": {"type": "string", "example": "840"},
+                "area": {"type": "number", "example": 9372610.0},
+                "source": {"type": "string", "example": "refresh"},
+                "last_refreshed_at": {"type": "string", "example": "2025-10-26T14:30:00Z"},
+                "rate_age_seconds": {"type": "integer", "example": 3600},
+                "rate_stale": {"type": "boolean", "example": false},
+                "currency_symbol": {"type": "string", "example": "₦"},
+                "gdp_unit": {"type": "string", "example": "USD"},
+                "population_density": {"type": "number", "example": 35.32}
+            }
+        },
+        "CountryUpdate": {
+            "type": "object",
+            "required": ["population", "currency_code"],
+            "properties": {
+                "capital": {"type": "string", "example": "Washington, D.C."},
+                "region": {"type": "string", "example": "Americas"},
+                "population": {"type": "integer", "example": 331002651},
+                "currency_code": {"type": "string", "example": "USD"},
+                "exchange_rate": {"type": "number", "example": 1.0},
+                "flag_url": {"type": "string", "example": "https://example.com/us-flag.png"}
             }
         },
         "ErrorResponse": {
@@ -231,7 +667,10 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "total_countries": {"type": "integer", "example": 250},
-                "last_refreshed_at": {"type": "string", "example": "2025-10-26T14:30:00Z"}
+                "last_refreshed_at": {"type": "string", "example": "2025-10-26T14:30:00Z"},
+                "gdp_unit": {"type": "string", "example": "USD"},
+                "rates_base": {"type": "string", "example": "USD"},
+                "db_ok": {"type": "boolean", "example": true}
             }
         }
     }
@@ -0,0 +1,77 @@
+// Package metrics holds the Prometheus collectors served on /metrics. They
+// live in their own registry so only what is defined here is exposed.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry is what /metrics serves
+var Registry = prometheus.NewRegistry()
+
+var (
+	refreshes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "countryxchange_refreshes_total",
+		Help: "Refreshes attempted.",
+	})
+	refreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "countryxchange_refresh_failures_total",
+		Help: "Failed refreshes by the upstream API at fault (restcountries, exchangerates, or other for DB and local errors).",
+	}, []string{"api"})
+	refreshDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "countryxchange_refresh_duration_seconds",
+		Help:    "Duration of refreshes, failed ones included.",
+		Buckets: []float64{0.5, 1, 2.5, 5, 10, 20, 30, 45, 60},
+	})
+	refreshCountries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "countryxchange_refresh_countries_processed",
+		Help: "Countries written by the last successful refresh.",
+	})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "countryxchange_http_requests_total",
+		Help: "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "countryxchange_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+func init() {
+	Registry.MustRegister(
+		refreshes, refreshFailures, refreshDuration, refreshCountries,
+		httpRequests, httpDuration,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves Registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRefresh records one refresh. failedAPI is "" for a success, when
+// processed is the number of countries written.
+func ObserveRefresh(d time.Duration, processed int, failedAPI string) {
+	refreshes.Inc()
+	refreshDuration.Observe(d.Seconds())
+	if failedAPI != "" {
+		refreshFailures.WithLabelValues(failedAPI).Inc()
+		return
+	}
+	refreshCountries.Set(float64(processed))
+}
+
+// ObserveRequest records one HTTP request. route is the matched route
+// template, keeping the label set small.
+func ObserveRequest(method, route, status string, d time.Duration) {
+	httpRequests.WithLabelValues(method, route, status).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(d.Seconds())
+}
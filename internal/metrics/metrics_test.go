@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape returns the text /metrics serves
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape status = %d", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestScrape(t *testing.T) {
+	ObserveRefresh(3*time.Second, 250, "")
+	ObserveRefresh(time.Second, 0, "exchangerates")
+	ObserveRequest(http.MethodGet, "/countries/{name}", "404", 20*time.Millisecond)
+
+	body := scrape(t)
+	for _, want := range []string{
+		"# TYPE countryxchange_refreshes_total counter",
+		"countryxchange_refreshes_total 2",
+		`countryxchange_refresh_failures_total{api="exchangerates"} 1`,
+		"countryxchange_refresh_duration_seconds_count 2",
+		"countryxchange_refresh_countries_processed 250",
+		`countryxchange_http_requests_total{method="GET",route="/countries/{name}",status="404"} 1`,
+		`countryxchange_http_request_duration_seconds_count{method="GET",route="/countries/{name}"} 1`,
+		// the runtime collectors are registered too
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape lacks %q", want)
+		}
+	}
+	// a failed refresh leaves the last processed count alone
+	if strings.Contains(body, "countryxchange_refresh_countries_processed 0") {
+		t.Error("failed refresh reset countries_processed")
+	}
+}
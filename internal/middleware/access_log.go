@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// @Middleware		AccessLogMiddleware
+// @Description	Logs one line per request with its outcome
+// @Usage			AccessLogMiddleware()
+// @Checks			Logs request ID, method, raw path, the matched route template (low-cardinality, e.g. /countries/{name}), status and duration
+func AccessLogMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			logger.Info("http request", logger.Fields{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"route":       routeTemplate(r),
+				"status":      sw.status,
+				"duration_ms": time.Since(start).Milliseconds(),
+				"remote_addr": r.RemoteAddr,
+				"request_id":  RequestID(r.Context()),
+			})
+		})
+	}
+}
+
+// routeTemplate returns the path template of the route mux matched, or ""
+// outside a mux route
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return tpl
+}
+
+// statusWriter remembers the status code written by the handler
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusWriter) Write(p []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(p)
+}
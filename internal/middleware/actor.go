@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type contextKey string
+
+const actorKey contextKey = "actor"
+
+// withActor records the authenticated caller on the request context
+func withActor(r *http.Request, actor string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), actorKey, actor))
+}
+
+// Actor identifies who made the request: the authenticated principal set by
+// APIKeyMiddleware, or the client IP for unauthenticated requests
+func Actor(r *http.Request) string {
+	if actor, ok := r.Context().Value(actorKey).(string); ok && actor != "" {
+		return actor
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// @Middleware		APIKeyMiddleware
+// @Description	Restricts admin and debug routes to callers presenting the configured API key
+// @Usage			APIKeyMiddleware(apiKey)
+// @Checks			Reads X-API-Key or "Authorization: Bearer <key>"; rejects every request when no key is configured
+func APIKeyMiddleware(apiKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqFields := logger.Fields{
+				"path":        r.URL.Path,
+				"method":      r.Method,
+				"remote_addr": r.RemoteAddr,
+			}
+
+			if apiKey == "" {
+				logger.Warn("rejected admin request: no API key configured", reqFields)
+				writeError(w, http.StatusForbidden, "Admin API is disabled")
+				return
+			}
+
+			provided := r.Header.Get("X-API-Key")
+			if provided == "" {
+				provided = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			}
+
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+				logger.Warn("rejected admin request: invalid API key", reqFields)
+				writeError(w, http.StatusUnauthorized, "Invalid or missing API key")
+				return
+			}
+
+			next.ServeHTTP(w, withActor(r, "api_key"))
+		})
+	}
+}
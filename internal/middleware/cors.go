@@ -3,15 +3,46 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/zjoart/countryxchange/pkg/logger"
 )
 
+// methods and request headers a cross-origin client may use
+var (
+	corsMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsHeaders = []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID"}
+)
+
+// withinPolicy reports whether every comma-separated item of requested is
+// in allowed (case-insensitive)
+func withinPolicy(requested string, allowed []string) bool {
+	for _, item := range strings.Split(requested, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		ok := false
+		for _, a := range allowed {
+			if strings.EqualFold(item, a) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // @Middleware		CorsMiddleware
 // @Description	Handles Cross-Origin Resource Sharing (CORS) for HTTP requests
-// @Usage			CorsMiddleware(allowedOrigins)
-// @Checks			Validates origin against allowed origins, sets CORS headers, handles preflight requests
-func CorsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
+// @Usage			CorsMiddleware(allowedOrigins, maxAge)
+// @Checks			Validates origin against allowed origins, sets CORS headers, handles preflight requests (cached by browsers for maxAge)
+func CorsMiddleware(allowedOrigins []string, maxAge time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			reqFields := logger.Fields{
@@ -42,10 +73,13 @@ func CorsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 			// Set CORS headers
 			if origin != "" {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
 			}
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsHeaders, ", "))
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			// let browser clients read paging and staleness headers
+			w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, Link, X-Data-Stale, X-Pagination-Applied, X-Request-ID, ETag")
 
 			// Handle preflight requests
 			if r.Method == "OPTIONS" {
@@ -54,6 +88,18 @@ func CorsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 					reqFields["request_headers"] = reqHeaders
 				}
 
+				// echo exactly what was asked for when it is allowed; anything
+				// outside the policy gets the full lists and the browser blocks it
+				if reqMethod := r.Header.Get("Access-Control-Request-Method"); reqMethod != "" && withinPolicy(reqMethod, corsMethods) {
+					w.Header().Set("Access-Control-Allow-Methods", strings.ToUpper(reqMethod))
+				}
+				if reqHeaders != "" && withinPolicy(reqHeaders, corsHeaders) {
+					w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
+				}
+				if maxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+				}
+
 				logger.Debug("handling CORS preflight request", reqFields)
 				w.WriteHeader(http.StatusOK)
 				return
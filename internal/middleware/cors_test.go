@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCorsPreflight(t *testing.T) {
+	var reached bool
+	h := CorsMiddleware([]string{"https://app.example.com"}, 10*time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	tests := []struct {
+		name        string
+		origin      string
+		method      string
+		headers     string
+		wantStatus  int
+		wantMethods string
+		wantHeaders string
+	}{
+		{"allowed request is echoed", "https://app.example.com", "PUT", "X-API-Key, Content-Type", http.StatusOK, "PUT", "X-API-Key, Content-Type"},
+		{"outside the policy gets the full lists", "https://app.example.com", "PATCH", "X-Other", http.StatusOK, "GET, POST, PUT, DELETE, OPTIONS", "Content-Type, Authorization, X-API-Key, X-Request-ID"},
+		{"unknown origin is blocked", "https://evil.example.com", "GET", "", http.StatusForbidden, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(http.MethodOptions, "/countries", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if reached {
+				t.Error("preflight reached the handler")
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.origin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("Allow-Methods = %q, want %q", got, tt.wantMethods)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Headers"); got != tt.wantHeaders {
+				t.Errorf("Allow-Headers = %q, want %q", got, tt.wantHeaders)
+			}
+			if got := rec.Header().Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("Max-Age = %q, want 600", got)
+			}
+		})
+	}
+}
+
+func TestCorsNoMaxAge(t *testing.T) {
+	h := CorsMiddleware([]string{"*"}, 0)(http.NotFoundHandler())
+	req := httptest.NewRequest(http.MethodOptions, "/countries", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if _, ok := rec.Header()["Access-Control-Max-Age"]; ok {
+		t.Errorf("Max-Age set with a zero max age: %q", rec.Header().Get("Access-Control-Max-Age"))
+	}
+}
+
+func TestCorsSimpleRequest(t *testing.T) {
+	h := CorsMiddleware([]string{"*"}, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/countries", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want the handler's %d", rec.Code, http.StatusTeapot)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Allow-Origin = %q", got)
+	}
+	if _, ok := rec.Header()["Access-Control-Max-Age"]; ok {
+		t.Error("Max-Age set on a non-preflight response")
+	}
+}
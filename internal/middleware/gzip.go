@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// @Middleware		GzipMiddleware
+// @Description	Gzip-compresses responses for clients that accept it
+// @Usage			GzipMiddleware(minSize)
+// @Checks			Holds back up to minSize bytes; smaller responses and images go out uncompressed, larger ones are streamed through gzip
+func GzipMiddleware(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !AcceptsGzip(r) || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipWriter{ResponseWriter: w, minSize: minSize}
+			defer gw.finish()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// AcceptsGzip reports whether Accept-Encoding lists gzip with a non-zero q
+func AcceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipWriter buffers the start of a response until it reaches minSize, then
+// decides once: below the threshold the buffer is written as-is when the
+// handler returns, at or above it the response switches to gzip and every
+// later write streams straight through the compressor
+type gzipWriter struct {
+	http.ResponseWriter
+	minSize int
+	code    int
+	buf     []byte
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (g *gzipWriter) WriteHeader(code int) {
+	if g.code == 0 {
+		g.code = code
+	}
+}
+
+func (g *gzipWriter) Write(p []byte) (int, error) {
+	if g.code == 0 {
+		g.code = http.StatusOK
+	}
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(p)
+		}
+		return g.ResponseWriter.Write(p)
+	}
+
+	g.buf = append(g.buf, p...)
+	if len(g.buf) < g.minSize {
+		return len(p), nil
+	}
+	if err := g.start(g.compressible()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// compressible rules out responses that are already encoded or compressed
+func (g *gzipWriter) compressible() bool {
+	h := g.Header()
+	if h.Get("Content-Encoding") != "" || g.code == http.StatusNoContent || g.code == http.StatusNotModified {
+		return false
+	}
+	ct := h.Get("Content-Type")
+	return !strings.HasPrefix(ct, "image/") && !strings.HasPrefix(ct, "application/zip") && ct != "application/gzip"
+}
+
+// start sends the headers and the buffered bytes, through gzip if compress
+func (g *gzipWriter) start(compress bool) error {
+	g.decided = true
+	if compress {
+		h := g.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(g.code)
+	buf := g.buf
+	g.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if g.gz != nil {
+		_, err = g.gz.Write(buf)
+	} else {
+		_, err = g.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// finish flushes whatever the handler left behind
+func (g *gzipWriter) finish() {
+	if !g.decided {
+		if g.code == 0 {
+			g.code = http.StatusOK
+		}
+		g.start(false)
+	}
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
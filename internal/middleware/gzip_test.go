@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gzipServe runs body through GzipMiddleware(minSize) with the given
+// Accept-Encoding and Content-Type
+func gzipServe(minSize int, acceptEncoding, contentType, body string) *httptest.ResponseRecorder {
+	h := GzipMiddleware(minSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		// written in pieces, as a streaming handler would
+		for i := 0; i < len(body); i += 100 {
+			end := i + 100
+			if end > len(body) {
+				end = len(body)
+			}
+			w.Write([]byte(body[i:end]))
+		}
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGzip(t *testing.T) {
+	small := `{"ok":true}`
+	large := strings.Repeat(`{"name":"Ghana","region":"Africa"},`, 100)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		wantGzip       bool
+	}{
+		{"small stays plain", "gzip", "application/json", small, false},
+		{"large is compressed", "gzip, deflate", "application/json", large, true},
+		{"not accepted", "", "application/json", large, false},
+		{"refused with q=0", "gzip;q=0", "application/json", large, false},
+		{"images are left alone", "gzip", "image/png", large, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := gzipServe(1024, tt.acceptEncoding, tt.contentType, tt.body)
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q", got)
+			}
+			if !tt.wantGzip {
+				if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+					t.Errorf("Content-Encoding = %q, want none", enc)
+				}
+				if rec.Body.String() != tt.body {
+					t.Errorf("body changed: %q", rec.Body.String())
+				}
+				return
+			}
+			if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+				t.Fatalf("Content-Encoding = %q, want gzip", enc)
+			}
+			if rec.Body.Len() >= len(tt.body) {
+				t.Errorf("compressed body is %d bytes for %d plain", rec.Body.Len(), len(tt.body))
+			}
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil || string(got) != tt.body {
+				t.Errorf("decompressed to %d bytes (%v), want the %d written", len(got), err, len(tt.body))
+			}
+		})
+	}
+}
+
+func TestGzipKeepsStatus(t *testing.T) {
+	h := GzipMiddleware(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(strings.Repeat("missing ", 10)))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("got %d with Content-Encoding %q, want a gzipped 404", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// ClientIP returns the caller's address. X-Forwarded-For is only honoured
+// when the direct peer is a trusted proxy, and is walked from the right so a
+// client can't spoof its way past the proxies it actually went through.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trustedProxies, ip) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// @Middleware		IPAllowlistMiddleware
+// @Description	Restricts sensitive routes to callers from the configured networks
+// @Usage			IPAllowlistMiddleware(allowed, trustedProxies)
+// @Checks			Resolves the client IP via ClientIP and answers 403 when it is outside allowed; an empty allowed list lets everyone through
+func IPAllowlistMiddleware(allowed, trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r, trustedProxies)
+			if ip == nil || !containsIP(allowed, ip) {
+				logger.Warn("rejected request: client IP not allowlisted", logger.Fields{
+					"path":        r.URL.Path,
+					"method":      r.Method,
+					"remote_addr": r.RemoteAddr,
+					"client_ip":   ip.String(),
+				})
+				writeError(w, http.StatusForbidden, "Access denied from this address")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
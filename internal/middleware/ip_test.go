@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// cidrs parses each of list as a CIDR
+func cidrs(t *testing.T, list ...string) []*net.IPNet {
+	t.Helper()
+	out := make([]*net.IPNet, len(list))
+	for i, s := range list {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[i] = n
+	}
+	return out
+}
+
+func TestIPAllowlist(t *testing.T) {
+	allowed := cidrs(t, "10.0.0.0/8", "2001:db8::/32")
+	proxies := cidrs(t, "192.168.1.0/24")
+	h := IPAllowlistMiddleware(allowed, proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       int
+	}{
+		{"allowed peer", "10.1.2.3:4000", "", http.StatusNoContent},
+		{"allowed IPv6 peer", "[2001:db8::1]:4000", "", http.StatusNoContent},
+		{"denied peer", "203.0.113.9:4000", "", http.StatusForbidden},
+		{"forwarded header from an untrusted peer is ignored", "203.0.113.9:4000", "10.1.2.3", http.StatusForbidden},
+		{"allowed client behind a trusted proxy", "192.168.1.10:4000", "10.1.2.3", http.StatusNoContent},
+		{"denied client behind a trusted proxy", "192.168.1.10:4000", "203.0.113.9", http.StatusForbidden},
+		// the left-most hop is whatever the client claimed; the right-most
+		// untrusted one is what the proxy actually saw
+		{"spoofed left-most hop", "192.168.1.10:4000", "10.1.2.3, 203.0.113.9", http.StatusForbidden},
+		{"chain of trusted proxies", "192.168.1.10:4000", "10.1.2.3, 192.168.1.20", http.StatusNoContent},
+		{"unparseable peer", "not-an-ip", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/dbstats", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPAllowlistEmpty(t *testing.T) {
+	h := IPAllowlistMiddleware(nil, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.9:4000"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d; an empty allowlist should let everyone through", rec.Code)
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zjoart/countryxchange/internal/metrics"
+)
+
+// @Middleware		MetricsMiddleware
+// @Description	Counts requests and records their latency for /metrics
+// @Usage			MetricsMiddleware()
+// @Checks			Labels by method, route template (or "unmatched") and status, never the raw path
+func MetricsMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			route := routeTemplate(r)
+			if route == "" {
+				route = "unmatched"
+			}
+			metrics.ObserveRequest(r.Method, route, strconv.Itoa(sw.status), time.Since(start))
+		})
+	}
+}
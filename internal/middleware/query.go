@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// @Middleware		QueryNormalizationMiddleware
+// @Description	Normalizes query parameter keys sent by malformed clients
+// @Usage			QueryNormalizationMiddleware()
+// @Checks			Trims stray leading '?' from keys (e.g. "?currency") and merges keys that collapse to the same name
+func QueryNormalizationMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.RawQuery == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			raw := r.URL.Query()
+			// well-formed keys before their "?"-prefixed twins, so the merged
+			// values are in the same order on every request
+			keys := make([]string, 0, len(raw))
+			for k := range raw {
+				keys = append(keys, k)
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				ni, nj := strings.TrimLeft(keys[i], "?"), strings.TrimLeft(keys[j], "?")
+				if ni != nj {
+					return ni < nj
+				}
+				return len(keys[i]) < len(keys[j])
+			})
+
+			normalized := make(url.Values, len(raw))
+			changed := false
+			for _, k := range keys {
+				nk := strings.TrimLeft(k, "?")
+				if nk != k {
+					changed = true
+				}
+				if nk == "" {
+					continue
+				}
+				normalized[nk] = append(normalized[nk], raw[k]...)
+			}
+
+			if changed {
+				logger.Debug("normalized malformed query keys", logger.Fields{
+					"path":  r.URL.Path,
+					"query": r.URL.RawQuery,
+				})
+				r.URL.RawQuery = normalized.Encode()
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestQueryNormalization(t *testing.T) {
+	var got url.Values
+	h := QueryNormalizationMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+	}))
+
+	tests := []struct {
+		name  string
+		query string
+		want  url.Values
+	}{
+		{"well formed is untouched", "currency=NGN&region=Africa",
+			url.Values{"currency": {"NGN"}, "region": {"Africa"}}},
+		{"stray leading ?", "?currency=NGN",
+			url.Values{"currency": {"NGN"}}},
+		{"several stray ?", "???currency=NGN&region=Africa",
+			url.Values{"currency": {"NGN"}, "region": {"Africa"}}},
+		{"escaped ?", "%3Fcurrency=NGN",
+			url.Values{"currency": {"NGN"}}},
+		{"duplicates collapse, well formed first", "?currency=GHS&currency=NGN",
+			url.Values{"currency": {"NGN", "GHS"}}},
+		{"repeated malformed keys keep their order", "?sort=gdp_desc&?sort=name_asc",
+			url.Values{"sort": {"gdp_desc", "name_asc"}}},
+		{"key of only ? is dropped", "?=x&region=Africa",
+			url.Values{"region": {"Africa"}}},
+		{"empty value", "?currency=",
+			url.Values{"currency": {""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// repeat so a map-order dependency would show
+			for i := 0; i < 20; i++ {
+				got = nil
+				req := httptest.NewRequest(http.MethodGet, "/countries", nil)
+				req.URL.RawQuery = tt.query
+				h.ServeHTTP(httptest.NewRecorder(), req)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("query %q normalized to %v, want %v", tt.query, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryNormalizationKeepsRawQuery(t *testing.T) {
+	var raw string
+	h := QueryNormalizationMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw = r.URL.RawQuery
+	}))
+
+	// nothing malformed, so the handler sees the client's encoding as sent
+	req := httptest.NewRequest(http.MethodGet, "/countries?region=Africa&currency=NGN", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if raw != "region=Africa&currency=NGN" {
+		t.Errorf("RawQuery = %q, want it unchanged", raw)
+	}
+}
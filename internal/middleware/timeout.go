@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/logger"
+)
+
+// @Middleware		TimeoutMiddleware
+// @Description	Bounds how long any handler may run
+// @Usage			TimeoutMiddleware(d)
+// @Checks			Cancels the request context after d and answers 503 with the JSON error body if nothing was written yet; a zero d disables it
+func TimeoutMiddleware(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{w: w, header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.start()
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				// a client that went away gets no response at all
+				if ctx.Err() != context.DeadlineExceeded {
+					return
+				}
+				fields := logger.Fields{"path": r.URL.Path, "method": r.Method, "timeout": d.String(), "request_id": RequestID(r.Context())}
+				if tw.started {
+					// too late for a 503; the client sees a truncated body
+					logger.Warn("middleware: handler timed out mid-response", fields)
+					return
+				}
+				logger.Warn("middleware: handler timed out", fields)
+				writeError(w, http.StatusServiceUnavailable, "Request timed out")
+			}
+		})
+	}
+}
+
+// timeoutWriter holds back the status and headers until the handler writes
+// its first body bytes, so a handler that times out before that still gets
+// the 503. From the first write on, everything passes straight through to w
+// and a streamed response (such as the CSV export) is never held in memory.
+// Once the deadline passes, writes fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	w        http.ResponseWriter
+	header   http.Header
+	code     int
+	started  bool
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.start()
+	return tw.w.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
+
+// Flush sends what was written so far on to the client
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.start()
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// start sends the status and headers once; tw.mu must be held
+func (tw *timeoutWriter) start() {
+	if tw.started {
+		return
+	}
+	tw.started = true
+	dst := tw.w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	tw.w.WriteHeader(tw.code)
+}
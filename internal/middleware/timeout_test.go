@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutFastHandler(t *testing.T) {
+	h := TimeoutMiddleware(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != "created" || rec.Header().Get("X-Test") != "yes" {
+		t.Errorf("got %d %q (X-Test %q), want 201 \"created\" with the header", rec.Code, rec.Body.String(), rec.Header().Get("X-Test"))
+	}
+}
+
+func TestTimeoutSlowHandler(t *testing.T) {
+	h := TimeoutMiddleware(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusOK)
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["error"] != "Request timed out" {
+		t.Errorf("body = %v, %v", body, err)
+	}
+}
+
+// TestTimeoutStreams checks a response reaches the client while its handler
+// is still running, rather than being buffered until it returns
+func TestTimeoutStreams(t *testing.T) {
+	release := make(chan struct{})
+	h := TimeoutMiddleware(5 * time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first,"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second"))
+	}))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	first := make([]byte, len("first,"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "first," {
+		t.Fatalf("first chunk = %q, %v", first, err)
+	}
+	close(release)
+	rest, _ := io.ReadAll(resp.Body)
+	if string(rest) != "second" {
+		t.Errorf("rest = %q, want \"second\"", rest)
+	}
+}
+
+func TestTimeoutMidResponse(t *testing.T) {
+	writeErr := make(chan error, 1)
+	h := TimeoutMiddleware(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		_, err := w.Write([]byte("late"))
+		writeErr <- err
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// the status went out with the first write, so there is no 503
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if err := <-writeErr; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("write after the deadline = %v, want ErrHandlerTimeout", err)
+	}
+	if got := rec.Body.String(); got != "partial" {
+		t.Errorf("body = %q, want \"partial\"", got)
+	}
+}
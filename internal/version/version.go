@@ -0,0 +1,11 @@
+// Package version holds build metadata injected at link time, e.g.
+//
+//	go build -ldflags "-X github.com/zjoart/countryxchange/internal/version.Commit=abc123"
+package version
+
+var (
+	// Commit is the git commit the binary was built from
+	Commit = "unknown"
+	// BuildDate is the UTC build timestamp in RFC3339
+	BuildDate = "unknown"
+)
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// Time is a time.Time that always marshals as RFC3339 in UTC with whole
+// seconds, matching the timestamps the handlers format by hand
+type Time struct {
+	time.Time
+}
+
+// NewTime wraps t for use in a response field
+func NewTime(t time.Time) *Time {
+	return &Time{Time: t}
+}
+
+// String formats t the same way it is marshaled
+func (t Time) String() string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + t.String() + `"`), nil
+}
+
+// Value stores the underlying time.Time
+func (t Time) Value() (driver.Value, error) {
+	return t.Time, nil
+}
+
+// Scan reads a DATETIME column (requires parseTime=true in the DSN)
+func (t *Time) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		t.Time = v
+	case nil:
+		t.Time = time.Time{}
+	default:
+		return fmt.Errorf("api.Time: cannot scan %T", src)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimeMarshalJSON(t *testing.T) {
+	wat := time.FixedZone("WAT", 3600)
+	tests := []struct {
+		name string
+		in   time.Time
+		want string
+	}{
+		{"utc", time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), `"2026-10-01T12:00:00Z"`},
+		{"sub-second is dropped", time.Date(2026, 10, 1, 12, 0, 0, 123456789, time.UTC), `"2026-10-01T12:00:00Z"`},
+		{"other zones in UTC", time.Date(2026, 10, 1, 13, 30, 15, 999999999, wat), `"2026-10-01T12:30:15Z"`},
+		{"zero", time.Time{}, `"0001-01-01T00:00:00Z"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(NewTime(tt.in))
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("Marshal = %s, want %s", b, tt.want)
+			}
+			if got := `"` + NewTime(tt.in).String() + `"`; got != tt.want {
+				t.Errorf("String = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountryLastRefreshedAtFormat(t *testing.T) {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 500, time.Local)
+	b, err := json.Marshal(Country{Name: "Ghana", LastRefreshedAt: NewTime(at)})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatal(err)
+	}
+	// the same text the handlers write by hand for /status
+	want := at.UTC().Format(time.RFC3339)
+	if raw["last_refreshed_at"] != want {
+		t.Errorf("last_refreshed_at = %v, want %s", raw["last_refreshed_at"], want)
+	}
+
+	// and it reads back into the same second
+	var c Country
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !c.LastRefreshedAt.Equal(at.Truncate(time.Second)) {
+		t.Errorf("round trip = %v, want %v", c.LastRefreshedAt, at.Truncate(time.Second))
+	}
+
+	// a missing time is left out rather than written as the zero time
+	b, _ = json.Marshal(Country{Name: "Ghana"})
+	var bare map[string]interface{}
+	if err := json.Unmarshal(b, &bare); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bare["last_refreshed_at"]; ok {
+		t.Errorf("nil LastRefreshedAt marshaled: %s", b)
+	}
+}
+
+func TestTimeScan(t *testing.T) {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	var got Time
+	if err := got.Scan(at); err != nil || !got.Equal(at) {
+		t.Errorf("Scan(time) = %v, %v", got, err)
+	}
+	if err := got.Scan(nil); err != nil || !got.IsZero() {
+		t.Errorf("Scan(nil) = %v, %v", got, err)
+	}
+	if err := got.Scan("2026-10-01 12:00:00"); err == nil {
+		t.Error("Scan(string) succeeded, want an error without parseTime")
+	}
+}
@@ -0,0 +1,119 @@
+// Package api holds the request/response types shared by the server and
+// pkg/client
+package api
+
+// ValidationError represents field-level validation errors
+type ValidationError struct {
+	Errors map[string]string `json:"details"`
+}
+
+func (v *ValidationError) Error() string {
+	return "Validation failed"
+}
+
+// Country represents a country record stored in the DB and returned by the API
+type Country struct {
+	ID            int64    `json:"id"`
+	Name          string   `json:"name"`
+	Capital       *string  `json:"capital,omitempty"`
+	Region        *string  `json:"region,omitempty"`
+	Population    int64    `json:"population"`
+	CurrencyCode  *string  `json:"currency_code,omitempty"`
+	CurrencyCodes []string `json:"currency_codes,omitempty"`
+	// CurrencyRates maps each of CurrencyCodes to its USD rate; codes
+	// missing from the rates feed are left out
+	CurrencyRates map[string]float64 `json:"currency_rates,omitempty"`
+	ExchangeRate  *float64           `json:"exchange_rate,omitempty"`
+	// EstimatedGDP is population * multiplier / ExchangeRate in GDPUnit,
+	// where multiplier is GDP_MULTIPLIER or a random 1000-2000
+	EstimatedGDP    *float64 `json:"estimated_gdp,omitempty"`
+	FlagURL         *string  `json:"flag_url,omitempty"`
+	NumericCode     *string  `json:"numeric_code,omitempty"`
+	Area            *float64 `json:"area,omitempty"` // km²
+	Source          string   `json:"source,omitempty"`
+	LastRefreshedAt *Time    `json:"last_refreshed_at,omitempty"`
+
+	// computed at read time, not stored
+	RateAgeSeconds *int64 `json:"rate_age_seconds,omitempty"`
+	RateStale      *bool  `json:"rate_stale,omitempty"`
+	// CurrencySymbol is only set for common currencies
+	CurrencySymbol *string `json:"currency_symbol,omitempty"`
+	// GDPUnit is the unit of EstimatedGDP (USD or USD_millions)
+	GDPUnit *string `json:"gdp_unit,omitempty"`
+	// PopulationDensity is people per km², null without a positive Area
+	PopulationDensity *float64 `json:"population_density,omitempty"`
+}
+
+// Validate ensures required fields are present and valid
+func (c *Country) Validate() error {
+	errors := make(map[string]string)
+
+	if c.Name == "" {
+		errors["name"] = "is required"
+	}
+	if c.Population <= 0 {
+		errors["population"] = "must be positive"
+	}
+	if c.CurrencyCode == nil || *c.CurrencyCode == "" {
+		errors["currency_code"] = "is required"
+	}
+	if c.ExchangeRate != nil && *c.ExchangeRate <= 0 {
+		errors["exchange_rate"] = "must be positive"
+	}
+	if c.Area != nil && *c.Area < 0 {
+		errors["area"] = "must not be negative"
+	}
+
+	if len(errors) > 0 {
+		return &ValidationError{Errors: errors}
+	}
+	return nil
+}
+
+// RefreshTimings breaks a refresh down by phase, in milliseconds. ImageMs is
+// only set when the image is rendered before the refresh returns.
+type RefreshTimings struct {
+	FetchCountriesMs int64  `json:"fetch_countries_ms"`
+	FetchRatesMs     int64  `json:"fetch_rates_ms"`
+	DBWriteMs        int64  `json:"db_write_ms"`
+	ImageMs          *int64 `json:"image_ms,omitempty"`
+}
+
+// RefreshImage is the outcome of rendering the summary image inside a refresh
+type RefreshImage struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RefreshResponse is the body of POST /countries/refresh
+type RefreshResponse struct {
+	Message         string         `json:"message"`
+	Total           int            `json:"total"`
+	Skipped         int            `json:"skipped"`
+	StaleRates      bool           `json:"stale_rates,omitempty"` // rates feed was down, last stored rates reused
+	Partial         bool           `json:"partial,omitempty"`
+	Warnings        []string       `json:"warnings,omitempty"`
+	ByRegion        map[string]int `json:"by_region"`
+	Timings         RefreshTimings `json:"timings"`
+	LastRefreshedAt string         `json:"last_refreshed_at"`
+	Image           *RefreshImage  `json:"image,omitempty"`
+}
+
+// StatusResponse is the body of GET /status
+type StatusResponse struct {
+	TotalCountries  int64   `json:"total_countries"`
+	LastRefreshedAt *string `json:"last_refreshed_at"`
+	GDPUnit         string  `json:"gdp_unit"`
+	// RatesBase is the currency exchange rates and estimated GDP are
+	// relative to
+	RatesBase string `json:"rates_base"`
+	// DBOK reports whether the DB answered a ping; when false the other
+	// fields are empty and the status is 503
+	DBOK bool `json:"db_ok"`
+}
+
+// ErrorResponse is the body of every non-2xx JSON response
+type ErrorResponse struct {
+	Error   string      `json:"error"`
+	Details interface{} `json:"details,omitempty"`
+}
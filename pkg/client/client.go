@@ -0,0 +1,206 @@
+// Package client is a typed Go client for the countryxchange HTTP API
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zjoart/countryxchange/pkg/api"
+)
+
+// sentinel errors matched by APIError via errors.Is
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrUnavailable  = errors.New("upstream unavailable")
+	ErrValidation   = errors.New("validation failed")
+)
+
+// APIError is a non-2xx response decoded from the API's error body
+type APIError struct {
+	StatusCode int
+	Message    string
+	Details    json.RawMessage
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("countryxchange: %d %s", e.StatusCode, e.Message)
+}
+
+// Is lets callers use errors.Is(err, client.ErrNotFound) and friends
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	case ErrValidation:
+		return e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// ValidationErrors returns the per-field messages of a validation failure,
+// or nil when the error carries none
+func (e *APIError) ValidationErrors() map[string]string {
+	var fields map[string]string
+	if json.Unmarshal(e.Details, &fields) != nil {
+		return nil
+	}
+	return fields
+}
+
+// Client talks to a countryxchange server
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces the default http.Client (30s timeout)
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithAPIKey sends key as X-API-Key on every request
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// New returns a Client for the server at baseURL, including any BASE_PATH
+// prefix (e.g. https://example.com/api/v1)
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ListOptions are the optional filters of ListCountries
+type ListOptions struct {
+	Region        string
+	Currency      string
+	Source        string
+	HasFlag       *bool
+	ModifiedSince time.Time
+	Sort          string
+}
+
+func (o ListOptions) values() url.Values {
+	q := url.Values{}
+	// the typed Country decodes numbers as floats, whatever the server default
+	q.Set("numbers", "number")
+	if o.Region != "" {
+		q.Set("region", o.Region)
+	}
+	if o.Currency != "" {
+		q.Set("currency", o.Currency)
+	}
+	if o.Source != "" {
+		q.Set("source", o.Source)
+	}
+	if o.HasFlag != nil {
+		q.Set("has_flag", fmt.Sprint(*o.HasFlag))
+	}
+	if !o.ModifiedSince.IsZero() {
+		q.Set("modified_since", o.ModifiedSince.UTC().Format(time.RFC3339))
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	return q
+}
+
+// ListCountries calls GET /countries
+func (c *Client) ListCountries(ctx context.Context, opts ListOptions) ([]api.Country, error) {
+	out := []api.Country{}
+	if err := c.do(ctx, http.MethodGet, "/countries", opts.values(), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetCountry calls GET /countries/{name}
+func (c *Client) GetCountry(ctx context.Context, name string) (*api.Country, error) {
+	var out api.Country
+	q := url.Values{"numbers": {"number"}}
+	if err := c.do(ctx, http.MethodGet, "/countries/"+url.PathEscape(name), q, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Refresh calls POST /countries/refresh
+func (c *Client) Refresh(ctx context.Context) (*api.RefreshResponse, error) {
+	var out api.RefreshResponse
+	if err := c.do(ctx, http.MethodPost, "/countries/refresh", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Status calls GET /status
+func (c *Client) Status(ctx context.Context) (*api.StatusResponse, error) {
+	var out api.StatusResponse
+	if err := c.do(ctx, http.MethodGet, "/status", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// do sends the request and decodes a 2xx body into out or an error body
+// into *APIError
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, out interface{}) error {
+	u := c.baseURL + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		var body struct {
+			Error   string          `json:"error"`
+			Details json.RawMessage `json:"details"`
+		}
+		if data, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(data, &body) == nil && body.Error != "" {
+			apiErr.Message = body.Error
+			apiErr.Details = body.Details
+		}
+		return apiErr
+	}
+	// servers with LIST_EMPTY_STATUS=204 answer an empty list without a body
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// recorded is what the test server saw of the last request
+type recorded struct {
+	method, path, apiKey string
+	query                url.Values
+}
+
+// newServer answers every request with status and body, recording it in rec
+func newServer(t *testing.T, status int, body string, rec *recorded) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rec != nil {
+			*rec = recorded{method: r.Method, path: r.URL.EscapedPath(), apiKey: r.Header.Get("X-API-Key"), query: r.URL.Query()}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestListCountries(t *testing.T) {
+	var rec recorded
+	srv := newServer(t, http.StatusOK, `[{"id":1,"name":"Ghana","population":30,"currency_code":"GHS",
+		"exchange_rate":15,"estimated_gdp":3000,"last_refreshed_at":"2026-10-01T12:00:00Z"}]`, &rec)
+	// the base path and a trailing slash are kept and trimmed
+	c := New(srv.URL+"/api/v1/", WithAPIKey("secret"))
+
+	hasFlag := true
+	list, err := c.ListCountries(context.Background(), ListOptions{
+		Region:        "Africa",
+		Currency:      "GHS",
+		HasFlag:       &hasFlag,
+		ModifiedSince: time.Date(2026, 9, 1, 1, 0, 0, 0, time.FixedZone("WAT", 3600)),
+		Sort:          "gdp_desc",
+	})
+	if err != nil {
+		t.Fatalf("ListCountries: %v", err)
+	}
+
+	if rec.method != http.MethodGet || rec.path != "/api/v1/countries" {
+		t.Errorf("request = %s %s, want GET /api/v1/countries", rec.method, rec.path)
+	}
+	if rec.apiKey != "secret" {
+		t.Errorf("X-API-Key = %q, want secret", rec.apiKey)
+	}
+	want := url.Values{
+		"numbers":        {"number"},
+		"region":         {"Africa"},
+		"currency":       {"GHS"},
+		"has_flag":       {"true"},
+		"modified_since": {"2026-09-01T00:00:00Z"},
+		"sort":           {"gdp_desc"},
+	}
+	for k, v := range want {
+		if got := rec.query.Get(k); got != v[0] {
+			t.Errorf("?%s = %q, want %q", k, got, v[0])
+		}
+	}
+	if len(rec.query) != len(want) {
+		t.Errorf("query = %v, want %v", rec.query, want)
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("got %d countries, want 1", len(list))
+	}
+	g := list[0]
+	if g.Name != "Ghana" || *g.ExchangeRate != 15 || *g.EstimatedGDP != 3000 {
+		t.Errorf("decoded %+v", g)
+	}
+	if !g.LastRefreshedAt.Equal(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("LastRefreshedAt = %v", g.LastRefreshedAt)
+	}
+}
+
+func TestListCountriesNoContent(t *testing.T) {
+	srv := newServer(t, http.StatusNoContent, "", nil)
+	list, err := New(srv.URL).ListCountries(context.Background(), ListOptions{})
+	if err != nil {
+		t.Fatalf("ListCountries: %v", err)
+	}
+	if list == nil || len(list) != 0 {
+		t.Errorf("list = %#v, want an empty non-nil slice", list)
+	}
+}
+
+func TestGetCountry(t *testing.T) {
+	var rec recorded
+	srv := newServer(t, http.StatusOK, `{"id":7,"name":"Côte d'Ivoire","population":28}`, &rec)
+
+	got, err := New(srv.URL).GetCountry(context.Background(), "Côte d'Ivoire")
+	if err != nil {
+		t.Fatalf("GetCountry: %v", err)
+	}
+	if rec.path != "/countries/C%C3%B4te%20d%27Ivoire" {
+		t.Errorf("path = %s, want the escaped name", rec.path)
+	}
+	if rec.apiKey != "" {
+		t.Errorf("X-API-Key = %q without WithAPIKey", rec.apiKey)
+	}
+	if rec.query.Get("numbers") != "number" {
+		t.Errorf("numbers = %q, want number", rec.query.Get("numbers"))
+	}
+	if got.ID != 7 || got.Name != "Côte d'Ivoire" {
+		t.Errorf("decoded %+v", got)
+	}
+}
+
+func TestRefreshAndStatus(t *testing.T) {
+	var rec recorded
+	srv := newServer(t, http.StatusOK, `{"message":"Refresh successful","total":250,"skipped":2,
+		"by_region":{"Africa":59},"timings":{"fetch_countries_ms":1,"fetch_rates_ms":2,"db_write_ms":3},
+		"last_refreshed_at":"2026-10-01T12:00:00Z"}`, &rec)
+	res, err := New(srv.URL).Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if rec.method != http.MethodPost || rec.path != "/countries/refresh" {
+		t.Errorf("request = %s %s, want POST /countries/refresh", rec.method, rec.path)
+	}
+	if res.Total != 250 || res.Skipped != 2 || res.ByRegion["Africa"] != 59 || res.Timings.DBWriteMs != 3 {
+		t.Errorf("decoded %+v", res)
+	}
+
+	srv = newServer(t, http.StatusOK, `{"total_countries":250,"last_refreshed_at":"2026-10-01T12:00:00Z",
+		"gdp_unit":"USD","rates_base":"USD","db_ok":true}`, &rec)
+	st, err := New(srv.URL).Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if rec.method != http.MethodGet || rec.path != "/status" {
+		t.Errorf("request = %s %s, want GET /status", rec.method, rec.path)
+	}
+	if st.TotalCountries != 250 || !st.DBOK || st.RatesBase != "USD" || *st.LastRefreshedAt != "2026-10-01T12:00:00Z" {
+		t.Errorf("decoded %+v", st)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		is          error
+		wantMessage string
+	}{
+		{"not found", http.StatusNotFound, `{"error":"Country not found"}`, ErrNotFound, "Country not found"},
+		{"unauthorized", http.StatusUnauthorized, `{"error":"Unauthorized"}`, ErrUnauthorized, "Unauthorized"},
+		{"forbidden", http.StatusForbidden, `{"error":"Forbidden"}`, ErrUnauthorized, "Forbidden"},
+		{"unavailable", http.StatusServiceUnavailable, `{"error":"External data source unavailable","details":"Could not fetch data from restcountries"}`, ErrUnavailable, "External data source unavailable"},
+		{"validation", http.StatusUnprocessableEntity, `{"error":"Validation failed","details":{"population":"must be positive"}}`, ErrValidation, "Validation failed"},
+		// a proxy's HTML page falls back to the status text
+		{"not json", http.StatusBadGateway, `<html>bad gateway</html>`, nil, "Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t, tt.status, tt.body, nil)
+			_, err := New(srv.URL).GetCountry(context.Background(), "Atlantis")
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.wantMessage {
+				t.Errorf("APIError = %d %q, want %d %q", apiErr.StatusCode, apiErr.Message, tt.status, tt.wantMessage)
+			}
+			for _, sentinel := range []error{ErrNotFound, ErrUnauthorized, ErrUnavailable, ErrValidation} {
+				if got := errors.Is(err, sentinel); got != (sentinel == tt.is) {
+					t.Errorf("errors.Is(err, %v) = %t", sentinel, got)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	srv := newServer(t, http.StatusUnprocessableEntity,
+		`{"error":"Validation failed","details":{"population":"must be positive","currency_code":"is required"}}`, nil)
+	_, err := New(srv.URL).ListCountries(context.Background(), ListOptions{})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want an *APIError", err)
+	}
+	fields := apiErr.ValidationErrors()
+	if fields["population"] != "must be positive" || fields["currency_code"] != "is required" {
+		t.Errorf("ValidationErrors() = %v", fields)
+	}
+
+	// string details aren't per-field messages
+	plain := &APIError{StatusCode: http.StatusBadRequest, Details: []byte(`"limit must be a positive integer"`)}
+	if got := plain.ValidationErrors(); got != nil {
+		t.Errorf("ValidationErrors() of a string = %v, want nil", got)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	c := New(srv.URL, WithHTTPClient(&http.Client{Timeout: 50 * time.Millisecond}))
+	start := time.Now()
+	if _, err := c.Status(context.Background()); err == nil {
+		t.Fatal("Status succeeded past the client timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("gave up after %v, want the 50ms client timeout", elapsed)
+	}
+
+	// the context bounds a call too
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := New(srv.URL).Status(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"sync/atomic"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -15,6 +17,7 @@ const (
 	EmailKey     = "email"
 	SessionIDKey = "session_id"
 	IPKey        = "ip"
+	RequestIDKey = "request_id"
 	ErrorKey     = "error"
 	CallerKey    = "caller"
 )
@@ -124,6 +127,13 @@ func WithIP(ip string) Fields {
 	}
 }
 
+// WithRequestID adds a request ID field to the log entry
+func WithRequestID(requestID string) Fields {
+	return Fields{
+		RequestIDKey: requestID,
+	}
+}
+
 // Merge combines multiple Fields into a single Fields object
 func Merge(fields ...Fields) Fields {
 	merged := make(Fields)
@@ -143,3 +153,29 @@ func getZapFields(fields Fields) []zap.Field {
 	}
 	return zapFields
 }
+
+// Sampler thins out a noisy log line by letting through one in every n
+// calls. n <= 0 drops every call and n == 1 keeps them all.
+type Sampler struct {
+	n     uint64
+	count atomic.Uint64
+}
+
+// NewSampler returns a Sampler that allows one in every n calls
+func NewSampler(n int) *Sampler {
+	if n < 0 {
+		n = 0
+	}
+	return &Sampler{n: uint64(n)}
+}
+
+// Allow reports whether this call should be logged
+func (s *Sampler) Allow() bool {
+	if s == nil {
+		return true
+	}
+	if s.n == 0 {
+		return false
+	}
+	return (s.count.Add(1)-1)%s.n == 0
+}